@@ -0,0 +1,214 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// holdDuringRestore 恢复备份期间阻塞其他请求，恢复完成后再继续处理
+func (h *Handler) holdDuringRestore(c *gin.Context) {
+	h.restoreMu.RLock()
+	defer h.restoreMu.RUnlock()
+	c.Next()
+}
+
+// backupDatabase 处理创建备份的请求
+func (h *Handler) backupDatabase(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	// 请求体可以省略
+	var req BackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.Database == "" {
+		req.Database = h.dbs.DefaultName()
+	}
+
+	info, err := h.dbs.Backup(req.Database)
+	if err != nil {
+		logger.ErrorWithLocation("创建备份失败", err,
+			zap.String("database", req.Database),
+			zap.String("handler", "backupDatabase"),
+		)
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to create backup: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, Response{
+		Status:  "success",
+		Message: "Backup created successfully",
+		Data:    info,
+	})
+}
+
+// listBackups 处理列出备份的请求
+func (h *Handler) listBackups(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	backups, err := h.dbs.ListBackups()
+	if err != nil {
+		logger.Error("列出备份失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to list backups: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   backups,
+	})
+}
+
+// restoreDatabase 处理恢复备份的请求，恢复期间暂停其他所有请求
+func (h *Handler) restoreDatabase(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// 等待正在处理的请求结束，并阻塞新的请求直到恢复完成
+	h.restoreMu.Lock()
+	defer h.restoreMu.Unlock()
+
+	logger.Info("开始恢复备份",
+		zap.String("file", req.File),
+		zap.String("database", req.Database),
+	)
+	manifest, err := h.dbs.Restore(req.Database, req.File)
+	if err != nil {
+		logger.ErrorWithLocation("恢复备份失败", err,
+			zap.String("file", req.File),
+			zap.String("database", req.Database),
+			zap.String("handler", "restoreDatabase"),
+		)
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to restore backup: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Backup restored successfully",
+		Data:    manifest,
+	})
+}
+
+// mergeDatabase 处理手动合并的请求，合并在后台进行，通过mergeStatus查询进度
+func (h *Handler) mergeDatabase(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.Database == "" {
+		req.Database = h.dbs.DefaultName()
+	}
+
+	db, err := h.dbs.Get(req.Database)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + req.Database + ": " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	run, err := db.StartMerge(storage.MergeTriggerManual)
+	if err != nil {
+		logger.Error("启动合并失败",
+			zap.String("database", req.Database),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to start merge: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Response{
+		Status:  "success",
+		Message: "Merge started",
+		Data:    run,
+	})
+}
+
+// mergeStatus 处理查询合并状态的请求
+func (h *Handler) mergeStatus(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.DefaultQuery("database", h.dbs.DefaultName())
+	db, err := h.dbs.Get(name)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + name + ": " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   db.MergeStatus(),
+	})
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// batchWrite 处理批量写入请求，所有操作要么全部生效要么全部不生效
+func (h *Handler) batchWrite(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Operations are required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	results := make([]BatchOpResult, len(req.Operations))
+	for i, op := range req.Operations {
+		results[i] = BatchOpResult{Index: i, Op: op.Op, Key: op.Key, Status: "aborted"}
+	}
+
+	// 逐个加入批量写入，任何一个操作不合法都放弃整个批次
+	batch := h.db(c).NewWriteBatchWithRequestID(c.GetString("requestID"))
+	for i, op := range req.Operations {
+		var err error
+		switch {
+		case op.Key == "":
+			err = errors.New("key is required")
+		case op.Op == BatchOpPut:
+			err = batch.Put([]byte(op.Key), []byte(op.Value))
+		case op.Op == BatchOpDelete:
+			err = batch.Delete([]byte(op.Key))
+		default:
+			err = errors.New("unsupported op: " + op.Op)
+		}
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+
+			code := http.StatusBadRequest
+			if errors.Is(err, storage.ErrBatchTooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			logger.Warn("批量写入操作无效",
+				zap.Int("index", i),
+				zap.String("op", op.Op),
+				zap.String("key", op.Key),
+				zap.Error(err))
+			c.JSON(code, Response{
+				Status:  "error",
+				Message: "Batch rejected: " + err.Error(),
+				Data:    BatchResponse{Applied: false, Results: results},
+			})
+			return
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		logger.Error("提交批量写入失败",
+			zap.Int("operations", len(req.Operations)),
+			zap.Error(err))
+		code := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrBatchTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		for i := range results {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+		}
+		c.JSON(code, Response{
+			Status:  "error",
+			Message: "Failed to commit batch: " + err.Error(),
+			Data:    BatchResponse{Applied: false, Results: results},
+		})
+		return
+	}
+
+	for i := range results {
+		results[i].Status = "applied"
+	}
+	logger.Info("成功提交批量写入", zap.Int("operations", len(req.Operations)))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Batch applied successfully",
+		Data:    BatchResponse{Applied: true, Results: results},
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// casKey 处理比较并交换请求，仅当键的当前值等于expected时写入新值
+func (h *Handler) casKey(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var req CASRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败",
+			zap.String("key", key),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var expected []byte
+	if req.Expected != nil {
+		expected = []byte(*req.Expected)
+	}
+	meta, current, err := h.db(c).CompareAndSwap([]byte(key), expected, []byte(req.Value), c.GetString("requestID"))
+	if errors.Is(err, storage.ErrConditionNotMet) {
+		logger.Info("比较并交换未生效", zap.String("key", key))
+		resp := CASResponse{Key: key, Swapped: false}
+		if current != nil {
+			value := string(current.Value)
+			resp.Current = &value
+			resp.KeyMetadata = newKeyMetadata(current.Meta)
+			c.Header("ETag", entryETag(current))
+		}
+		c.JSON(http.StatusPreconditionFailed, Response{
+			Status:  "error",
+			Message: "Current value does not match expected value",
+			Data:    resp,
+		})
+		return
+	}
+	if err != nil {
+		logger.Error("比较并交换失败",
+			zap.String("key", key),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to swap value: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	logger.Info("比较并交换成功", zap.String("key", key))
+	c.Header("ETag", makeETag(meta, []byte(req.Value)))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Value swapped successfully",
+		Data: CASResponse{
+			Key:         key,
+			Swapped:     true,
+			Value:       req.Value,
+			KeyMetadata: newKeyMetadata(meta),
+		},
+	})
+}
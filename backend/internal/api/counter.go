@@ -0,0 +1,128 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// incrKey 处理自增请求
+func (h *Handler) incrKey(c *gin.Context) {
+	h.counterUpdate(c, false)
+}
+
+// decrKey 处理自减请求，delta取反后与自增相同
+func (h *Handler) decrKey(c *gin.Context) {
+	h.counterUpdate(c, true)
+}
+
+// counterUpdate 原子地把键的数值加上delta（negate为true时减去delta）并返回新值
+func (h *Handler) counterUpdate(c *gin.Context, negate bool) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	// 请求体可以省略，此时delta为1
+	var req IncrRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.Error("解析请求体失败",
+			zap.String("key", key),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.Delta == "" {
+		req.Delta = "1"
+	}
+
+	var value string
+	var meta *storage.KeyMeta
+	var err error
+	switch req.Mode {
+	case CounterModeInt, "":
+		var delta int64
+		if delta, err = strconv.ParseInt(string(req.Delta), 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: delta must be an integer in int mode",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if negate {
+			if delta == math.MinInt64 {
+				err = storage.ErrNumberOverflow
+				break
+			}
+			delta = -delta
+		}
+		var n int64
+		if n, meta, err = h.db(c).IncrBy([]byte(key), delta); err == nil {
+			value = strconv.FormatInt(n, 10)
+		}
+	case CounterModeFloat:
+		var delta float64
+		if delta, err = strconv.ParseFloat(string(req.Delta), 64); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: delta must be a number",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if negate {
+			delta = -delta
+		}
+		var f float64
+		if f, meta, err = h.db(c).IncrByFloat([]byte(key), delta); err == nil {
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: unsupported mode " + strconv.Quote(req.Mode),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if err != nil {
+		logger.Error("更新计数器失败",
+			zap.String("key", key),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to update counter: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	logger.Info("更新计数器成功",
+		zap.String("key", key),
+		zap.String("value", value))
+	c.Header("ETag", makeETag(meta, []byte(value)))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Counter updated successfully",
+		Data: IncrResponse{
+			Key:         key,
+			Value:       json.Number(value),
+			KeyMetadata: newKeyMetadata(meta),
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// databaseContextKey 是请求上下文中保存命名数据库的键
+const databaseContextKey = "database"
+
+// resolveDatabase 根据路由中的 :name 找到命名数据库并放入请求上下文
+func (h *Handler) resolveDatabase(c *gin.Context) {
+	name := c.Param("name")
+	db, err := h.dbs.Get(name)
+	if err != nil {
+		logger.Warn("获取数据库失败",
+			zap.String("database", name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.AbortWithStatusJSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + name + ": " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+	c.Set(databaseContextKey, db)
+	c.Next()
+}
+
+// listDatabases 处理列出命名数据库的请求
+func (h *Handler) listDatabases(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	infos, err := h.dbs.List()
+	if err != nil {
+		logger.Error("列出数据库失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to list databases: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   infos,
+	})
+}
+
+// createDatabase 处理创建命名数据库的请求
+func (h *Handler) createDatabase(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req CreateDatabaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if _, err := h.dbs.Create(req.Name); err != nil {
+		logger.Error("创建数据库失败",
+			zap.String("database", req.Name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to create database: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	logger.Info("成功创建数据库", zap.String("database", req.Name))
+	c.JSON(http.StatusCreated, Response{
+		Status:  "success",
+		Message: "Database created successfully",
+		Data: gin.H{
+			"name": req.Name,
+		},
+	})
+}
+
+// dropDatabase 处理删除命名数据库的请求
+func (h *Handler) dropDatabase(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.Param("name")
+	if err := h.dbs.Drop(name); err != nil {
+		logger.Error("删除数据库失败",
+			zap.String("database", name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to drop database: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	logger.Info("成功删除数据库", zap.String("database", name))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Database dropped successfully",
+		Data: gin.H{
+			"name": name,
+		},
+	})
+}
+
+// dbStats 处理获取数据库统计信息的请求，/db/stats 返回默认数据库的统计信息
+func (h *Handler) dbStats(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.Param("name")
+	if name == "" {
+		name = h.dbs.DefaultName()
+	}
+	stats, err := h.db(c).DatabaseStats()
+	if err != nil {
+		logger.Error("获取数据库统计信息失败",
+			zap.String("database", name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get database stats: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   StatsResponse{Database: name, DBStats: stats},
+	})
+}
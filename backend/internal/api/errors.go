@@ -0,0 +1,66 @@
+package api
+
+import (
+	"FastDB-Web/internal/jsondoc"
+	"FastDB-Web/internal/storage"
+	"FastDB-Web/internal/structures"
+	"errors"
+	"net/http"
+)
+
+// storageErrorStatus 将存储层错误映射为HTTP状态码
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrKeyNotFound),
+		errors.Is(err, storage.ErrDatabaseNotFound),
+		errors.Is(err, storage.ErrBackupNotFound),
+		errors.Is(err, storage.ErrIndexNotFound),
+		errors.Is(err, storage.ErrVersionNotFound),
+		errors.Is(err, storage.ErrHistoryDisabled),
+		errors.Is(err, structures.ErrFieldNotFound),
+		errors.Is(err, structures.ErrMemberNotFound),
+		errors.Is(err, jsondoc.ErrPathNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrDatabaseExists),
+		errors.Is(err, storage.ErrDropDefaultDatabase),
+		errors.Is(err, storage.ErrMergeInProgress),
+		errors.Is(err, storage.ErrNotNumber),
+		errors.Is(err, storage.ErrNumberOverflow),
+		errors.Is(err, storage.ErrIndexExists),
+		errors.Is(err, storage.ErrIndexNotReady),
+		errors.Is(err, storage.ErrSearchRebuilding),
+		errors.Is(err, storage.ErrReadOnlyReplica),
+		errors.Is(err, structures.ErrWrongType),
+		errors.Is(err, jsondoc.ErrNotJSON),
+		errors.Is(err, jsondoc.ErrPatchConflict):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrResumeTokenExpired),
+		errors.Is(err, storage.ErrSnapshotRequired):
+		return http.StatusGone
+	case errors.Is(err, storage.ErrFeedClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrConditionNotMet):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, storage.ErrKeyIsEmpty),
+		errors.Is(err, storage.ErrReservedKey),
+		errors.Is(err, storage.ErrInvalidExpireAt),
+		errors.Is(err, storage.ErrInvalidDatabaseName),
+		errors.Is(err, storage.ErrInvalidBackup),
+		errors.Is(err, storage.ErrInvalidIndex),
+		errors.Is(err, storage.ErrInvalidIndexValue),
+		errors.Is(err, storage.ErrEmptyQuery),
+		errors.Is(err, storage.ErrInvalidResumeToken),
+		errors.Is(err, structures.ErrInvalidScore),
+		errors.Is(err, jsondoc.ErrInvalidPointer),
+		errors.Is(err, jsondoc.ErrInvalidPatch):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrBatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, storage.ErrMergeUnsupported),
+		errors.Is(err, storage.ErrSearchDisabled),
+		errors.Is(err, storage.ErrNotLeader):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
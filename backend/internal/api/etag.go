@@ -0,0 +1,87 @@
+package api
+
+import (
+	"FastDB-Web/internal/storage"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// makeETag 根据键的版本和创建时间生成ETag，旧数据没有元数据时使用值的哈希。
+// 不保留历史版本时，键被删除后重新创建会从版本1重新编号，加上创建时间保证新旧两个键的ETag不同
+func makeETag(meta *storage.KeyMeta, value []byte) string {
+	if meta != nil {
+		return `"v` + strconv.FormatUint(meta.Version, 10) + "-" + strconv.FormatInt(meta.CreatedAt.UnixNano(), 36) + `"`
+	}
+	h := fnv.New64a()
+	h.Write(value)
+	return `"h` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// entryETag 返回键当前状态的ETag
+func entryETag(e *storage.Entry) string {
+	return makeETag(e.Meta, e.Value)
+}
+
+// conditions 表示请求中的 If-Match 和 If-None-Match 条件
+type conditions struct {
+	ifMatch     []string
+	ifNoneMatch []string
+}
+
+// parseConditions 解析请求中的条件头
+func parseConditions(c *gin.Context) conditions {
+	return conditions{
+		ifMatch:     splitETags(c.GetHeader("If-Match")),
+		ifNoneMatch: splitETags(c.GetHeader("If-None-Match")),
+	}
+}
+
+// splitETags 拆分以逗号分隔的ETag列表
+func splitETags(header string) []string {
+	if header == "" {
+		return nil
+	}
+	parts := strings.Split(header, ",")
+	tags := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			tags = append(tags, p)
+		}
+	}
+	return tags
+}
+
+// check 检查键的当前状态是否满足条件，cur为nil表示键不存在
+func (cond conditions) check(cur *storage.Entry) error {
+	if len(cond.ifMatch) > 0 {
+		// If-Match 使用强比较，弱ETag永远不匹配
+		if cur == nil || !matchETag(cond.ifMatch, entryETag(cur), false) {
+			return storage.ErrConditionNotMet
+		}
+	}
+	if len(cond.ifNoneMatch) > 0 && cur != nil {
+		if matchETag(cond.ifNoneMatch, entryETag(cur), true) {
+			return storage.ErrConditionNotMet
+		}
+	}
+	return nil
+}
+
+// matchETag 判断etag是否在列表中，"*"匹配任意已存在的键
+func matchETag(tags []string, etag string, weak bool) bool {
+	for _, tag := range tags {
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -3,8 +3,13 @@ package api
 import (
 	"FastDB-Web/global"
 	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/replication"
 	"FastDB-Web/internal/storage"
+	"context"
+	"errors"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -12,8 +17,20 @@ import (
 
 // Handler 处理HTTP请求
 type Handler struct {
-	store  storage.KVStore
+	dbs    *storage.Registry
 	status FastDBStatus
+
+	// restoreMu 在恢复备份时独占持有，其他请求持有读锁
+	restoreMu sync.RWMutex
+
+	// 复制：从节点上follower从主节点拉取日志，主节点上replicas记录各从节点的进度，由replicasMu保护
+	follower   *replication.Follower
+	replicasMu sync.Mutex
+	replicas   map[string]map[string]*ReplicaProgress // 数据库名 -> 从节点ID -> 进度
+
+	// closing 在服务器开始关闭时取消，结束变更订阅等长连接请求
+	closing  context.Context
+	shutdown context.CancelFunc
 }
 
 type FastDBStatus int
@@ -24,8 +41,39 @@ const (
 )
 
 // NewHandler 创建一个新的Handler
-func NewHandler(store storage.KVStore) *Handler {
-	return &Handler{store: store, status: StatusStopped}
+func NewHandler(dbs *storage.Registry) *Handler {
+	h := &Handler{dbs: dbs, status: StatusStopped, replicas: make(map[string]map[string]*ReplicaProgress)}
+	h.closing, h.shutdown = context.WithCancel(context.Background())
+	return h
+}
+
+// Shutdown 结束所有长连接请求。http.Server.Shutdown只等待请求自行结束，
+// 需要通过RegisterOnShutdown在关闭服务器时调用，否则打开的订阅会让关闭一直等到超时
+func (h *Handler) Shutdown() {
+	h.shutdown()
+}
+
+// streamContext 返回在parent结束或服务器开始关闭时取消的上下文，用于长连接请求
+func (h *Handler) streamContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(h.closing, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// SetFollower 设置从节点的复制任务，复制状态接口从中读取各数据库的复制进度
+func (h *Handler) SetFollower(f *replication.Follower) {
+	h.follower = f
+}
+
+// db 返回本次请求操作的数据库：/db/:name 路由下为对应的命名数据库，否则为默认数据库
+func (h *Handler) db(c *gin.Context) *storage.DB {
+	if db, ok := c.Get(databaseContextKey); ok {
+		return db.(*storage.DB)
+	}
+	return h.dbs.Default()
 }
 
 // SetupRouter 配置路由
@@ -41,26 +89,94 @@ func (h *Handler) SetupRouter() *gin.Engine {
 	// 健康检查
 	r.GET("/health", h.healthCheck)
 
-	// API路由组
-	api := r.Group("/api/v1")
+	// API路由组，恢复备份期间暂停处理
+	api := r.Group("/api/v1", h.holdDuringRestore)
 	{
-		// 键值操作
-		api.GET("/kv/:key", h.getKey)
-		api.PUT("/kv/:key", h.setKey)
-		api.DELETE("/kv/:key", h.deleteKey)
-
-		// 列出键值对
-		api.GET("/kvs", h.listKeys)
+		// 默认数据库的键值操作
+		h.registerKVRoutes(api)
 
 		// 数据库连接
 		api.POST("/db/connect", h.connectDB)
 		api.GET("/db/status", h.dbStatus)
 		api.POST("/db/close", h.closeDB)
+		api.GET("/db/stats", h.dbStats)
+
+		// 命名数据库管理
+		api.GET("/dbs", h.listDatabases)
+		api.POST("/dbs", h.createDatabase)
+		api.DELETE("/dbs/:name", h.dropDatabase)
+
+		// 命名数据库的键值操作
+		named := api.Group("/db/:name", h.resolveDatabase)
+		h.registerKVRoutes(named)
+		named.GET("/stats", h.dbStats)
+
+		// 备份、合并与全文索引维护
+		api.POST("/admin/backup", h.backupDatabase)
+		api.GET("/admin/backups", h.listBackups)
+		api.POST("/admin/merge", h.mergeDatabase)
+		api.GET("/admin/merge", h.mergeStatus)
+		api.POST("/admin/search/rebuild", h.rebuildSearch)
+		api.GET("/admin/search", h.searchStats)
+
+		// 主从复制
+		api.GET("/replication/status", h.replicationStatus)
+		api.GET("/replication/snapshot", h.replicationSnapshot)
+	}
+
+	// 恢复备份需要等待其他请求结束，因此不经过holdDuringRestore
+	r.POST("/api/v1/admin/restore", h.restoreDatabase)
+
+	// 变更订阅和从节点拉取复制日志是长连接，同样不经过holdDuringRestore
+	watch := r.Group("/api/v1")
+	{
+		h.registerWatchRoutes(watch)
+		h.registerWatchRoutes(watch.Group("/db/:name", h.resolveDatabase))
+		watch.GET("/replication/log", h.replicationLog)
 	}
 
 	return r
 }
 
+// registerKVRoutes 注册键值操作相关的路由。二级索引由各节点自己维护，
+// 其余的写请求在从节点的只读副本上重定向到主节点
+func (h *Handler) registerKVRoutes(g *gin.RouterGroup) {
+	// 二级索引
+	h.registerIndexRoutes(g)
+
+	g = g.Group("", h.redirectReplicaWrites)
+
+	// 导入导出，静态路径优先于 /kv/:key 匹配
+	g.GET("/kv/export", h.exportData)
+	g.POST("/kv/import", h.importData)
+
+	// 键值操作
+	g.GET("/kv/:key", h.getKey)
+	g.PUT("/kv/:key", h.setKey)
+	g.PATCH("/kv/:key", h.patchKey)
+	g.DELETE("/kv/:key", h.deleteKey)
+	g.POST("/kv/:key/persist", h.persistKey)
+	g.POST("/kv/:key/cas", h.casKey)
+	g.POST("/kv/:key/incr", h.incrKey)
+	g.POST("/kv/:key/decr", h.decrKey)
+
+	// 版本历史
+	g.GET("/kv/:key/history", h.keyHistory)
+	g.POST("/kv/:key/rollback", h.rollbackKey)
+
+	// 列出键值对
+	g.GET("/kvs", h.listKeys)
+
+	// 批量写入
+	g.POST("/batch", h.batchWrite)
+
+	// 哈希、列表和集合
+	h.registerStructureRoutes(g)
+
+	// 全文检索
+	g.GET("/search", h.search)
+}
+
 // healthCheck 处理健康检查请求
 func (h *Handler) healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -91,20 +207,26 @@ func (h *Handler) getKey(c *gin.Context) {
 
 	requestID, _ := c.Get("requestID")
 
+	// 给出version时读取历史版本
+	if version, ok := c.GetQuery("version"); ok {
+		h.getKeyVersion(c, key, version)
+		return
+	}
+
 	logger.Debug("尝试获取键值",
 		zap.String("key", key),
 		zap.String("requestID", requestID.(string)),
 		zap.String("handler", "getKey"),
 	)
 
-	value, err := h.store.Get([]byte(key))
+	value, meta, err := h.db(c).GetWithMeta([]byte(key))
 	if err != nil {
 		logger.ErrorWithLocation("获取键值失败", err,
 			zap.String("key", key),
 			zap.String("requestID", requestID.(string)),
 			zap.String("handler", "getKey"),
 		)
-		if err.Error() == "leveldb: not found" {
+		if errors.Is(err, storage.ErrKeyNotFound) {
 			c.JSON(http.StatusNotFound, ErrorResponse{
 				Status:  "error",
 				Message: "Key not found",
@@ -120,16 +242,45 @@ func (h *Handler) getKey(c *gin.Context) {
 		return
 	}
 
+	// 客户端缓存的版本仍然有效时返回304
+	etag := makeETag(meta, value)
+	c.Header("ETag", etag)
+	if tags := splitETags(c.GetHeader("If-None-Match")); len(tags) > 0 && matchETag(tags, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	resp := KeyValueResponse{
+		Key:         key,
+		Value:       string(value),
+		KeyMetadata: newKeyMetadata(meta),
+	}
+	// 给出path时只返回JSON文档中的子文档
+	if path, ok := c.GetQuery("path"); ok {
+		sub, err := subDocument(value, path)
+		if err != nil {
+			code := storageErrorStatus(err)
+			c.JSON(code, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to read path: " + err.Error(),
+				Code:    code,
+			})
+			return
+		}
+		resp.Value = string(sub)
+		resp.Path = path
+	}
+	if expireAt, ok, err := h.db(c).TTL([]byte(key)); err == nil && ok {
+		resp.setExpireAt(expireAt)
+	}
+
 	logger.Info("成功获取键值",
 		zap.String("key", key),
 		zap.Int("valueSize", len(value)),
 		zap.String("requestID", requestID.(string)),
 		zap.String("handler", "getKey"),
 	)
-	c.JSON(http.StatusOK, KeyValueResponse{
-		Key:   key,
-		Value: string(value),
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
 // setKey 处理设置键值的请求
@@ -163,27 +314,53 @@ func (h *Handler) setKey(c *gin.Context) {
 		return
 	}
 
+	expireAt, err := req.expireAt(time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// 条件检查与写入在存储层的同一把写锁内完成
+	cond := parseConditions(c)
 	logger.Debug("设置键值", zap.String("key", key), zap.String("value", req.Value))
-	if err := h.store.Put([]byte(key), []byte(req.Value)); err != nil {
+	meta, err := h.db(c).Update([]byte(key), func(cur *storage.Entry) (*storage.Mutation, error) {
+		if err := cond.check(cur); err != nil {
+			return nil, err
+		}
+		return &storage.Mutation{Value: []byte(req.Value), ExpireAt: expireAt, RequestID: c.GetString("requestID")}, nil
+	})
+	if err != nil {
 		logger.Error("设置键值失败",
 			zap.String("key", key),
 			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
 			Status:  "error",
 			Message: "Failed to store value: " + err.Error(),
-			Code:    http.StatusInternalServerError,
+			Code:    code,
 		})
 		return
 	}
 
+	c.Header("ETag", makeETag(meta, []byte(req.Value)))
+	resp := KeyValueResponse{
+		Key:         key,
+		Value:       req.Value,
+		KeyMetadata: newKeyMetadata(meta),
+	}
+	if !expireAt.IsZero() {
+		resp.setExpireAt(expireAt)
+	}
+
 	logger.Info("成功设置键值", zap.String("key", key))
 	c.JSON(http.StatusOK, Response{
 		Status:  "success",
 		Message: "Value stored successfully",
-		Data: KeyValueResponse{
-			Key:   key,
-			Value: req.Value,
-		},
+		Data:    resp,
 	})
 }
 
@@ -205,93 +382,153 @@ func (h *Handler) deleteKey(c *gin.Context) {
 		return
 	}
 
-	// 先检查键是否存在
-	_, err := h.store.Get([]byte(key))
+	cond := parseConditions(c)
+	_, err := h.db(c).Update([]byte(key), func(cur *storage.Entry) (*storage.Mutation, error) {
+		if cur == nil {
+			return nil, storage.ErrKeyNotFound
+		}
+		if err := cond.check(cur); err != nil {
+			return nil, err
+		}
+		return &storage.Mutation{Delete: true, RequestID: c.GetString("requestID")}, nil
+	})
 	if err != nil {
 		logger.Error("删除键值失败",
 			zap.String("key", key),
 			zap.Error(err))
-		if err.Error() == "leveldb: not found" {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Status:  "error",
-				Message: "Key not found",
-				Code:    http.StatusNotFound,
-			})
-			return
+		code := storageErrorStatus(err)
+		message := "Failed to delete key: " + err.Error()
+		if code == http.StatusNotFound {
+			message = "Key not found"
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
+		c.JSON(code, ErrorResponse{
 			Status:  "error",
-			Message: "Internal server error",
-			Code:    http.StatusInternalServerError,
+			Message: message,
+			Code:    code,
 		})
 		return
 	}
 
-	if err := h.store.Delete([]byte(key)); err != nil {
-		logger.Error("删除键值失败",
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Key deleted successfully",
+		Data: gin.H{
+			"key": key,
+		},
+	})
+}
+
+// persistKey 处理清除键过期时间的请求
+func (h *Handler) persistKey(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	removed, err := h.db(c).Persist([]byte(key))
+	if err != nil {
+		logger.Error("清除过期时间失败",
 			zap.String("key", key),
 			zap.Error(err))
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: "Key not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Status:  "error",
-			Message: "Failed to delete key: " + err.Error(),
+			Message: "Failed to persist key: " + err.Error(),
 			Code:    http.StatusInternalServerError,
 		})
 		return
 	}
 
+	logger.Info("清除过期时间", zap.String("key", key), zap.Bool("removed", removed))
 	c.JSON(http.StatusOK, Response{
 		Status:  "success",
-		Message: "Key deleted successfully",
+		Message: "Key persisted successfully",
 		Data: gin.H{
-			"key": key,
+			"key":     key,
+			"removed": removed,
 		},
 	})
 }
 
-// listKeys 处理列出键值对的请求
+// listKeys 处理分页列出键值对的请求
 func (h *Handler) listKeys(c *gin.Context) {
 	h.checkFastDBStatus(c)
 	if h.status != StatusRunning {
 		return
 	}
 
-	// 列出键值对
-	items := h.store.GetListKeys()
-	result := make([]string, 0)
-	resultItems := make(map[string]string, len(items))
-
-	logger.Info("列出键值对", zap.Int("totalKeys", len(result)))
-	for _, v := range items {
-		result = append(result, string(v))
-	}
-	if len(result) == 0 {
-		c.JSON(http.StatusOK, ListResponse{
-			Total: 0,
-			Items: resultItems,
+	opts, limit, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
 		})
 		return
 	}
 
-	for _, v := range result {
-		value, err := h.store.Get([]byte(v))
-		if err != nil {
-			logger.Error("获取键值失败",
-				zap.String("key", v),
-				zap.Error(err))
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Status:  "error",
-				Message: "Failed to get value: " + err.Error(),
-				Code:    http.StatusInternalServerError,
-			})
-			return
+	// 多取一条用于判断是否还有下一页
+	items := make([]KeyValuePair, 0, limit)
+	hasMore := false
+	err = h.db(c).Scan(opts, func(key []byte, value []byte) bool {
+		if len(items) == limit {
+			hasMore = true
+			return false
 		}
-		resultItems[v] = string(value)
+		items = append(items, KeyValuePair{Key: string(key), Value: string(value)})
+		return true
+	})
+	if err != nil {
+		logger.Error("列出键值对失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to list keys: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
 	}
 
-	c.JSON(http.StatusOK, ListResponse{
-		Total: len(result),
-		Items: resultItems,
-	})
+	// 遍历结束后再补充元数据，避免在遍历回调中读取存储
+	keys := make([][]byte, len(items))
+	for i := range items {
+		keys[i] = []byte(items[i].Key)
+	}
+	metas, err := h.db(c).GetMetas(keys)
+	if err != nil {
+		logger.Error("获取键元数据失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get metadata: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	for i, meta := range metas {
+		items[i].KeyMetadata = newKeyMetadata(meta)
+	}
+
+	resp := ListResponse{
+		Count: len(items),
+		Items: items,
+	}
+	if hasMore {
+		resp.NextCursor = encodeCursor(items[len(items)-1].Key, opts.Reverse)
+	}
+
+	logger.Info("列出键值对",
+		zap.String("prefix", string(opts.Prefix)),
+		zap.Int("count", resp.Count),
+		zap.Bool("hasMore", hasMore),
+	)
+	c.JSON(http.StatusOK, resp)
 }
 
 // connectDB 处理数据库连接请求
@@ -407,7 +644,7 @@ func (h *Handler) dbStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, DBStatusResponse{
 		Status:  "success",
 		Message: "Database is connected",
-		details: Detail{
+		Details: Detail{
 			Host:     global.G_Config.Server.Host,
 			Port:     global.G_FastDB_Port,
 			Username: "admin",
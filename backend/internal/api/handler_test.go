@@ -0,0 +1,890 @@
+package api
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/replication"
+	"FastDB-Web/internal/storage"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fastdb-web-logs")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(dir, "error", false)
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRouter 创建基于内存存储、已处于连接状态的路由
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newTestHandler(t, newTestRegistry(t, config.ReplicationConfig{})).SetupRouter()
+}
+
+// newTestHandler 创建已处于连接状态的Handler
+func newTestHandler(t *testing.T, dbs *storage.Registry) *Handler {
+	t.Helper()
+	h := NewHandler(dbs)
+	h.status = StatusRunning
+	return h
+}
+
+// newTestRegistry 创建基于内存存储的数据库注册表
+func newTestRegistry(t *testing.T, repl config.ReplicationConfig) *storage.Registry {
+	t.Helper()
+	dbs, err := storage.NewRegistry(config.StorageConfig{
+		Type:            "memory",
+		Path:            t.TempDir(),
+		DefaultDatabase: "default",
+		MaxBatchOps:     10,
+		BackupDir:       t.TempDir(),
+		ReapInterval:    1,
+		ReapBatchSize:   100,
+		FullTextSearch:  true,
+		HistoryVersions: 5,
+		Replication:     repl,
+		SegmentSize:     64 * 1024 * 1024,
+		IndexType:       config.IndexTypeBTree,
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	t.Cleanup(func() { dbs.Close() })
+	return dbs
+}
+
+// do 发送请求并返回响应，body不为nil时按JSON编码
+func do(t *testing.T, r http.Handler, method, path string, body any, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d, body: %s", w.Code, want, w.Body.String())
+	}
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func TestNotConnected(t *testing.T) {
+	dbs, err := storage.NewRegistry(config.StorageConfig{
+		Type: "memory", Path: t.TempDir(), DefaultDatabase: "default",
+		BackupDir: t.TempDir(), MaxBatchOps: 10, ReapInterval: 1, ReapBatchSize: 1, SegmentSize: 1, IndexType: config.IndexTypeBTree,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+
+	w := do(t, NewHandler(dbs).SetupRouter(), http.MethodGet, "/api/v1/kv/a", nil)
+	expectStatus(t, w, http.StatusServiceUnavailable)
+}
+
+func TestKeyLifecycle(t *testing.T) {
+	r := newTestRouter(t)
+
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/greeting", nil), http.StatusNotFound)
+
+	w := do(t, r, http.MethodPut, "/api/v1/kv/greeting", KeyValueRequest{Value: "hello"})
+	expectStatus(t, w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("PUT response is missing ETag")
+	}
+
+	w = do(t, r, http.MethodGet, "/api/v1/kv/greeting", nil)
+	expectStatus(t, w, http.StatusOK)
+	got := decode[KeyValueResponse](t, w)
+	if got.Value != "hello" || got.KeyMetadata == nil || got.Version != 1 {
+		t.Fatalf("GET = %+v, want value hello at version 1", got)
+	}
+
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/greeting", nil, "If-None-Match", etag), http.StatusNotModified)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/greeting", KeyValueRequest{Value: "x"}, "If-Match", `"v99"`), http.StatusPreconditionFailed)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/kv/greeting", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/greeting", nil), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/kv/greeting", nil), http.StatusNotFound)
+}
+
+func TestConditionalWrites(t *testing.T) {
+	// 不保留历史版本时，删除后重新创建的键版本从1重新开始
+	dbs, err := storage.NewRegistry(config.StorageConfig{
+		Type: "memory", Path: t.TempDir(), DefaultDatabase: "default",
+		BackupDir: t.TempDir(), MaxBatchOps: 10, ReapInterval: 1, ReapBatchSize: 1, SegmentSize: 1, IndexType: config.IndexTypeBTree,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbs.Close()
+	r := newTestHandler(t, dbs).SetupRouter()
+
+	w := do(t, r, http.MethodPut, "/api/v1/kv/doc", KeyValueRequest{Value: "a"})
+	expectStatus(t, w, http.StatusOK)
+	old := w.Header().Get("ETag")
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/kv/doc", nil), http.StatusOK)
+	w = do(t, r, http.MethodPut, "/api/v1/kv/doc", KeyValueRequest{Value: "b"})
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("ETag") == old {
+		t.Fatalf("recreated key reuses ETag %s", old)
+	}
+	// 持有旧键ETag的客户端不能覆盖新键
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/doc", KeyValueRequest{Value: "c"}, "If-Match", old), http.StatusPreconditionFailed)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/doc", KeyValueRequest{Value: "c"}, "If-Match", w.Header().Get("ETag")), http.StatusOK)
+
+	// 比较并交换
+	expected := "c"
+	w = do(t, r, http.MethodPost, "/api/v1/kv/doc/cas", CASRequest{Expected: &expected, Value: "d"})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data CASResponse }](t, w).Data; !resp.Swapped || resp.Value != "d" || w.Header().Get("ETag") == "" {
+		t.Errorf("CAS = %+v", resp)
+	}
+	w = do(t, r, http.MethodPost, "/api/v1/kv/doc/cas", CASRequest{Expected: &expected, Value: "e"})
+	expectStatus(t, w, http.StatusPreconditionFailed)
+	if resp := decode[struct{ Data CASResponse }](t, w).Data; resp.Swapped || resp.Current == nil || *resp.Current != "d" {
+		t.Errorf("CAS mismatch = %+v", resp)
+	}
+	if resp := decode[KeyValueResponse](t, do(t, r, http.MethodGet, "/api/v1/kv/doc", nil)); resp.Value != "d" {
+		t.Errorf("value after CAS mismatch = %q", resp.Value)
+	}
+
+	// 键不存在时，expected不为null的交换不生效，为null时创建键
+	w = do(t, r, http.MethodPost, "/api/v1/kv/missing/cas", CASRequest{Expected: &expected, Value: "x"})
+	expectStatus(t, w, http.StatusPreconditionFailed)
+	if resp := decode[struct{ Data CASResponse }](t, w).Data; resp.Swapped || resp.Current != nil {
+		t.Errorf("CAS on missing key = %+v", resp)
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/missing/cas", CASRequest{Value: "x"}), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/missing/cas", CASRequest{Value: "y"}), http.StatusPreconditionFailed)
+}
+
+func TestSetKeyValidation(t *testing.T) {
+	r := newTestRouter(t)
+
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/a", map[string]string{}), http.StatusBadRequest)
+	ttl := int64(-1)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/a", KeyValueRequest{Value: "v", TTL: &ttl}), http.StatusBadRequest)
+}
+
+func TestListKeysPagination(t *testing.T) {
+	r := newTestRouter(t)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/"+k, KeyValueRequest{Value: k}), http.StatusOK)
+	}
+
+	var keys []string
+	path := "/api/v1/kvs?limit=2"
+	for {
+		w := do(t, r, http.MethodGet, path, nil)
+		expectStatus(t, w, http.StatusOK)
+		page := decode[ListResponse](t, w)
+		for _, item := range page.Items {
+			keys = append(keys, item.Key)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/api/v1/kvs?limit=2&cursor=" + page.NextCursor
+	}
+	if len(keys) != 5 || keys[0] != "a" || keys[4] != "e" {
+		t.Fatalf("paged keys = %q, want a..e", keys)
+	}
+}
+
+func TestBatchWrite(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := do(t, r, http.MethodPost, "/api/v1/batch", BatchRequest{Operations: []BatchOperation{
+		{Op: BatchOpPut, Key: "x", Value: "1"},
+		{Op: BatchOpPut, Key: "y", Value: "2"},
+		{Op: BatchOpDelete, Key: "x"},
+	}})
+	expectStatus(t, w, http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/x", nil), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/y", nil), http.StatusOK)
+
+	// 超过maxBatchOps时整个批次都不生效
+	ops := make([]BatchOperation, 11)
+	for i := range ops {
+		ops[i] = BatchOperation{Op: BatchOpPut, Key: "z", Value: "v"}
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/batch", BatchRequest{Operations: ops}), http.StatusRequestEntityTooLarge)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/z", nil), http.StatusNotFound)
+}
+
+func TestImportExport(t *testing.T) {
+	importItems := func(r http.Handler, query string, items []ExportItem) ImportResponse {
+		t.Helper()
+		w := do(t, r, http.MethodPost, "/api/v1/kv/import"+query, items)
+		expectStatus(t, w, http.StatusOK)
+		return decode[struct{ Data ImportResponse }](t, w).Data
+	}
+	exportItems := func(r http.Handler, query string) []ExportItem {
+		t.Helper()
+		w := do(t, r, http.MethodGet, "/api/v1/kv/export"+query, nil)
+		expectStatus(t, w, http.StatusOK)
+		return decode[[]ExportItem](t, w)
+	}
+	r := newTestRouter(t)
+
+	// skip跳过已存在的键，只导入带有前缀的记录，单个记录失败不影响其他记录
+	importItems(r, "", []ExportItem{{Key: "user:1", Value: json.RawMessage(`"old"`)}})
+	resp := importItems(r, "?prefix=user:&policy=skip", []ExportItem{
+		{Key: "user:1", Value: json.RawMessage(`"new"`)},
+		{Key: "user:2", Value: json.RawMessage(`{"n": 1}`)},
+		{Key: "other", Value: json.RawMessage(`"x"`)},
+		{Key: "!!", Value: json.RawMessage(`"eA=="`), Encoding: ExportEncodingBase64},
+	})
+	if resp.Total != 3 || resp.Imported != 1 || resp.Skipped != 1 || resp.Failed != 1 {
+		t.Errorf("skip import = %+v", resp)
+	}
+	items := exportItems(r, "")
+	if len(items) != 2 || string(items[0].Value) != `"old"` || string(items[1].Value) != `"{\"n\":1}"` {
+		t.Errorf("after skip import: %+v", items)
+	}
+
+	// overwrite覆盖已存在的键
+	resp = importItems(r, "", []ExportItem{
+		{Key: "user:1", Value: json.RawMessage(`"new"`)},
+		{Key: "", Value: json.RawMessage(`"x"`)},
+	})
+	if resp.Total != 2 || resp.Imported != 1 || resp.Failed != 1 || resp.Results[1].Error != "Key is required" {
+		t.Errorf("overwrite import = %+v", resp)
+	}
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/import?policy=merge", []ExportItem{}), http.StatusBadRequest)
+
+	// 导出按前缀过滤
+	importItems(r, "", []ExportItem{{Key: "other", Value: json.RawMessage(`"x"`)}})
+	if items := exportItems(r, "?prefix=user:"); len(items) != 2 || items[0].Key != "user:1" ||
+		string(items[0].Value) != `"new"` || items[1].Key != "user:2" {
+		t.Errorf("export with prefix = %+v", items)
+	}
+
+	// 超过一批的二进制键，导出再导入后保持不变
+	binary := make([]ExportItem, 600)
+	for i := range binary {
+		value, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte{0xfe, byte(i)}))
+		binary[i] = ExportItem{
+			Key:      base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("\xff%04d", i))),
+			Value:    value,
+			Encoding: ExportEncodingBase64,
+		}
+	}
+	if resp := importItems(r, "", binary); resp.Imported != len(binary) {
+		t.Fatalf("binary import = %+v", resp)
+	}
+	w := do(t, r, http.MethodGet, "/api/v1/kv/export", nil)
+	expectStatus(t, w, http.StatusOK)
+	exported := w.Body.String()
+	items = decode[[]ExportItem](t, w)
+	if len(items) != len(binary)+3 {
+		t.Fatalf("exported %d items, want %d", len(items), len(binary)+3)
+	}
+	for i, item := range items[3:] {
+		if item.Key != binary[i].Key || string(item.Value) != string(binary[i].Value) || item.Encoding != ExportEncodingBase64 {
+			t.Fatalf("binary item %d = %+v, want %+v", i, item, binary[i])
+		}
+	}
+
+	restored := newTestRouter(t)
+	if resp := importItems(restored, "", items); resp.Imported != len(items) || resp.Failed != 0 {
+		t.Errorf("round trip import = %+v", resp)
+	}
+	w = do(t, restored, http.MethodGet, "/api/v1/kv/export", nil)
+	if w.Body.String() != exported {
+		t.Error("export after round trip differs from the original export")
+	}
+}
+
+func TestCounters(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := do(t, r, http.MethodPost, "/api/v1/kv/visits/incr", nil)
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[struct{ Data IncrResponse }](t, w)
+	if resp.Data.Value != "1" {
+		t.Fatalf("incr without body = %s, want 1", resp.Data.Value)
+	}
+
+	w = do(t, r, http.MethodPost, "/api/v1/kv/visits/incr", IncrRequest{Delta: "41"})
+	expectStatus(t, w, http.StatusOK)
+	if resp = decode[struct{ Data IncrResponse }](t, w); resp.Data.Value != "42" {
+		t.Fatalf("incr by 41 = %s, want 42", resp.Data.Value)
+	}
+
+	w = do(t, r, http.MethodPost, "/api/v1/kv/visits/decr", IncrRequest{Delta: "2"})
+	expectStatus(t, w, http.StatusOK)
+	if resp = decode[struct{ Data IncrResponse }](t, w); resp.Data.Value != "40" {
+		t.Fatalf("decr by 2 = %s, want 40", resp.Data.Value)
+	}
+
+	w = do(t, r, http.MethodPost, "/api/v1/kv/visits/incr", IncrRequest{Delta: "0.25", Mode: CounterModeFloat})
+	expectStatus(t, w, http.StatusOK)
+	if resp = decode[struct{ Data IncrResponse }](t, w); resp.Data.Value != "40.25" {
+		t.Fatalf("incr by 0.25 = %s, want 40.25", resp.Data.Value)
+	}
+
+	// 整数模式下不能使用小数
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/visits/incr", IncrRequest{Delta: "1.5"}), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/visits/incr", IncrRequest{Mode: "hex"}), http.StatusBadRequest)
+
+	do(t, r, http.MethodPut, "/api/v1/kv/name", KeyValueRequest{Value: "fastdb"})
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/name/incr", nil), http.StatusConflict)
+}
+
+func TestPatch(t *testing.T) {
+	r := newTestRouter(t)
+	ttl := int64(3600)
+	do(t, r, http.MethodPut, "/api/v1/kv/user", KeyValueRequest{Value: `{"name":"ann","tags":["a"],"address":{"city":"x"}}`, TTL: &ttl})
+
+	w := do(t, r, http.MethodPatch, "/api/v1/kv/user",
+		json.RawMessage(`[{"op":"test","path":"/name","value":"ann"},{"op":"add","path":"/tags/-","value":"b"}]`),
+		"Content-Type", ContentTypeJSONPatch)
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[struct{ Data KeyValueResponse }](t, w)
+	if resp.Data.Value != `{"address":{"city":"x"},"name":"ann","tags":["a","b"]}` {
+		t.Fatalf("JSON Patch result = %s", resp.Data.Value)
+	}
+	if resp.Data.TTL == nil {
+		t.Fatal("PATCH dropped the TTL")
+	}
+
+	w = do(t, r, http.MethodPatch, "/api/v1/kv/user",
+		json.RawMessage(`{"address":{"city":null,"zip":"100"},"tags":null}`),
+		"Content-Type", ContentTypeMergePatch+"; charset=utf-8")
+	expectStatus(t, w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+
+	w = do(t, r, http.MethodGet, "/api/v1/kv/user?path=/address", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[KeyValueResponse](t, w); resp.Value != `{"zip":"100"}` || resp.Path != "/address" {
+		t.Fatalf("GET ?path=/address = %+v", resp)
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/user?path=/tags", nil), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/user?path=name", nil), http.StatusBadRequest)
+
+	// test失败时整个补丁都不生效
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/user",
+		json.RawMessage(`[{"op":"remove","path":"/name"},{"op":"test","path":"/name","value":"bob"}]`),
+		"Content-Type", ContentTypeJSONPatch), http.StatusConflict)
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/user",
+		json.RawMessage(`{"name":"bob"}`),
+		"Content-Type", ContentTypeMergePatch, "If-Match", `"stale"`), http.StatusPreconditionFailed)
+	w = do(t, r, http.MethodGet, "/api/v1/kv/user?path=/name", nil)
+	if resp := decode[KeyValueResponse](t, w); resp.Value != `"ann"` || w.Header().Get("ETag") != etag {
+		t.Fatalf("failed patches changed the value: %+v", resp)
+	}
+
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/user", json.RawMessage(`{"op":"add"}`), "Content-Type", ContentTypeJSONPatch), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/user", json.RawMessage(`{}`)), http.StatusUnsupportedMediaType)
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/missing", json.RawMessage(`{}`), "Content-Type", ContentTypeMergePatch), http.StatusNotFound)
+
+	do(t, r, http.MethodPut, "/api/v1/kv/plain", KeyValueRequest{Value: "hello"})
+	expectStatus(t, do(t, r, http.MethodPatch, "/api/v1/kv/plain", json.RawMessage(`{}`), "Content-Type", ContentTypeMergePatch), http.StatusConflict)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/plain?path=/a", nil), http.StatusConflict)
+}
+
+func TestIndexes(t *testing.T) {
+	r := newTestRouter(t)
+	for i, status := range []string{"active", "inactive", "active", "active"} {
+		do(t, r, http.MethodPut, fmt.Sprintf("/api/v1/kv/user:%d", i), KeyValueRequest{Value: fmt.Sprintf(`{"status":%q}`, status)})
+	}
+
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/indexes", CreateIndexRequest{Name: "status", Prefix: "user:", Path: "status"}), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/indexes", CreateIndexRequest{Name: "status", Prefix: "user:", Path: "/status"}), http.StatusAccepted)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/indexes", CreateIndexRequest{Name: "status", Path: "/status"}), http.StatusConflict)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := do(t, r, http.MethodGet, "/api/v1/indexes/status", nil)
+		expectStatus(t, w, http.StatusOK)
+		if decode[struct{ Data storage.IndexInfo }](t, w).Data.State == storage.IndexStateReady {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("index did not become ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var keys []string
+	path := "/api/v1/query?index=status&eq=active&limit=2"
+	for {
+		w := do(t, r, http.MethodGet, path, nil)
+		expectStatus(t, w, http.StatusOK)
+		page := decode[QueryResponse](t, w)
+		for _, item := range page.Items {
+			keys = append(keys, item.Key)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/api/v1/query?index=status&eq=active&limit=2&cursor=" + page.NextCursor
+	}
+	if len(keys) != 3 || keys[0] != "user:0" || keys[2] != "user:3" {
+		t.Fatalf("status = active returned %v", keys)
+	}
+
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/query?eq=active", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/query?index=status&eq=a&gte=a", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/query?index=missing&eq=a", nil), http.StatusNotFound)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/indexes/status", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/query?index=status&eq=active", nil), http.StatusNotFound)
+	w := do(t, r, http.MethodGet, "/api/v1/indexes", nil)
+	if infos := decode[struct{ Data []storage.IndexInfo }](t, w).Data; len(infos) != 0 {
+		t.Fatalf("indexes after drop = %+v", infos)
+	}
+}
+
+func TestStructures(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := do(t, r, http.MethodPut, "/api/v1/hash/user", HashSetRequest{Fields: map[string]string{"name": "ann", "age": "30"}})
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data CountResponse }](t, w); resp.Data.Count != 2 {
+		t.Fatalf("HSET added = %d, want 2", resp.Data.Count)
+	}
+	w = do(t, r, http.MethodGet, "/api/v1/hash/user/name", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data HashFieldResponse }](t, w); resp.Data.Value != "ann" {
+		t.Fatalf("HGET = %q, want ann", resp.Data.Value)
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/hash/user/missing", nil), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/hash/user", HashSetRequest{}), http.StatusBadRequest)
+
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/list/jobs/rpush", ListPushRequest{Values: []string{"a", "b", "c"}}), http.StatusOK)
+	w = do(t, r, http.MethodGet, "/api/v1/list/jobs?start=1", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data ListValuesResponse }](t, w); len(resp.Data.Values) != 2 || resp.Data.Length != 3 {
+		t.Fatalf("LRANGE = %+v, want 2 values of 3", resp.Data)
+	}
+	w = do(t, r, http.MethodPost, "/api/v1/list/jobs/lpop", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data ListValuesResponse }](t, w); len(resp.Data.Values) != 1 || resp.Data.Values[0] != "a" {
+		t.Fatalf("LPOP = %+v, want [a]", resp.Data)
+	}
+
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/set/tags", SetAddRequest{Members: []string{"go", "db"}}), http.StatusOK)
+	w = do(t, r, http.MethodGet, "/api/v1/set/tags/go", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[struct{ Data SetMemberResponse }](t, w); !resp.Data.IsMember {
+		t.Fatal("SISMEMBER go = false")
+	}
+
+	// 对已有的集合使用列表操作
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/list/tags/rpush", ListPushRequest{Values: []string{"x"}}), http.StatusConflict)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/set/tags", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/set/tags", nil), http.StatusNotFound)
+}
+
+func TestSortedSets(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := do(t, r, http.MethodPost, "/api/v1/zset/board", ZAddRequest{Members: []ZSetMember{
+		{Member: "ann", Score: 10}, {Member: "bob", Score: 5}, {Member: "cat", Score: 7},
+	}})
+	expectStatus(t, w, http.StatusOK)
+
+	w = do(t, r, http.MethodGet, "/api/v1/zset/board?reverse=true&stop=1", nil)
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[struct{ Data ZSetRangeResponse }](t, w)
+	if len(resp.Data.Members) != 2 || resp.Data.Members[0].Member != "ann" || resp.Data.Count != 3 {
+		t.Fatalf("ZRANGE = %+v", resp.Data)
+	}
+
+	w = do(t, r, http.MethodGet, "/api/v1/zset/board?min=(5&max=%2Binf&limit=1", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp = decode[struct{ Data ZSetRangeResponse }](t, w); len(resp.Data.Members) != 1 || resp.Data.Members[0].Member != "cat" {
+		t.Fatalf("ZRANGEBYSCORE = %+v, want [cat]", resp.Data)
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/zset/board?min=abc", nil), http.StatusBadRequest)
+
+	delta := 10.0
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/zset/board/bob/incr", ZIncrByRequest{Delta: &delta}), http.StatusOK)
+	w = do(t, r, http.MethodGet, "/api/v1/zset/board/bob", nil)
+	expectStatus(t, w, http.StatusOK)
+	if member := decode[struct{ Data ZSetMemberResponse }](t, w); member.Data.Score != 15 || member.Data.Rank != 2 {
+		t.Fatalf("ZSCORE/ZRANK = %+v, want score 15 rank 2", member.Data)
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/zset/board/zed", nil), http.StatusNotFound)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/zset/board/bob", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/zset/board/bob", nil), http.StatusNotFound)
+}
+
+func TestNamedDatabases(t *testing.T) {
+	r := newTestRouter(t)
+
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/db/orders/kv/a", KeyValueRequest{Value: "v"}), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/dbs", CreateDatabaseRequest{Name: "orders"}), http.StatusCreated)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/dbs", CreateDatabaseRequest{Name: "orders"}), http.StatusConflict)
+
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/db/orders/kv/a", KeyValueRequest{Value: "v"}), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/db/orders/kv/a", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/a", nil), http.StatusNotFound)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/dbs/default", nil), http.StatusConflict)
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/dbs/orders", nil), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/db/orders/kv/a", nil), http.StatusNotFound)
+}
+
+func TestDBStats(t *testing.T) {
+	r := newTestRouter(t)
+	ttl := int64(60)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/a", KeyValueRequest{Value: "1"}), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/b", KeyValueRequest{Value: "2", TTL: &ttl}), http.StatusOK)
+
+	w := do(t, r, http.MethodGet, "/api/v1/db/stats", nil)
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[struct {
+		Data StatsResponse `json:"data"`
+	}](t, w)
+	if resp.Data.Database != "default" || resp.Data.Keys != 2 || resp.Data.ExpiringKeys != 1 {
+		t.Fatalf("stats = %+v, want 2 keys with 1 expiring", resp.Data)
+	}
+	if resp.Data.Store == nil || resp.Data.Store.Engine != "memory" {
+		t.Fatalf("store stats = %+v, want the memory engine", resp.Data.Store)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	r := newTestRouter(t)
+
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/article:1", KeyValueRequest{Value: "<b>FastDB</b> 支持全文检索"}), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/article:2", KeyValueRequest{Value: "检索 is search"}), http.StatusOK)
+	expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/fastdb", KeyValueRequest{Value: "readme"}), http.StatusOK)
+
+	w := do(t, r, http.MethodGet, "/api/v1/search?q=fastdb", nil)
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[SearchResponse](t, w)
+	if resp.Total != 2 || len(resp.Hits) != 2 || resp.Hits[0].Key != "fastdb" || resp.Hits[0].KeyHighlight != "<mark>fastdb</mark>" {
+		t.Fatalf("search fastdb = %+v", resp)
+	}
+	if got := resp.Hits[1].ValueHighlight; got != "&lt;b&gt;<mark>FastDB</mark>&lt;/b&gt; 支持全文检索" {
+		t.Fatalf("value highlight = %q", got)
+	}
+
+	w = do(t, r, http.MethodGet, "/api/v1/search?q=检索&offset=1&limit=1", nil)
+	expectStatus(t, w, http.StatusOK)
+	resp = decode[SearchResponse](t, w)
+	if resp.Total != 2 || resp.Count != 1 || resp.Offset != 1 || len(resp.Terms) != 1 || resp.Terms[0] != "检索" {
+		t.Fatalf("search 检索 page 2 = %+v", resp)
+	}
+
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/search?q=", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/search?q=fastdb&limit=0", nil), http.StatusBadRequest)
+
+	w = do(t, r, http.MethodPost, "/api/v1/admin/search/rebuild", nil)
+	expectStatus(t, w, http.StatusAccepted)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w = do(t, r, http.MethodGet, "/api/v1/admin/search", nil)
+		expectStatus(t, w, http.StatusOK)
+		stats := decode[struct {
+			Data SearchStatsResponse `json:"data"`
+		}](t, w).Data
+		if stats.State == storage.SearchStateReady {
+			if !stats.Enabled || stats.Docs != 3 || stats.Database != "default" {
+				t.Fatalf("search stats = %+v", stats)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("full-text index did not become ready: %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	resp = decode[SearchResponse](t, do(t, r, http.MethodGet, "/api/v1/search?q=search", nil))
+	if resp.Total != 1 || resp.Hits[0].Key != "article:2" {
+		t.Fatalf("search after rebuild = %+v", resp)
+	}
+
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/admin/search/rebuild", RebuildSearchRequest{Database: "missing"}), http.StatusNotFound)
+}
+
+// readSSE 读取下一个SSE事件，跳过心跳注释
+func readSSE(t *testing.T, r *bufio.Reader) (event string, data WatchEvent) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read SSE: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data); err != nil {
+				t.Fatalf("decode SSE data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t))
+	defer srv.Close()
+	put := func(key string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/v1/kv/"+key, strings.NewReader(`{"value":"v"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/watch?prefix=user:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("watch response = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+	event, ready := readSSE(t, r)
+	if event != WatchTypeReady || ready.Token == "" {
+		t.Fatalf("first SSE event = %s %+v", event, ready)
+	}
+
+	put("order:1")
+	put("user:1")
+	event, change := readSSE(t, r)
+	if event != WatchTypeChange || change.Key != "user:1" || change.Op != storage.ChangeOpPut || change.Version != 1 || change.Seq != 2 {
+		t.Fatalf("change SSE event = %s %+v", event, change)
+	}
+
+	// WebSocket从SSE的ready令牌之后继续，补齐之前的事件
+	ws, err := websocket.Dial(strings.Replace(srv.URL, "http", "ws", 1)+"/api/v1/watch/ws?after="+ready.Token, "", srv.URL)
+	if err != nil {
+		t.Fatalf("websocket dial: %v", err)
+	}
+	defer ws.Close()
+	var msgs []WatchEvent
+	for i := 0; i < 3; i++ {
+		var msg WatchEvent
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("websocket receive: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if msgs[0].Type != WatchTypeReady || msgs[1].Key != "order:1" || msgs[2].Key != "user:1" || msgs[2].Token != change.Token {
+		t.Fatalf("websocket messages = %+v", msgs)
+	}
+
+	expectStatus(t, do(t, newTestRouter(t), http.MethodGet, "/api/v1/watch?after=bad", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, newTestRouter(t), http.MethodGet, "/api/v1/watch?after="+ready.Token, nil), http.StatusGone)
+	expectStatus(t, do(t, newTestRouter(t), http.MethodGet, "/api/v1/db/missing/watch", nil), http.StatusNotFound)
+}
+
+func TestWatchEndsOnShutdown(t *testing.T) {
+	h := newTestHandler(t, newTestRegistry(t, config.ReplicationConfig{}))
+	srv := httptest.NewServer(h.SetupRouter())
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(h.Shutdown)
+
+	resp, err := http.Get(srv.URL + "/api/v1/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if event, _ := readSSE(t, bufio.NewReader(resp.Body)); event != WatchTypeReady {
+		t.Fatalf("first SSE event = %s", event)
+	}
+
+	// 打开的订阅不会让关闭服务器等到超时
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with an open watch: %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, v := range []string{"one", "two", "three"} {
+		expectStatus(t, do(t, r, http.MethodPut, "/api/v1/kv/doc", KeyValueRequest{Value: v}), http.StatusOK)
+	}
+
+	w := do(t, r, http.MethodGet, "/api/v1/kv/doc/history", nil)
+	expectStatus(t, w, http.StatusOK)
+	history := decode[struct {
+		Data HistoryResponse `json:"data"`
+	}](t, w).Data
+	if len(history.Versions) != 3 || history.Versions[0].Version != 3 || !history.Versions[0].Current || history.Versions[1].Current || history.Versions[0].RequestID == "" {
+		t.Fatalf("history = %+v", history)
+	}
+
+	w = do(t, r, http.MethodGet, "/api/v1/kv/doc?version=1", nil)
+	expectStatus(t, w, http.StatusOK)
+	if resp := decode[KeyValueResponse](t, w); resp.Value != "one" || resp.Version != 1 {
+		t.Fatalf("version 1 = %+v", resp)
+	}
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/doc?version=9", nil), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/doc?version=x", nil), http.StatusBadRequest)
+
+	expectStatus(t, do(t, r, http.MethodDelete, "/api/v1/kv/doc", nil), http.StatusOK)
+	w = do(t, r, http.MethodPost, "/api/v1/kv/doc/rollback", RollbackRequest{Version: 2})
+	expectStatus(t, w, http.StatusOK)
+	resp := decode[struct {
+		Data KeyValueResponse `json:"data"`
+	}](t, w).Data
+	if resp.Value != "two" || resp.Version != 4 {
+		t.Fatalf("rollback = %+v", resp)
+	}
+	if got := decode[KeyValueResponse](t, do(t, r, http.MethodGet, "/api/v1/kv/doc", nil)); got.Value != "two" {
+		t.Fatalf("value after rollback = %q", got.Value)
+	}
+
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/doc/rollback", RollbackRequest{Version: 9}), http.StatusNotFound)
+	expectStatus(t, do(t, r, http.MethodPost, "/api/v1/kv/doc/rollback", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/kv/missing/history", nil), http.StatusNotFound)
+}
+
+func TestReplication(t *testing.T) {
+	// 主节点刚启动、还没有在管理界面上连接时，从节点也要能拉取快照和日志
+	leaders := newTestRegistry(t, config.ReplicationConfig{
+		Role: config.ReplicationRoleLeader, LogSize: 100,
+	})
+	lh := NewHandler(leaders)
+	leader := httptest.NewServer(lh.SetupRouter())
+	defer leader.Close()
+	if err := leaders.Default().Put([]byte("before"), []byte("1")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	followers := newTestRegistry(t, config.ReplicationConfig{
+		Role: config.ReplicationRoleFollower, LeaderURL: leader.URL, PollTimeout: 1,
+	})
+	f := replication.NewFollower(followers, followers.Replication(), "follower-1")
+	h := newTestHandler(t, followers)
+	h.SetFollower(f)
+	r := h.SetupRouter()
+	f.Start()
+	defer f.Stop()
+
+	// 从节点先加载快照得到已有的数据，之后的写入通过日志复制过来
+	waitValue := func(key, want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			w := do(t, r, http.MethodGet, "/api/v1/kv/"+key, nil)
+			if w.Code == http.StatusOK && decode[KeyValueResponse](t, w).Value == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("follower GET %s = %d %s, want %q", key, w.Code, w.Body.String(), want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitValue("before", "1")
+	if err := leaders.Default().Put([]byte("after"), []byte("2")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	waitValue("after", "2")
+
+	// 从节点拒绝写入并指向主节点
+	w := do(t, r, http.MethodPut, "/api/v1/kv/after", KeyValueRequest{Value: "3"})
+	expectStatus(t, w, http.StatusTemporaryRedirect)
+	if loc := w.Header().Get("Location"); loc != leader.URL+"/api/v1/kv/after" {
+		t.Fatalf("Location = %q", loc)
+	}
+
+	// 状态在应用日志之后才更新
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := decode[struct{ Data ReplicationStatusResponse }](t, do(t, r, http.MethodGet, "/api/v1/replication/status", nil)).Data
+		if status.Role == config.ReplicationRoleFollower && len(status.Follower) == 1 &&
+			status.Follower[0].AppliedSeq == 2 && status.Follower[0].Snapshots == 1 && status.Follower[0].Lag == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower status = %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// 查看复制状态仍然需要先在管理界面上连接
+	expectStatus(t, do(t, leader.Config.Handler, http.MethodGet, "/api/v1/replication/status", nil), http.StatusServiceUnavailable)
+	lh.status = StatusRunning
+	status := decode[struct{ Data ReplicationStatusResponse }](t, do(t, leader.Config.Handler, http.MethodGet, "/api/v1/replication/status", nil)).Data
+	if status.Role != config.ReplicationRoleLeader || len(status.Leader) != 1 || status.Leader[0].LastSeq != 2 ||
+		len(status.Leader[0].Followers) != 1 || status.Leader[0].Followers[0].ID != "follower-1" {
+		t.Fatalf("leader status = %+v", status)
+	}
+
+	expectStatus(t, do(t, leader.Config.Handler, http.MethodGet, "/api/v1/replication/log?epoch=stale", nil), http.StatusGone)
+	expectStatus(t, do(t, r, http.MethodGet, "/api/v1/replication/log", nil), http.StatusNotImplemented)
+}
+
+func TestReplicationLogEndsOnShutdown(t *testing.T) {
+	h := NewHandler(newTestRegistry(t, config.ReplicationConfig{
+		Role: config.ReplicationRoleLeader, LogSize: 100,
+	}))
+	r := h.SetupRouter()
+
+	// 没有新日志时长轮询在服务器开始关闭后立即返回，不会拖住Shutdown
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- do(t, r, http.MethodGet, "/api/v1/replication/log?after=0&wait=30", nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	h.Shutdown()
+	select {
+	case w := <-done:
+		expectStatus(t, w, http.StatusOK)
+		if batch := decode[struct{ Data storage.LogBatch }](t, w).Data; len(batch.Entries) != 0 {
+			t.Fatalf("log batch = %+v", batch)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("replication long-poll did not end on shutdown")
+	}
+}
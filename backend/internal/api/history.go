@@ -0,0 +1,157 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// keyHistory 处理列出键的历史版本的请求，键被删除后仍会返回保留下来的历史
+func (h *Handler) keyHistory(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	versions, err := h.db(c).History([]byte(key))
+	if err == nil && len(versions) == 0 {
+		err = storage.ErrKeyNotFound
+	}
+	var metas []*storage.KeyMeta
+	if err == nil {
+		metas, err = h.db(c).GetMetas([][]byte{[]byte(key)})
+	}
+	if err != nil {
+		logger.Error("获取版本历史失败",
+			zap.String("key", key),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get history: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	resp := HistoryResponse{Key: key, Versions: make([]VersionInfo, len(versions))}
+	for i, v := range versions {
+		resp.Versions[i] = VersionInfo{
+			KeyMetadata: *newKeyMetadata(&v.KeyMeta),
+			RequestID:   v.RequestID,
+			Current:     metas[0] != nil && metas[0].Version == v.Version,
+		}
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   resp,
+	})
+}
+
+// getKeyVersion 处理带version参数的读取请求，返回键的某个历史版本，同样支持path参数
+func (h *Handler) getKeyVersion(c *gin.Context, key, version string) {
+	n, err := strconv.ParseUint(version, 10, 64)
+	if err != nil || n == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: version must be a positive integer",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	v, err := h.db(c).GetVersion([]byte(key), n)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get version: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	resp := KeyValueResponse{
+		Key:         key,
+		Value:       string(v.Value),
+		KeyMetadata: newKeyMetadata(&v.KeyMeta),
+	}
+	if path, ok := c.GetQuery("path"); ok {
+		sub, err := subDocument(v.Value, path)
+		if err != nil {
+			code := storageErrorStatus(err)
+			c.JSON(code, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to read path: " + err.Error(),
+				Code:    code,
+			})
+			return
+		}
+		resp.Value = string(sub)
+		resp.Path = path
+	}
+	c.Header("ETag", makeETag(&v.KeyMeta, v.Value))
+	c.JSON(http.StatusOK, resp)
+}
+
+// rollbackKey 处理把键恢复为某个历史版本的请求，恢复本身产生一个新的版本
+func (h *Handler) rollbackKey(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var req RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败",
+			zap.String("key", key),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	meta, value, err := h.db(c).Rollback([]byte(key), req.Version, c.GetString("requestID"))
+	if err != nil {
+		logger.Error("回滚键失败",
+			zap.String("key", key),
+			zap.Uint64("version", req.Version),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to roll back: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.Header("ETag", makeETag(meta, value))
+	resp := KeyValueResponse{
+		Key:         key,
+		Value:       string(value),
+		KeyMetadata: newKeyMetadata(meta),
+	}
+	if expireAt, ok, err := h.db(c).TTL([]byte(key)); err == nil && ok {
+		resp.setExpireAt(expireAt)
+	}
+
+	logger.Info("成功回滚键",
+		zap.String("key", key),
+		zap.Uint64("version", req.Version),
+		zap.Uint64("newVersion", meta.Version))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Value rolled back successfully",
+		Data:    resp,
+	})
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// ImportPolicyOverwrite 导入时覆盖已存在的键
+	ImportPolicyOverwrite = "overwrite"
+	// ImportPolicySkip 导入时跳过已存在的键
+	ImportPolicySkip = "skip"
+	// ExportEncodingBase64 表示记录的键和值以base64编码
+	ExportEncodingBase64 = "base64"
+)
+
+// exportChunkSize 是导出时每次在读锁内读取的键值对数，写出响应时不持有锁，
+// 下载慢的客户端不会阻塞写入
+const exportChunkSize = 256
+
+// exportData 处理导出数据的请求，分批遍历前缀下的键值对并流式输出
+func (h *Handler) exportData(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	prefix := c.Query("prefix")
+	requestID, _ := c.Get("requestID")
+
+	filename := "fastdb-export-" + time.Now().Format("2006-01-02") + ".json"
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// 先写出数组开头，之后每读取一批就写出这一批记录
+	w := c.Writer
+	w.WriteString("[")
+	db := h.db(c)
+	opts := storage.ScanOptions{Prefix: []byte(prefix)}
+	count := 0
+	var last []byte
+	var err error
+	for {
+		chunk := make([]ExportItem, 0, exportChunkSize)
+		err = db.Scan(opts, func(key []byte, value []byte) bool {
+			chunk = append(chunk, newExportItem(key, value))
+			last = append(last[:0], key...)
+			return len(chunk) < exportChunkSize
+		})
+		if err != nil {
+			break
+		}
+		for _, item := range chunk {
+			var data []byte
+			if data, err = json.Marshal(item); err != nil {
+				break
+			}
+			if count > 0 {
+				w.WriteString(",")
+			}
+			if _, err = w.Write(data); err != nil {
+				break
+			}
+			count++
+		}
+		if err != nil || len(chunk) < exportChunkSize {
+			break
+		}
+		w.Flush()
+		// 下一批从这一批最后一个键之后继续，导出记录中的键可能是base64编码，
+		// 这里使用原始的键
+		opts.Start = append(bytes.Clone(last), 0)
+	}
+	w.WriteString("]")
+	w.Flush()
+
+	if err != nil {
+		// 响应头已经发出，这里只能记录错误
+		logger.ErrorWithLocation("导出数据失败", err,
+			zap.String("prefix", prefix),
+			zap.Int("exported", count),
+			zap.String("requestID", requestID.(string)),
+			zap.String("handler", "exportData"),
+		)
+		return
+	}
+
+	logger.Info("成功导出数据",
+		zap.String("prefix", prefix),
+		zap.Int("exported", count),
+		zap.String("requestID", requestID.(string)),
+		zap.String("handler", "exportData"),
+	)
+}
+
+// importData 处理导入数据的请求，请求体与导出的JSON文档格式相同
+func (h *Handler) importData(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	prefix := c.Query("prefix")
+	policy := c.DefaultQuery("policy", ImportPolicyOverwrite)
+	if policy != ImportPolicyOverwrite && policy != ImportPolicySkip {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid policy: " + policy,
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var items []ExportItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		logger.Error("解析导入数据失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	db := h.db(c)
+	resp := ImportResponse{Results: make([]ImportResult, 0, len(items))}
+	for _, item := range items {
+		key, value, decodeErr := decodeImportItem(item)
+		if decodeErr == nil && !bytes.HasPrefix(key, []byte(prefix)) {
+			continue
+		}
+		resp.Total++
+
+		result := ImportResult{Key: item.Key}
+		switch {
+		case decodeErr != nil:
+			result.Status = "failed"
+			result.Error = decodeErr.Error()
+		case len(key) == 0:
+			result.Status = "failed"
+			result.Error = "Key is required"
+		default:
+			imported, err := importValue(db, key, value, policy == ImportPolicySkip, c.GetString("requestID"))
+			switch {
+			case err != nil:
+				logger.Error("导入键值失败",
+					zap.String("key", item.Key),
+					zap.Error(err))
+				result.Status = "failed"
+				result.Error = err.Error()
+			case imported:
+				result.Status = "imported"
+			default:
+				result.Status = "skipped"
+			}
+		}
+
+		switch result.Status {
+		case "imported":
+			resp.Imported++
+		case "skipped":
+			resp.Skipped++
+		default:
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	logger.Info("导入数据完成",
+		zap.String("prefix", prefix),
+		zap.String("policy", policy),
+		zap.Int("total", resp.Total),
+		zap.Int("imported", resp.Imported),
+		zap.Int("skipped", resp.Skipped),
+		zap.Int("failed", resp.Failed),
+	)
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Import finished",
+		Data:    resp,
+	})
+}
+
+// importValue 写入一条导入记录，skip为true且键已存在时不写入并返回false。
+// 检查与写入在同一把写锁内完成，不会覆盖检查之后并发写入的值
+func importValue(db *storage.DB, key, value []byte, skip bool, requestID string) (bool, error) {
+	imported := false
+	_, err := db.Update(key, func(cur *storage.Entry) (*storage.Mutation, error) {
+		if skip && cur != nil {
+			return nil, nil
+		}
+		imported = true
+		return &storage.Mutation{Value: value, RequestID: requestID}, nil
+	})
+	return imported, err
+}
+
+// newExportItem 生成一条导出记录。键和值都是合法的UTF-8时按原文输出，
+// 否则都以base64编码，避免二进制数据在JSON中被替换为U+FFFD
+func newExportItem(key, value []byte) ExportItem {
+	if utf8.Valid(key) && utf8.Valid(value) {
+		encoded, _ := json.Marshal(string(value))
+		return ExportItem{Key: string(key), Value: encoded}
+	}
+	encoded, _ := json.Marshal(base64.StdEncoding.EncodeToString(value))
+	return ExportItem{
+		Key:      base64.StdEncoding.EncodeToString(key),
+		Value:    encoded,
+		Encoding: ExportEncodingBase64,
+	}
+}
+
+// decodeImportItem 还原导入记录的键和值
+func decodeImportItem(item ExportItem) (key, value []byte, err error) {
+	switch item.Encoding {
+	case "":
+		return []byte(item.Key), decodeImportValue(item.Value), nil
+	case ExportEncodingBase64:
+		if key, err = base64.StdEncoding.DecodeString(item.Key); err != nil {
+			return nil, nil, fmt.Errorf("invalid base64 key: %w", err)
+		}
+		var s string
+		if err := json.Unmarshal(item.Value, &s); err != nil {
+			return nil, nil, errors.New("base64 value must be a string")
+		}
+		if value, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return key, value, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported encoding: %q", item.Encoding)
+	}
+}
+
+// decodeImportValue 还原导入的值，字符串按原文存储，其他JSON值按文本存储
+func decodeImportValue(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
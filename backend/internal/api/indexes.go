@@ -0,0 +1,252 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// registerIndexRoutes 注册二级索引相关的路由
+func (h *Handler) registerIndexRoutes(g *gin.RouterGroup) {
+	g.GET("/indexes", h.listIndexes)
+	g.POST("/indexes", h.createIndex)
+	g.GET("/indexes/:name", h.getIndex)
+	g.DELETE("/indexes/:name", h.dropIndex)
+	g.GET("/query", h.queryIndex)
+}
+
+// listIndexes 处理列出二级索引的请求
+func (h *Handler) listIndexes(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   h.db(c).Indexes(),
+	})
+}
+
+// createIndex 处理创建二级索引的请求，已有数据在后台建立索引
+func (h *Handler) createIndex(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req CreateIndexRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	info, err := h.db(c).CreateIndex(storage.IndexDef{
+		Name:   req.Name,
+		Prefix: req.Prefix,
+		Path:   req.Path,
+		Type:   req.Type,
+	})
+	if err != nil {
+		logger.Error("创建二级索引失败",
+			zap.String("index", req.Name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to create index: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Response{
+		Status:  "success",
+		Message: "Index created, existing keys are being indexed in the background",
+		Data:    info,
+	})
+}
+
+// getIndex 处理获取二级索引状态的请求
+func (h *Handler) getIndex(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.Param("name")
+	info, err := h.db(c).Index(name)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get index: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   info,
+	})
+}
+
+// dropIndex 处理删除二级索引的请求
+func (h *Handler) dropIndex(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.Param("name")
+	if err := h.db(c).DropIndex(name); err != nil {
+		logger.Error("删除二级索引失败",
+			zap.String("index", name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to drop index: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Index dropped successfully",
+		Data: gin.H{
+			"name": name,
+		},
+	})
+}
+
+// parseIndexQuery 解析索引查询中的 index、eq、gte、lte、limit、cursor、reverse 参数
+func parseIndexQuery(c *gin.Context) (string, storage.IndexQuery, error) {
+	var q storage.IndexQuery
+	name := c.Query("index")
+	if name == "" {
+		return "", q, errors.New("index is required")
+	}
+	if v, ok := c.GetQuery("eq"); ok {
+		q.Eq = &v
+	}
+	if v, ok := c.GetQuery("gte"); ok {
+		q.Gte = &v
+	}
+	if v, ok := c.GetQuery("lte"); ok {
+		q.Lte = &v
+	}
+	if q.Eq != nil && (q.Gte != nil || q.Lte != nil) {
+		return "", q, errors.New("eq cannot be combined with gte or lte")
+	}
+
+	if v := c.Query("reverse"); v != "" {
+		reverse, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", q, errors.New("reverse must be a boolean")
+		}
+		q.Reverse = reverse
+	}
+
+	q.Limit = defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return "", q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = min(n, maxListLimit)
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		after, reverse, err := decodeCursor(v)
+		if err != nil {
+			return "", q, err
+		}
+		if reverse != q.Reverse {
+			return "", q, errors.New("cursor does not match the reverse parameter")
+		}
+		q.After = after
+	}
+	return name, q, nil
+}
+
+// queryIndex 处理按二级索引查询键的请求，结果按索引值排序，值相同时按键排序
+func (h *Handler) queryIndex(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name, q, err := parseIndexQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	matches, next, err := h.db(c).QueryIndex(name, q)
+	if err != nil {
+		indexQueryError(c, name, err)
+		return
+	}
+	// 查询结束后再补充元数据
+	keys := make([][]byte, len(matches))
+	for i, m := range matches {
+		keys[i] = m.Key
+	}
+	metas, err := h.db(c).GetMetas(keys)
+	if err != nil {
+		indexQueryError(c, name, err)
+		return
+	}
+
+	resp := QueryResponse{
+		Index: name,
+		Count: len(matches),
+		Items: make([]KeyValuePair, len(matches)),
+	}
+	for i, m := range matches {
+		resp.Items[i] = KeyValuePair{
+			Key:         string(m.Key),
+			Value:       string(m.Value),
+			KeyMetadata: newKeyMetadata(metas[i]),
+		}
+	}
+	if next != nil {
+		resp.NextCursor = encodeCursor(string(next), q.Reverse)
+	}
+
+	logger.Info("按索引查询",
+		zap.String("index", name),
+		zap.Int("count", resp.Count),
+		zap.Bool("hasMore", next != nil),
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+func indexQueryError(c *gin.Context, name string, err error) {
+	logger.Error("按索引查询失败",
+		zap.String("index", name),
+		zap.Error(err))
+	code := storageErrorStatus(err)
+	c.JSON(code, ErrorResponse{
+		Status:  "error",
+		Message: "Failed to query index: " + err.Error(),
+		Code:    code,
+	})
+}
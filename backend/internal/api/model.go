@@ -1,20 +1,86 @@
 package api
 
+import (
+	"FastDB-Web/internal/replication"
+	"FastDB-Web/internal/storage"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
 // KeyValuePair 表示一个键值对
 type KeyValuePair struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	*KeyMetadata
+}
+
+// KeyMetadata 表示服务端记录的键元数据
+type KeyMetadata struct {
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   uint64    `json:"version"`
+	Size      int       `json:"size"`
 }
 
-// KeyValueRequest 表示设置键值的请求
+// newKeyMetadata 转换存储层的元数据，meta为nil时返回nil
+func newKeyMetadata(meta *storage.KeyMeta) *KeyMetadata {
+	if meta == nil {
+		return nil
+	}
+	return &KeyMetadata{
+		CreatedAt: meta.CreatedAt,
+		UpdatedAt: meta.UpdatedAt,
+		Version:   meta.Version,
+		Size:      meta.Size,
+	}
+}
+
+// KeyValueRequest 表示设置键值的请求，ttl（秒）与expireAt最多设置一个
 type KeyValueRequest struct {
-	Value string `json:"value" binding:"required"`
+	Value    string     `json:"value" binding:"required"`
+	TTL      *int64     `json:"ttl,omitempty"`
+	ExpireAt *time.Time `json:"expireAt,omitempty"`
+}
+
+// expireAt 计算请求中的过期时间，未设置时返回零值
+func (r KeyValueRequest) expireAt(now time.Time) (time.Time, error) {
+	switch {
+	case r.TTL != nil && r.ExpireAt != nil:
+		return time.Time{}, errors.New("ttl and expireAt are mutually exclusive")
+	case r.TTL != nil:
+		if *r.TTL <= 0 {
+			return time.Time{}, errors.New("ttl must be a positive number of seconds")
+		}
+		return now.Add(time.Duration(*r.TTL) * time.Second), nil
+	case r.ExpireAt != nil:
+		if !r.ExpireAt.After(now) {
+			return time.Time{}, errors.New("expireAt must be in the future")
+		}
+		return *r.ExpireAt, nil
+	}
+	return time.Time{}, nil
 }
 
-// KeyValueResponse 表示获取键值的响应
+// KeyValueResponse 表示获取键值的响应，ttl为剩余的秒数，path不为空时value是该路径下的子文档
 type KeyValueResponse struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	Path  string `json:"path,omitempty"`
+	*KeyMetadata
+	TTL      *int64     `json:"ttl,omitempty"`
+	ExpireAt *time.Time `json:"expireAt,omitempty"`
+}
+
+// setExpireAt 填充过期时间和剩余秒数
+func (r *KeyValueResponse) setExpireAt(expireAt time.Time) {
+	ttl := int64(math.Ceil(time.Until(expireAt).Seconds()))
+	if ttl < 0 {
+		ttl = 0
+	}
+	r.TTL = &ttl
+	r.ExpireAt = &expireAt
 }
 
 // ConnectRequest 表示数据库连接请求
@@ -30,10 +96,78 @@ type DBStatusRequest struct {
 	Connect bool `json:"connect"`
 }
 
-// ListResponse 表示列出键值对的响应
+// ListResponse 表示分页列出键值对的响应，Items按键排序
 type ListResponse struct {
-	Total int               `json:"total"`
-	Items map[string]string `json:"items"`
+	Count      int            `json:"count"`
+	Items      []KeyValuePair `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// CreateIndexRequest 表示创建二级索引的请求，type为string（默认）或number
+type CreateIndexRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Prefix string `json:"prefix"`
+	Path   string `json:"path" binding:"required"`
+	Type   string `json:"type"`
+}
+
+// QueryResponse 表示按二级索引查询的响应，Items按索引值排序，值相同时按键排序
+type QueryResponse struct {
+	Index      string         `json:"index"`
+	Count      int            `json:"count"`
+	Items      []KeyValuePair `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// SearchHit 表示全文检索命中的键，高亮片段经过HTML转义，命中的词用<mark>包围
+type SearchHit struct {
+	Key            string  `json:"key"`
+	Value          string  `json:"value"`
+	Score          float64 `json:"score"`
+	KeyHighlight   string  `json:"keyHighlight"`
+	ValueHighlight string  `json:"valueHighlight,omitempty"`
+}
+
+// SearchResponse 表示全文检索的响应，Hits按相关度从高到低排序，Total为分页前的命中总数
+type SearchResponse struct {
+	Query  string      `json:"query"`
+	Terms  []string    `json:"terms"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Count  int         `json:"count"`
+	Hits   []SearchHit `json:"hits"`
+	// Building 表示全文索引正在重建，结果可能不完整
+	Building bool `json:"building"`
+}
+
+// WatchEvent 表示变更订阅推送的一条消息，token是恢复令牌，重新订阅时传入after可以从该位置继续
+type WatchEvent struct {
+	Type    string     `json:"type"`
+	Token   string     `json:"token"`
+	Seq     uint64     `json:"seq,omitempty"`
+	Op      string     `json:"op,omitempty"`
+	Key     string     `json:"key,omitempty"`
+	Version uint64     `json:"version,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// VersionInfo 表示键的一个历史版本，不包含值
+type VersionInfo struct {
+	KeyMetadata
+	RequestID string `json:"requestId,omitempty"`
+	Current   bool   `json:"current"`
+}
+
+// HistoryResponse 表示键的版本历史，Versions按版本号从新到旧排列
+type HistoryResponse struct {
+	Key      string        `json:"key"`
+	Versions []VersionInfo `json:"versions"`
+}
+
+// RollbackRequest 表示把键恢复为某个历史版本的请求
+type RollbackRequest struct {
+	Version uint64 `json:"version" binding:"required"`
 }
 
 // Response 表示API响应
@@ -60,7 +194,7 @@ type ConnectResponse struct {
 type DBStatusResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
-	details Detail `json:"details"`
+	Details Detail `json:"details"`
 }
 
 // Detail 表示数据库连接详情信息
@@ -69,3 +203,250 @@ type Detail struct {
 	Port     string `json:"port"`
 	Username string `json:"username"`
 }
+
+// ExportItem 表示导入导出文件中的一条记录。Encoding为base64时Key和Value都是base64编码的字符串，
+// 用于不是合法UTF-8的二进制数据
+type ExportItem struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+// ImportResult 表示单个键的导入结果
+type ImportResult struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportResponse 表示导入数据的响应
+type ImportResponse struct {
+	Total    int            `json:"total"`
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// 批量操作类型
+const (
+	BatchOpPut    = "put"
+	BatchOpDelete = "delete"
+)
+
+// BatchOperation 表示批量写入中的一个操作
+type BatchOperation struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// BatchRequest 表示批量写入请求
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" binding:"required"`
+}
+
+// BatchOpResult 表示批量写入中单个操作的结果
+type BatchOpResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResponse 表示批量写入的响应
+type BatchResponse struct {
+	Applied bool            `json:"applied"`
+	Results []BatchOpResult `json:"results"`
+}
+
+// CASRequest 表示比较并交换请求，expected为null或缺省时要求键不存在
+type CASRequest struct {
+	Expected *string `json:"expected"`
+	Value    string  `json:"value" binding:"required"`
+}
+
+// CASResponse 表示比较并交换的结果，失败时Current为键的当前值
+type CASResponse struct {
+	Key     string  `json:"key"`
+	Swapped bool    `json:"swapped"`
+	Value   string  `json:"value,omitempty"`
+	Current *string `json:"current,omitempty"`
+	*KeyMetadata
+}
+
+// 计数器的模式
+const (
+	CounterModeInt   = "int"
+	CounterModeFloat = "float"
+)
+
+// IncrRequest 表示计数器自增（自减）请求，delta缺省为1，mode缺省为int
+type IncrRequest struct {
+	Delta json.Number `json:"delta"`
+	Mode  string      `json:"mode"`
+}
+
+// IncrResponse 表示计数器更新后的值
+type IncrResponse struct {
+	Key   string      `json:"key"`
+	Value json.Number `json:"value"`
+	*KeyMetadata
+}
+
+// HashSetRequest 表示设置哈希字段的请求
+type HashSetRequest struct {
+	Fields map[string]string `json:"fields" binding:"required,min=1"`
+}
+
+// HashResponse 表示哈希的全部字段
+type HashResponse struct {
+	Key    string            `json:"key"`
+	Fields map[string]string `json:"fields"`
+}
+
+// HashFieldResponse 表示哈希中的一个字段
+type HashFieldResponse struct {
+	Key   string `json:"key"`
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// ListPushRequest 表示向列表写入元素的请求
+type ListPushRequest struct {
+	Values []string `json:"values" binding:"required,min=1"`
+}
+
+// ListPopRequest 表示从列表弹出元素的请求，count缺省为1
+type ListPopRequest struct {
+	Count int `json:"count"`
+}
+
+// ListValuesResponse 表示列表中的元素以及列表当前的长度
+type ListValuesResponse struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+	Length int64    `json:"length"`
+}
+
+// SetAddRequest 表示向集合添加成员的请求
+type SetAddRequest struct {
+	Members []string `json:"members" binding:"required,min=1"`
+}
+
+// SetResponse 表示集合的全部成员
+type SetResponse struct {
+	Key     string   `json:"key"`
+	Members []string `json:"members"`
+}
+
+// SetMemberResponse 表示成员是否在集合中
+type SetMemberResponse struct {
+	Key      string `json:"key"`
+	Member   string `json:"member"`
+	IsMember bool   `json:"isMember"`
+}
+
+// ZSetMember 表示有序集合中的一个成员及其分数
+type ZSetMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// ZAddRequest 表示向有序集合添加成员的请求
+type ZAddRequest struct {
+	Members []ZSetMember `json:"members" binding:"required,min=1"`
+}
+
+// ZIncrByRequest 表示增加成员分数的请求
+type ZIncrByRequest struct {
+	Delta *float64 `json:"delta" binding:"required"`
+}
+
+// ZSetRangeResponse 表示有序集合范围查询的结果，count为有序集合的成员总数
+type ZSetRangeResponse struct {
+	Key     string       `json:"key"`
+	Members []ZSetMember `json:"members"`
+	Count   int64        `json:"count"`
+}
+
+// ZSetMemberResponse 表示成员的分数和排名
+type ZSetMemberResponse struct {
+	Key    string  `json:"key"`
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Rank   int64   `json:"rank"`
+}
+
+// CountResponse 表示数据结构写操作的结果，count为新增或删除的数量，写入列表时为列表的长度
+type CountResponse struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// CreateDatabaseRequest 表示创建命名数据库的请求
+type CreateDatabaseRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// BackupRequest 表示创建备份的请求，database为空时备份默认数据库
+type BackupRequest struct {
+	Database string `json:"database"`
+}
+
+// RestoreRequest 表示恢复备份的请求，database为空时恢复到归档记录的数据库
+type RestoreRequest struct {
+	File     string `json:"file" binding:"required"`
+	Database string `json:"database"`
+}
+
+// MergeRequest 表示手动合并的请求，database为空时合并默认数据库
+type MergeRequest struct {
+	Database string `json:"database"`
+}
+
+// RebuildSearchRequest 表示重建全文索引的请求，database为空时重建默认数据库的索引
+type RebuildSearchRequest struct {
+	Database string `json:"database"`
+}
+
+// SearchStatsResponse 表示全文索引统计信息的响应
+type SearchStatsResponse struct {
+	Database string `json:"database"`
+	storage.SearchStats
+}
+
+// StatsResponse 表示数据库统计信息的响应
+type StatsResponse struct {
+	Database string `json:"database"`
+	*storage.DBStats
+}
+
+// ReplicationStatusResponse 表示本节点的复制状态
+type ReplicationStatusResponse struct {
+	Role      string `json:"role"` // leader、follower或standalone
+	LeaderURL string `json:"leaderURL,omitempty"`
+	// Leader 是主节点上各个已打开的数据库的复制日志及从节点的进度
+	Leader []LeaderLogStatus `json:"leader,omitempty"`
+	// Follower 是从节点上各个被复制的数据库的复制状态
+	Follower []replication.DatabaseStatus `json:"follower,omitempty"`
+}
+
+// LeaderLogStatus 表示主节点上一个数据库的复制日志
+type LeaderLogStatus struct {
+	Database string `json:"database"`
+	storage.LogStatus
+	Followers []ReplicaProgress `json:"followers"`
+}
+
+// ReplicaProgress 表示主节点记录的一个从节点最近一次拉取日志时的进度
+type ReplicaProgress struct {
+	ID         string    `json:"id"`
+	Address    string    `json:"address"`
+	AppliedSeq uint64    `json:"appliedSeq"`
+	Lag        uint64    `json:"lag"` // 落后的日志条数，纪元不同时为主节点的全部日志
+	LastSeen   time.Time `json:"lastSeen"`
+
+	epoch string
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"FastDB-Web/internal/storage"
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultListLimit 默认每页返回的键值对数量
+	defaultListLimit = 100
+	// maxListLimit 每页允许返回的最大键值对数量
+	maxListLimit = 1000
+)
+
+// 游标的第一个字节标记遍历方向，避免正序游标被用于逆序请求
+const (
+	cursorForward = 'f'
+	cursorReverse = 'r'
+)
+
+// parseListQuery 解析列表请求中的 prefix、start、end、limit、cursor、reverse 参数
+func parseListQuery(c *gin.Context) (storage.ScanOptions, int, error) {
+	opts := storage.ScanOptions{
+		Prefix: []byte(c.Query("prefix")),
+		Start:  []byte(c.Query("start")),
+		End:    []byte(c.Query("end")),
+	}
+
+	if v := c.Query("reverse"); v != "" {
+		reverse, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, 0, errors.New("reverse must be a boolean")
+		}
+		opts.Reverse = reverse
+	}
+
+	limit := defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, 0, errors.New("limit must be a positive integer")
+		}
+		if n > maxListLimit {
+			n = maxListLimit
+		}
+		limit = n
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		last, reverse, err := decodeCursor(v)
+		if err != nil {
+			return opts, 0, err
+		}
+		if reverse != opts.Reverse {
+			return opts, 0, errors.New("cursor does not match the reverse parameter")
+		}
+		// 从上一页最后一个键之后继续遍历
+		if reverse {
+			opts.End = last
+		} else {
+			opts.Start = append(last, 0)
+		}
+	}
+
+	return opts, limit, nil
+}
+
+// encodeCursor 将上一页的最后一个键编码为不透明的游标
+func encodeCursor(lastKey string, reverse bool) string {
+	direction := byte(cursorForward)
+	if reverse {
+		direction = cursorReverse
+	}
+	return base64.RawURLEncoding.EncodeToString(append([]byte{direction}, lastKey...))
+}
+
+// decodeCursor 解析游标，返回上一页的最后一个键和遍历方向
+func decodeCursor(cursor string) ([]byte, bool, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) < 2 {
+		return nil, false, errors.New("invalid cursor")
+	}
+	switch raw[0] {
+	case cursorForward:
+		return raw[1:], false, nil
+	case cursorReverse:
+		return raw[1:], true, nil
+	default:
+		return nil, false, errors.New("invalid cursor")
+	}
+}
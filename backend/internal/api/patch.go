@@ -0,0 +1,116 @@
+package api
+
+import (
+	"FastDB-Web/internal/jsondoc"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PATCH请求支持的补丁格式
+const (
+	ContentTypeJSONPatch  = "application/json-patch+json"
+	ContentTypeMergePatch = "application/merge-patch+json"
+)
+
+// patchKey 处理PATCH请求，按Content-Type把JSON Patch或JSON Merge Patch原子地应用到键的JSON值上
+func (h *Handler) patchKey(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch c.ContentType() {
+	case ContentTypeJSONPatch:
+		apply = jsondoc.ApplyPatch
+	case ContentTypeMergePatch:
+		apply = jsondoc.MergePatch
+	default:
+		c.Header("Accept-Patch", ContentTypeJSONPatch+", "+ContentTypeMergePatch)
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+			Status:  "error",
+			Message: "Content-Type must be " + ContentTypeJSONPatch + " or " + ContentTypeMergePatch,
+			Code:    http.StatusUnsupportedMediaType,
+		})
+		return
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// 读取旧值、应用补丁和写入新值在同一把写锁内完成，过期时间保持不变
+	cond := parseConditions(c)
+	var value []byte
+	meta, err := h.db(c).Update([]byte(key), func(cur *storage.Entry) (*storage.Mutation, error) {
+		if cur == nil {
+			return nil, storage.ErrKeyNotFound
+		}
+		if err := cond.check(cur); err != nil {
+			return nil, err
+		}
+		doc, err := apply(cur.Value, patch)
+		if err != nil {
+			return nil, err
+		}
+		value = doc
+		return &storage.Mutation{Value: doc, KeepTTL: true, RequestID: c.GetString("requestID")}, nil
+	})
+	if err != nil {
+		logger.Error("应用补丁失败",
+			zap.String("key", key),
+			zap.String("contentType", c.ContentType()),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to patch value: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.Header("ETag", makeETag(meta, value))
+	resp := KeyValueResponse{
+		Key:         key,
+		Value:       string(value),
+		KeyMetadata: newKeyMetadata(meta),
+	}
+	if expireAt, ok, err := h.db(c).TTL([]byte(key)); err == nil && ok {
+		resp.setExpireAt(expireAt)
+	}
+
+	logger.Info("成功应用补丁",
+		zap.String("key", key),
+		zap.String("contentType", c.ContentType()))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Value patched successfully",
+		Data:    resp,
+	})
+}
+
+// subDocument 返回JSON值中path指向的子文档
+func subDocument(value []byte, path string) ([]byte, error) {
+	doc, err := jsondoc.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := jsondoc.Get(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	return jsondoc.Marshal(sub)
+}
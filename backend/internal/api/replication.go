@@ -0,0 +1,291 @@
+package api
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/replication"
+	"FastDB-Web/internal/storage"
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultReplicationLimit 是未指定limit时每次返回的日志条数，maxReplicationLimit是其上限
+	defaultReplicationLimit = 500
+	maxReplicationLimit     = 5000
+	// maxReplicationWait 是拉取日志时等待新日志的最长时间
+	maxReplicationWait = 60 * time.Second
+	// replicationRoleStandalone 是不参与复制的节点在复制状态中的角色
+	replicationRoleStandalone = "standalone"
+)
+
+// redirectReplicaWrites 在从节点的只读副本上把写请求以307重定向到主节点的同一路径，
+// 读请求照常处理。307要求客户端保留请求方法和请求体
+func (h *Handler) redirectReplicaWrites(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	db := h.db(c)
+	if db == nil || !db.IsReplica() {
+		c.Next()
+		return
+	}
+
+	leader := strings.TrimRight(h.dbs.Replication().LeaderURL, "/")
+	c.Header("Location", leader+c.Request.URL.RequestURI())
+	c.Header("X-Replication-Leader", leader)
+	c.AbortWithStatusJSON(http.StatusTemporaryRedirect, ErrorResponse{
+		Status:  "error",
+		Message: "This node is a read-only replica, send writes to the leader at " + leader,
+		Code:    http.StatusTemporaryRedirect,
+	})
+}
+
+// replicationDatabase 按database参数返回要复制的数据库，失败时写入错误响应并返回nil
+func (h *Handler) replicationDatabase(c *gin.Context) (string, *storage.DB) {
+	name := c.DefaultQuery("database", h.dbs.DefaultName())
+	db, err := h.dbs.Get(name)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + name + ": " + err.Error(),
+			Code:    code,
+		})
+		return name, nil
+	}
+	return name, db
+}
+
+// trackReplica 记录从节点最近一次拉取日志时的位置
+func (h *Handler) trackReplica(database, id, address string, pos storage.ReplicationPosition) {
+	if id == "" {
+		return
+	}
+	h.replicasMu.Lock()
+	defer h.replicasMu.Unlock()
+	replicas := h.replicas[database]
+	if replicas == nil {
+		replicas = make(map[string]*ReplicaProgress)
+		h.replicas[database] = replicas
+	}
+	replicas[id] = &ReplicaProgress{
+		ID:         id,
+		Address:    address,
+		AppliedSeq: pos.Seq,
+		LastSeen:   time.Now(),
+		epoch:      pos.Epoch,
+	}
+}
+
+// replicaProgress 返回从节点在数据库上的进度，按ID排列
+func (h *Handler) replicaProgress(database string, log storage.LogStatus) []ReplicaProgress {
+	h.replicasMu.Lock()
+	defer h.replicasMu.Unlock()
+	progress := make([]ReplicaProgress, 0, len(h.replicas[database]))
+	for _, p := range h.replicas[database] {
+		r := *p
+		switch {
+		case r.epoch != log.Epoch:
+			r.Lag = log.LastSeq
+		case log.LastSeq > r.AppliedSeq:
+			r.Lag = log.LastSeq - r.AppliedSeq
+		}
+		progress = append(progress, r)
+	}
+	sort.Slice(progress, func(i, j int) bool { return progress[i].ID < progress[j].ID })
+	return progress
+}
+
+// replicationLog 处理从节点拉取复制日志的请求，返回序号大于after的日志。
+// 没有新日志时最多等待wait秒；after已经不在日志中时返回410，从节点需要重新加载快照。
+// 从节点直接访问该接口，不要求先在管理界面上连接数据库
+func (h *Handler) replicationLog(c *gin.Context) {
+	name, db := h.replicationDatabase(c)
+	if db == nil {
+		return
+	}
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	limit, limitErr := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReplicationLimit)))
+	wait, waitErr := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if err != nil || limitErr != nil || waitErr != nil || limit <= 0 || wait < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: after, limit and wait must be non-negative integers",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	limit = min(limit, maxReplicationLimit)
+
+	// 不带纪元时读取当前的日志，便于手工查看；从节点总是带上自己的纪元
+	epoch := c.Query("epoch")
+	if epoch == "" {
+		status, err := db.LogStatus()
+		if err == nil {
+			epoch = status.Epoch
+		}
+	}
+	h.trackReplica(name, c.Query("follower"), c.ClientIP(), storage.ReplicationPosition{Epoch: epoch, Seq: after})
+
+	batch, err := db.ReadLog(epoch, after, limit)
+	if err == nil && len(batch.Entries) == 0 && wait > 0 {
+		ctx, stop := h.streamContext(c.Request.Context())
+		ctx, cancel := context.WithTimeout(ctx, min(time.Duration(wait)*time.Second, maxReplicationWait))
+		err = db.WaitLog(ctx, after)
+		cancel()
+		stop()
+		// 等待超时或服务器开始关闭时返回当前的日志，从节点随后重新拉取
+		if ctx.Err() != nil && c.Request.Context().Err() == nil {
+			err = nil
+		}
+		if err == nil {
+			batch, err = db.ReadLog(epoch, after, limit)
+		}
+	}
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		logger.Warn("读取复制日志失败",
+			zap.String("database", name),
+			zap.String("epoch", epoch),
+			zap.Uint64("after", after),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to read replication log: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   batch,
+	})
+}
+
+// replicationSnapshot 处理从节点下载快照的请求，响应体为Dump格式的数据，
+// 快照对应的日志位置在响应头中。快照先导出到临时文件，避免慢速的从节点长时间阻塞写入。
+// 与replicationLog一样不要求先在管理界面上连接数据库
+func (h *Handler) replicationSnapshot(c *gin.Context) {
+	name, db := h.replicationDatabase(c)
+	if db == nil {
+		return
+	}
+	tmp, err := os.CreateTemp("", "fastdb-snapshot-*")
+	var pos storage.ReplicationPosition
+	var records int
+	var size int64
+	if err == nil {
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		bw := bufio.NewWriter(tmp)
+		if pos, records, err = db.Snapshot(bw); err == nil {
+			err = bw.Flush()
+		}
+	}
+	if err == nil {
+		size, err = tmp.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		logger.Error("创建复制快照失败",
+			zap.String("database", name),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to create snapshot: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	h.trackReplica(name, c.Query("follower"), c.ClientIP(), pos)
+	logger.Info("发送复制快照",
+		zap.String("database", name),
+		zap.String("follower", c.Query("follower")),
+		zap.String("epoch", pos.Epoch),
+		zap.Uint64("seq", pos.Seq),
+		zap.Int("records", records),
+		zap.Int64("size", size))
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", tmp, map[string]string{
+		replication.HeaderEpoch: pos.Epoch,
+		replication.HeaderSeq:   strconv.FormatUint(pos.Seq, 10),
+	})
+}
+
+// replicationStatus 处理查询复制状态的请求：主节点返回各数据库的日志位置和从节点的进度，
+// 从节点返回各被复制的数据库已应用的位置和落后的程度
+func (h *Handler) replicationStatus(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	cfg := h.dbs.Replication()
+	resp := ReplicationStatusResponse{Role: cfg.Role}
+	switch cfg.Role {
+	case config.ReplicationRoleLeader:
+		infos, err := h.dbs.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to list databases: " + err.Error(),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		resp.Leader = []LeaderLogStatus{}
+		for _, info := range infos {
+			if !info.Open {
+				continue
+			}
+			db, err := h.dbs.Get(info.Name)
+			if err != nil {
+				continue
+			}
+			log, err := db.LogStatus()
+			if err != nil {
+				continue
+			}
+			resp.Leader = append(resp.Leader, LeaderLogStatus{
+				Database:  info.Name,
+				LogStatus: log,
+				Followers: h.replicaProgress(info.Name, log),
+			})
+		}
+	case config.ReplicationRoleFollower:
+		resp.LeaderURL = cfg.LeaderURL
+		resp.Follower = []replication.DatabaseStatus{}
+		if h.follower != nil {
+			resp.Follower = h.follower.Status()
+		}
+	default:
+		resp.Role = replicationRoleStandalone
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   resp,
+	})
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"FastDB-Web/internal/fulltext"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 高亮片段的最大字符数
+const (
+	keyHighlightRunes   = 256
+	valueHighlightRunes = 160
+)
+
+// search 处理全文检索的请求，q中的词需要全部出现在键名或值中，结果按相关度排序并用offset、limit分页
+func (h *Handler) search(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	query := c.Query("q")
+	q := storage.SearchQuery{Query: query, Limit: defaultListLimit}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: offset must be a non-negative integer",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		q.Offset = n
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: limit must be a positive integer",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		q.Limit = min(n, maxListLimit)
+	}
+
+	result, err := h.db(c).Search(q)
+	if err != nil {
+		logger.Error("全文检索失败",
+			zap.String("query", query),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to search: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	resp := SearchResponse{
+		Query:    query,
+		Terms:    result.Terms,
+		Total:    result.Total,
+		Offset:   q.Offset,
+		Count:    len(result.Hits),
+		Hits:     make([]SearchHit, len(result.Hits)),
+		Building: result.Building,
+	}
+	for i, hit := range result.Hits {
+		resp.Hits[i] = SearchHit{
+			Key:   string(hit.Key),
+			Value: string(hit.Value),
+			Score: hit.Score,
+		}
+		resp.Hits[i].KeyHighlight, _ = fulltext.Highlight(string(hit.Key), result.Terms, keyHighlightRunes)
+		// 二进制值没有进入索引，也不生成高亮
+		if utf8.Valid(hit.Value) {
+			resp.Hits[i].ValueHighlight, _ = fulltext.Highlight(string(hit.Value), result.Terms, valueHighlightRunes)
+		}
+	}
+
+	logger.Info("全文检索",
+		zap.String("query", query),
+		zap.Int("total", resp.Total),
+		zap.Int("count", resp.Count),
+	)
+	c.JSON(http.StatusOK, resp)
+}
+
+// rebuildSearch 处理重建全文索引的请求，重建在后台进行，期间检索结果可能不完整
+func (h *Handler) rebuildSearch(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	var req RebuildSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.Error("解析请求体失败", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.Database == "" {
+		req.Database = h.dbs.DefaultName()
+	}
+
+	db, err := h.dbs.Get(req.Database)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + req.Database + ": " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	if err := db.RebuildSearch(); err != nil {
+		logger.Error("重建全文索引失败",
+			zap.String("database", req.Database),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to rebuild full-text index: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	stats, err := db.SearchStats()
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get full-text index stats: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Response{
+		Status:  "success",
+		Message: "Full-text index rebuild started",
+		Data:    SearchStatsResponse{Database: req.Database, SearchStats: stats},
+	})
+}
+
+// searchStats 处理查询全文索引状态和统计信息的请求
+func (h *Handler) searchStats(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	name := c.DefaultQuery("database", h.dbs.DefaultName())
+	db, err := h.dbs.Get(name)
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to open database " + name + ": " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	stats, err := db.SearchStats()
+	if err != nil {
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get full-text index stats: " + err.Error(),
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   SearchStatsResponse{Database: name, SearchStats: stats},
+	})
+}
@@ -0,0 +1,429 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/structures"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// registerStructureRoutes 注册哈希、列表、集合和有序集合相关的路由
+func (h *Handler) registerStructureRoutes(g *gin.RouterGroup) {
+	// 哈希
+	g.GET("/hash/:key", h.hashGetAll)
+	g.PUT("/hash/:key", h.hashSet)
+	g.DELETE("/hash/:key", h.deleteStructure(structures.TypeHash))
+	g.GET("/hash/:key/:field", h.hashGet)
+	g.DELETE("/hash/:key/:field", h.hashDel)
+
+	// 列表
+	g.GET("/list/:key", h.listRange)
+	g.DELETE("/list/:key", h.deleteStructure(structures.TypeList))
+	g.POST("/list/:key/lpush", h.listPush(true))
+	g.POST("/list/:key/rpush", h.listPush(false))
+	g.POST("/list/:key/lpop", h.listPop(true))
+	g.POST("/list/:key/rpop", h.listPop(false))
+
+	// 集合
+	g.GET("/set/:key", h.setMembers)
+	g.POST("/set/:key", h.setAdd)
+	g.DELETE("/set/:key", h.deleteStructure(structures.TypeSet))
+	g.GET("/set/:key/:member", h.setIsMember)
+	g.DELETE("/set/:key/:member", h.setRem)
+
+	// 有序集合
+	g.GET("/zset/:key", h.zsetRange)
+	g.POST("/zset/:key", h.zsetAdd)
+	g.DELETE("/zset/:key", h.deleteStructure(structures.TypeZSet))
+	g.GET("/zset/:key/:member", h.zsetScore)
+	g.DELETE("/zset/:key/:member", h.zsetRem)
+	g.POST("/zset/:key/:member/incr", h.zsetIncrBy)
+}
+
+// structs 返回当前请求所用数据库上的数据结构
+func (h *Handler) structs(c *gin.Context) *structures.Store {
+	return structures.Open(h.db(c))
+}
+
+// structureError 记录并返回数据结构操作的错误
+func structureError(c *gin.Context, key, action string, err error) {
+	logger.Error("数据结构操作失败",
+		zap.String("key", key),
+		zap.String("action", action),
+		zap.Error(err))
+	code := storageErrorStatus(err)
+	c.JSON(code, ErrorResponse{
+		Status:  "error",
+		Message: "Failed to " + action + ": " + err.Error(),
+		Code:    code,
+	})
+}
+
+// bindStructureRequest 解析请求体，失败时返回400并返回false
+func bindStructureRequest(c *gin.Context, key string, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		logger.Error("解析请求体失败",
+			zap.String("key", key),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return false
+	}
+	return true
+}
+
+// deleteStructure 返回删除整个结构的处理函数
+func (h *Handler) deleteStructure(typ string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.checkFastDBStatus(c)
+		if h.status != StatusRunning {
+			return
+		}
+
+		key := c.Param("key")
+		deleted, err := h.structs(c).Delete([]byte(key), typ)
+		if err != nil {
+			structureError(c, key, "delete "+typ, err)
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: "Key not found",
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+
+		logger.Info("删除数据结构成功", zap.String("key", key), zap.String("type", typ))
+		c.JSON(http.StatusOK, Response{
+			Status:  "success",
+			Message: "Key deleted successfully",
+		})
+	}
+}
+
+// hashGetAll 处理HGETALL请求
+func (h *Handler) hashGetAll(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	fields, err := h.structs(c).HGetAll([]byte(key))
+	if err != nil {
+		structureError(c, key, "get hash", err)
+		return
+	}
+	resp := HashResponse{Key: key, Fields: make(map[string]string, len(fields))}
+	for field, value := range fields {
+		resp.Fields[field] = string(value)
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   resp,
+	})
+}
+
+// hashSet 处理HSET请求
+func (h *Handler) hashSet(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var req HashSetRequest
+	if !bindStructureRequest(c, key, &req) {
+		return
+	}
+	fields := make(map[string][]byte, len(req.Fields))
+	for field, value := range req.Fields {
+		fields[field] = []byte(value)
+	}
+	added, err := h.structs(c).HSet([]byte(key), fields)
+	if err != nil {
+		structureError(c, key, "set hash fields", err)
+		return
+	}
+
+	logger.Info("设置哈希字段成功", zap.String("key", key), zap.Int("added", added))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Hash fields stored successfully",
+		Data:    CountResponse{Key: key, Count: int64(added)},
+	})
+}
+
+// hashGet 处理HGET请求
+func (h *Handler) hashGet(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, field := c.Param("key"), c.Param("field")
+	value, err := h.structs(c).HGet([]byte(key), []byte(field))
+	if err != nil {
+		structureError(c, key, "get hash field", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   HashFieldResponse{Key: key, Field: field, Value: string(value)},
+	})
+}
+
+// hashDel 处理HDEL请求
+func (h *Handler) hashDel(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, field := c.Param("key"), c.Param("field")
+	removed, err := h.structs(c).HDel([]byte(key), []byte(field))
+	if err != nil {
+		structureError(c, key, "delete hash field", err)
+		return
+	}
+
+	logger.Info("删除哈希字段", zap.String("key", key), zap.String("field", field), zap.Int("removed", removed))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Hash field deleted",
+		Data:    CountResponse{Key: key, Count: int64(removed)},
+	})
+}
+
+// listRange 处理LRANGE请求，start和stop缺省时返回整个列表
+func (h *Handler) listRange(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	start, err1 := strconv.ParseInt(c.DefaultQuery("start", "0"), 10, 64)
+	stop, err2 := strconv.ParseInt(c.DefaultQuery("stop", "-1"), 10, 64)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: start and stop must be integers",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	s := h.structs(c)
+	values, err := s.LRange([]byte(key), start, stop)
+	if err != nil {
+		structureError(c, key, "get list range", err)
+		return
+	}
+	length, err := s.LLen([]byte(key))
+	if err != nil {
+		structureError(c, key, "get list length", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   ListValuesResponse{Key: key, Values: toStrings(values), Length: length},
+	})
+}
+
+// listPush 返回LPUSH（left为true）或RPUSH的处理函数
+func (h *Handler) listPush(left bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.checkFastDBStatus(c)
+		if h.status != StatusRunning {
+			return
+		}
+
+		key := c.Param("key")
+		var req ListPushRequest
+		if !bindStructureRequest(c, key, &req) {
+			return
+		}
+		s := h.structs(c)
+		push := s.RPush
+		if left {
+			push = s.LPush
+		}
+		length, err := push([]byte(key), toBytes(req.Values)...)
+		if err != nil {
+			structureError(c, key, "push to list", err)
+			return
+		}
+
+		logger.Info("写入列表成功", zap.String("key", key), zap.Bool("left", left), zap.Int64("length", length))
+		c.JSON(http.StatusOK, Response{
+			Status:  "success",
+			Message: "Values pushed successfully",
+			Data:    CountResponse{Key: key, Count: length},
+		})
+	}
+}
+
+// listPop 返回LPOP（left为true）或RPOP的处理函数，请求体可以省略，此时弹出一个元素
+func (h *Handler) listPop(left bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.checkFastDBStatus(c)
+		if h.status != StatusRunning {
+			return
+		}
+
+		key := c.Param("key")
+		req := ListPopRequest{Count: 1}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			logger.Error("解析请求体失败",
+				zap.String("key", key),
+				zap.Error(err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: " + err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if req.Count <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid request: count must be positive",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		s := h.structs(c)
+		pop := s.RPop
+		if left {
+			pop = s.LPop
+		}
+		values, err := pop([]byte(key), req.Count)
+		if err != nil {
+			structureError(c, key, "pop from list", err)
+			return
+		}
+		length, err := s.LLen([]byte(key))
+		if err != nil {
+			structureError(c, key, "get list length", err)
+			return
+		}
+
+		logger.Info("弹出列表元素", zap.String("key", key), zap.Bool("left", left), zap.Int("count", len(values)))
+		c.JSON(http.StatusOK, Response{
+			Status: "success",
+			Data:   ListValuesResponse{Key: key, Values: toStrings(values), Length: length},
+		})
+	}
+}
+
+// setMembers 处理SMEMBERS请求
+func (h *Handler) setMembers(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	members, err := h.structs(c).SMembers([]byte(key))
+	if err != nil {
+		structureError(c, key, "get set members", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   SetResponse{Key: key, Members: toStrings(members)},
+	})
+}
+
+// setAdd 处理SADD请求
+func (h *Handler) setAdd(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var req SetAddRequest
+	if !bindStructureRequest(c, key, &req) {
+		return
+	}
+	added, err := h.structs(c).SAdd([]byte(key), toBytes(req.Members)...)
+	if err != nil {
+		structureError(c, key, "add set members", err)
+		return
+	}
+
+	logger.Info("添加集合成员成功", zap.String("key", key), zap.Int("added", added))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Members added successfully",
+		Data:    CountResponse{Key: key, Count: int64(added)},
+	})
+}
+
+// setIsMember 处理SISMEMBER请求
+func (h *Handler) setIsMember(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, member := c.Param("key"), c.Param("member")
+	ok, err := h.structs(c).SIsMember([]byte(key), []byte(member))
+	if err != nil {
+		structureError(c, key, "check set member", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   SetMemberResponse{Key: key, Member: member, IsMember: ok},
+	})
+}
+
+// setRem 处理SREM请求
+func (h *Handler) setRem(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, member := c.Param("key"), c.Param("member")
+	removed, err := h.structs(c).SRem([]byte(key), []byte(member))
+	if err != nil {
+		structureError(c, key, "remove set member", err)
+		return
+	}
+
+	logger.Info("移除集合成员", zap.String("key", key), zap.String("member", member), zap.Int("removed", removed))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Member removed",
+		Data:    CountResponse{Key: key, Count: int64(removed)},
+	})
+}
+
+func toBytes(values []string) [][]byte {
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		result[i] = []byte(v)
+	}
+	return result
+}
+
+func toStrings(values [][]byte) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = string(v)
+	}
+	return result
+}
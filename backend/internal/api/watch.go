@@ -0,0 +1,169 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// watchHeartbeat 是没有事件时SSE发送注释行的间隔，避免代理断开空闲连接
+const watchHeartbeat = 15 * time.Second
+
+// 变更订阅中消息的类型
+const (
+	WatchTypeReady  = "ready"  // 订阅建立，token为当前位置
+	WatchTypeChange = "change" // 键发生变更
+	WatchTypeError  = "error"  // 订阅结束，需要用最后的token重新订阅或重新读取数据
+)
+
+// registerWatchRoutes 注册变更订阅的路由。订阅是长连接，不能经过holdDuringRestore，
+// 否则恢复备份会一直等待；恢复时数据库关闭，订阅随之结束
+func (h *Handler) registerWatchRoutes(g *gin.RouterGroup) {
+	g.GET("/watch", h.watchSSE)
+	g.GET("/watch/ws", h.watchWebSocket)
+}
+
+// newWatchEvent 把存储层的变更事件转换为响应格式
+func newWatchEvent(e storage.ChangeEvent) WatchEvent {
+	t := e.Time
+	return WatchEvent{
+		Type:    WatchTypeChange,
+		Token:   e.Token,
+		Seq:     e.Seq,
+		Op:      e.Op,
+		Key:     string(e.Key),
+		Version: e.Version,
+		Time:    &t,
+	}
+}
+
+// watchErrorEvent 返回订阅中途结束时发送给客户端的消息
+func watchErrorEvent(w *storage.Watcher, err error) WatchEvent {
+	return WatchEvent{
+		Type:    WatchTypeError,
+		Token:   w.Token(),
+		Message: err.Error(),
+	}
+}
+
+// startWatch 按prefix和恢复令牌建立订阅，失败时写入错误响应并返回nil
+func (h *Handler) startWatch(c *gin.Context, after string) *storage.Watcher {
+	prefix := c.Query("prefix")
+	w, err := h.db(c).Watch([]byte(prefix), after)
+	if err != nil {
+		logger.Warn("订阅变更失败",
+			zap.String("prefix", prefix),
+			zap.String("after", after),
+			zap.Error(err))
+		code := storageErrorStatus(err)
+		c.JSON(code, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to watch: " + err.Error(),
+			Code:    code,
+		})
+		return nil
+	}
+	return w
+}
+
+// watchSSE 以Server-Sent Events推送键以prefix开头的变更，事件id即恢复令牌，
+// 断线重连时浏览器会通过Last-Event-ID带回，也可以用after参数指定
+func (h *Handler) watchSSE(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	after := c.Query("after")
+	if after == "" {
+		after = c.GetHeader("Last-Event-ID")
+	}
+	w := h.startWatch(c, after)
+	if w == nil {
+		return
+	}
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Render(-1, sse.Event{Id: w.Token(), Event: WatchTypeReady, Data: WatchEvent{Type: WatchTypeReady, Token: w.Token()}})
+	c.Writer.Flush()
+
+	ctx, stop := h.streamContext(c.Request.Context())
+	defer stop()
+	for {
+		next, cancel := context.WithTimeout(ctx, watchHeartbeat)
+		e, err := w.Next(next)
+		cancel()
+		switch {
+		case err == nil:
+			c.Render(-1, sse.Event{Id: e.Token, Event: WatchTypeChange, Data: newWatchEvent(e)})
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			io.WriteString(c.Writer, ": ping\n\n")
+		case ctx.Err() != nil:
+			return
+		default:
+			c.Render(-1, sse.Event{Id: w.Token(), Event: WatchTypeError, Data: watchErrorEvent(w, err)})
+			c.Writer.Flush()
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// watchWebSocket 以WebSocket推送键以prefix开头的变更，每条消息是一个WatchEvent，
+// 第一条消息的type为ready；重连时用after参数传入最后收到的token
+func (h *Handler) watchWebSocket(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	w := h.startWatch(c, c.Query("after"))
+	if w == nil {
+		return
+	}
+
+	server := websocket.Server{
+		// 与CORSMiddleware一致，不限制来源
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			ctx, cancel := h.streamContext(context.Background())
+			defer cancel()
+			// 客户端只会发送关闭帧，读取失败说明连接已经断开
+			go func() {
+				io.Copy(io.Discard, conn)
+				cancel()
+			}()
+
+			if err := websocket.JSON.Send(conn, WatchEvent{Type: WatchTypeReady, Token: w.Token()}); err != nil {
+				return
+			}
+			for {
+				e, err := w.Next(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						websocket.JSON.Send(conn, watchErrorEvent(w, err))
+					}
+					return
+				}
+				if err := websocket.JSON.Send(conn, newWatchEvent(e)); err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
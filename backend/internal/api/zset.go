@@ -0,0 +1,231 @@
+package api
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/structures"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// zsetQuery 是有序集合范围查询的参数
+type zsetQuery struct {
+	byScore     bool
+	start, stop int64
+	scores      structures.ScoreRange
+	offset      int
+	limit       int
+	reverse     bool
+}
+
+// parseZSetQuery 解析有序集合范围查询的参数，给出min或max时按分数查询，否则按排名查询
+func parseZSetQuery(c *gin.Context) (zsetQuery, error) {
+	q := zsetQuery{stop: -1, scores: structures.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}}
+	var err error
+	if v := c.Query("reverse"); v != "" {
+		if q.reverse, err = strconv.ParseBool(v); err != nil {
+			return q, errors.New("reverse must be a boolean")
+		}
+	}
+
+	minValue, maxValue := c.Query("min"), c.Query("max")
+	if minValue == "" && maxValue == "" {
+		if q.start, err = strconv.ParseInt(c.DefaultQuery("start", "0"), 10, 64); err != nil {
+			return q, errors.New("start must be an integer")
+		}
+		if q.stop, err = strconv.ParseInt(c.DefaultQuery("stop", "-1"), 10, 64); err != nil {
+			return q, errors.New("stop must be an integer")
+		}
+		return q, nil
+	}
+
+	q.byScore = true
+	if minValue != "" {
+		if q.scores.Min, q.scores.MinExclusive, err = parseScoreBound(minValue); err != nil {
+			return q, errors.New("min must be a number, optionally prefixed with ( for an exclusive bound")
+		}
+	}
+	if maxValue != "" {
+		if q.scores.Max, q.scores.MaxExclusive, err = parseScoreBound(maxValue); err != nil {
+			return q, errors.New("max must be a number, optionally prefixed with ( for an exclusive bound")
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if q.offset, err = strconv.Atoi(v); err != nil || q.offset < 0 {
+			return q, errors.New("offset must be a non-negative integer")
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit <= 0 {
+			return q, errors.New("limit must be a positive integer")
+		}
+	}
+	return q, nil
+}
+
+// parseScoreBound 解析分数边界，以(开头表示不包含该分数，支持-inf和+inf
+func parseScoreBound(v string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(v, "(")
+	score, err := strconv.ParseFloat(strings.TrimPrefix(v, "("), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, errors.New("invalid score")
+	}
+	return score, exclusive, nil
+}
+
+func toZSetMembers(members []structures.ScoredMember) []ZSetMember {
+	result := make([]ZSetMember, len(members))
+	for i, m := range members {
+		result[i] = ZSetMember{Member: string(m.Member), Score: m.Score}
+	}
+	return result
+}
+
+// zsetRange 处理ZRANGE和ZRANGEBYSCORE请求
+func (h *Handler) zsetRange(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	q, err := parseZSetQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Status:  "error",
+			Message: "Invalid request: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	s := h.structs(c)
+	var members []structures.ScoredMember
+	if q.byScore {
+		members, err = s.ZRangeByScore([]byte(key), q.scores, q.offset, q.limit, q.reverse)
+	} else {
+		members, err = s.ZRange([]byte(key), q.start, q.stop, q.reverse)
+	}
+	if err != nil {
+		structureError(c, key, "get sorted set range", err)
+		return
+	}
+	count, err := s.ZCard([]byte(key))
+	if err != nil {
+		structureError(c, key, "get sorted set size", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   ZSetRangeResponse{Key: key, Members: toZSetMembers(members), Count: count},
+	})
+}
+
+// zsetAdd 处理ZADD请求
+func (h *Handler) zsetAdd(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key := c.Param("key")
+	var req ZAddRequest
+	if !bindStructureRequest(c, key, &req) {
+		return
+	}
+	members := make([]structures.ScoredMember, len(req.Members))
+	for i, m := range req.Members {
+		members[i] = structures.ScoredMember{Member: []byte(m.Member), Score: m.Score}
+	}
+	added, err := h.structs(c).ZAdd([]byte(key), members...)
+	if err != nil {
+		structureError(c, key, "add sorted set members", err)
+		return
+	}
+
+	logger.Info("添加有序集合成员成功", zap.String("key", key), zap.Int("added", added))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Members added successfully",
+		Data:    CountResponse{Key: key, Count: int64(added)},
+	})
+}
+
+// zsetScore 处理ZSCORE和ZRANK请求，返回成员的分数和排名
+func (h *Handler) zsetScore(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, member := c.Param("key"), c.Param("member")
+	reverse, _ := strconv.ParseBool(c.DefaultQuery("reverse", "false"))
+	s := h.structs(c)
+	score, err := s.ZScore([]byte(key), []byte(member))
+	if err != nil {
+		structureError(c, key, "get member score", err)
+		return
+	}
+	rank, err := s.ZRank([]byte(key), []byte(member), reverse)
+	if err != nil {
+		structureError(c, key, "get member rank", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Status: "success",
+		Data:   ZSetMemberResponse{Key: key, Member: member, Score: score, Rank: rank},
+	})
+}
+
+// zsetIncrBy 处理ZINCRBY请求
+func (h *Handler) zsetIncrBy(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, member := c.Param("key"), c.Param("member")
+	var req ZIncrByRequest
+	if !bindStructureRequest(c, key, &req) {
+		return
+	}
+	score, err := h.structs(c).ZIncrBy([]byte(key), []byte(member), *req.Delta)
+	if err != nil {
+		structureError(c, key, "increment member score", err)
+		return
+	}
+
+	logger.Info("更新有序集合成员分数", zap.String("key", key), zap.String("member", member), zap.Float64("score", score))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Score updated successfully",
+		Data:    ZSetMember{Member: member, Score: score},
+	})
+}
+
+// zsetRem 处理ZREM请求
+func (h *Handler) zsetRem(c *gin.Context) {
+	h.checkFastDBStatus(c)
+	if h.status != StatusRunning {
+		return
+	}
+
+	key, member := c.Param("key"), c.Param("member")
+	removed, err := h.structs(c).ZRem([]byte(key), []byte(member))
+	if err != nil {
+		structureError(c, key, "remove sorted set member", err)
+		return
+	}
+
+	logger.Info("移除有序集合成员", zap.String("key", key), zap.String("member", member), zap.Int("removed", removed))
+	c.JSON(http.StatusOK, Response{
+		Status:  "success",
+		Message: "Member removed",
+		Data:    CountResponse{Key: key, Count: int64(removed)},
+	})
+}
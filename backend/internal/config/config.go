@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 )
 
@@ -16,13 +18,179 @@ type Config struct {
 type ServerConfig struct {
 	Host string `json:"host"`
 	Port string `json:"port"`
+
+	// 兼容Redis协议的TCP服务，与HTTP服务监听同一个host
+	RespPort     string `json:"respPort"`     // 监听端口，空表示不启用
+	RespPassword string `json:"respPassword"` // 客户端需要先用AUTH提供的密码，空表示不需要认证
+
+	// GRPCAddr 是gRPC服务的监听地址，如 0.0.0.0:9090，空表示不启用
+	GRPCAddr string `json:"grpcAddr"`
 }
 
 // StorageConfig 包含存储的配置
 type StorageConfig struct {
-	Type      string `json:"type"`
-	Path      string `json:"path"`
-	CacheSize int    `json:"cacheSize"`
+	Type            string `json:"type"`            // 存储引擎：fastdb、bbolt、memory
+	Path            string `json:"path"`            // 数据目录，每个命名数据库位于其下的子目录
+	DefaultDatabase string `json:"defaultDatabase"` // /api/v1/kv 等路由使用的默认数据库
+	MaxBatchOps     int    `json:"maxBatchOps"`     // 单个批量写入允许的最大操作数，不超过MaxBatchOpsLimit
+	BackupDir       string `json:"backupDir"`       // 备份归档的存放目录
+
+	// 值缓存参数，仅对磁盘存储（fastdb、bbolt）生效
+	CacheSize     int   `json:"cacheSize"`     // 最多缓存的值的数量，0表示不启用缓存
+	CacheMaxBytes int64 `json:"cacheMaxBytes"` // 缓存占用的字节数上限，0表示只限制数量
+
+	// 过期键清理参数
+	ReapInterval  int `json:"reapInterval"`  // 后台清理过期键的间隔（秒）
+	ReapBatchSize int `json:"reapBatchSize"` // 每批最多清理的过期键数量
+
+	// 自动合并策略，仅对需要合并回收空间的引擎（fastdb）生效
+	MergeRatio    float64 `json:"mergeRatio"`    // 可回收空间占比超过该值时自动合并，0表示不启用
+	MergeInterval int     `json:"mergeInterval"` // 定期合并的间隔（秒），0表示不启用
+
+	// FullTextSearch 是否为键名和值维护全文索引，关闭后写入不再更新索引，重新开启时在后台重建
+	FullTextSearch bool `json:"fullTextSearch"`
+
+	// WatchBufferSize 是内存中保留的最近变更事件数，断线重连的订阅方可以从中补齐错过的事件
+	WatchBufferSize int `json:"watchBufferSize"`
+
+	// 版本历史：每个键保留最近的若干个版本，删除键不会清除历史，可以回滚
+	HistoryVersions int           `json:"historyVersions"` // 每个键保留的版本数（包括当前版本），0表示不保留
+	HistoryMaxAge   int           `json:"historyMaxAge"`   // 历史版本的最长保留时间（秒），0表示不限制
+	HistoryRules    []HistoryRule `json:"historyRules"`    // 按键前缀覆盖全局设置，最长的前缀优先
+
+	// Replication 是主从复制的设置
+	Replication ReplicationConfig `json:"replication"`
+
+	// 以下为FastDB引擎的调优参数
+	SegmentSize   int64  `json:"segmentSize"`   // 单个数据文件的大小（字节）
+	SyncWrites    bool   `json:"syncWrites"`    // 每次写入后是否立即持久化
+	BytesPerSync  uint   `json:"bytesPerSync"`  // 累计写入多少字节后持久化，0表示不启用
+	IndexType     string `json:"indexType"`     // 内存索引类型：btree、art、bptree
+	MMapAtStartup bool   `json:"mmapAtStartup"` // 启动时是否使用mmap加载数据文件
+}
+
+// HistoryRule 是对某个键前缀的版本历史设置
+type HistoryRule struct {
+	Prefix   string `json:"prefix"`
+	Versions int    `json:"versions"` // 0表示该前缀下的键不保留历史
+	MaxAge   int    `json:"maxAge"`
+}
+
+// ReplicationConfig 包含主从复制的配置。主节点为每个数据库记录带序号的复制日志，
+// 从节点从主节点拉取日志并应用到本地，拒绝客户端的写入
+type ReplicationConfig struct {
+	Role        string   `json:"role"`        // 空表示不参与复制，leader为主节点，follower为从节点
+	LeaderURL   string   `json:"leaderURL"`   // 主节点的地址，如 http://127.0.0.1:8080，从节点用它拉取日志并重定向写请求
+	LogSize     int      `json:"logSize"`     // 主节点为每个数据库保留的日志条数，落后更多的从节点需要重新加载快照
+	Databases   []string `json:"databases"`   // 从节点复制的数据库，空表示只复制默认数据库
+	PollTimeout int      `json:"pollTimeout"` // 从节点等待新日志的最长时间（秒）
+}
+
+// 复制角色
+const (
+	ReplicationRoleLeader   = "leader"
+	ReplicationRoleFollower = "follower"
+)
+
+// MaxBatchOpsLimit 是maxBatchOps允许的最大值。存储引擎不限制批量写入的操作数，
+// 由它限制单个批量写入连同附属记录占用的内存和复制日志的大小
+const MaxBatchOpsLimit = 100000
+
+// 支持的存储引擎
+const (
+	StorageTypeFastDB = "fastdb"
+	StorageTypeBBolt  = "bbolt"
+	StorageTypeMemory = "memory"
+)
+
+// 支持的索引类型
+const (
+	IndexTypeBTree  = "btree"
+	IndexTypeART    = "art"
+	IndexTypeBPTree = "bptree"
+)
+
+// Validate 校验存储配置
+func (c StorageConfig) Validate() error {
+	switch c.Type {
+	case StorageTypeFastDB, StorageTypeBBolt, StorageTypeMemory:
+	default:
+		return fmt.Errorf("unsupported storage type: %q", c.Type)
+	}
+	if c.Path == "" {
+		return errors.New("storage path is required")
+	}
+	if c.DefaultDatabase == "" {
+		return errors.New("storage defaultDatabase is required")
+	}
+	if c.BackupDir == "" {
+		return errors.New("storage backupDir is required")
+	}
+	if c.CacheSize < 0 {
+		return fmt.Errorf("invalid storage cacheSize: %d", c.CacheSize)
+	}
+	if c.CacheMaxBytes < 0 {
+		return fmt.Errorf("invalid storage cacheMaxBytes: %d", c.CacheMaxBytes)
+	}
+	if c.MaxBatchOps <= 0 || c.MaxBatchOps > MaxBatchOpsLimit {
+		return fmt.Errorf("invalid storage maxBatchOps: %d", c.MaxBatchOps)
+	}
+	if c.ReapInterval <= 0 {
+		return fmt.Errorf("invalid storage reapInterval: %d", c.ReapInterval)
+	}
+	if c.ReapBatchSize <= 0 {
+		return fmt.Errorf("invalid storage reapBatchSize: %d", c.ReapBatchSize)
+	}
+	if c.MergeRatio < 0 || c.MergeRatio > 1 {
+		return fmt.Errorf("invalid storage mergeRatio: %v", c.MergeRatio)
+	}
+	if c.MergeInterval < 0 {
+		return fmt.Errorf("invalid storage mergeInterval: %d", c.MergeInterval)
+	}
+	if c.HistoryVersions < 0 || c.HistoryMaxAge < 0 {
+		return fmt.Errorf("invalid storage history settings: versions %d, maxAge %d", c.HistoryVersions, c.HistoryMaxAge)
+	}
+	for _, rule := range c.HistoryRules {
+		if rule.Versions < 0 || rule.MaxAge < 0 {
+			return fmt.Errorf("invalid storage history rule for prefix %q", rule.Prefix)
+		}
+	}
+	if err := c.Replication.Validate(); err != nil {
+		return err
+	}
+	if c.WatchBufferSize < 0 {
+		return fmt.Errorf("invalid storage watchBufferSize: %d", c.WatchBufferSize)
+	}
+	if c.SegmentSize <= 0 {
+		return fmt.Errorf("invalid storage segmentSize: %d", c.SegmentSize)
+	}
+	switch c.IndexType {
+	case IndexTypeBTree, IndexTypeART, IndexTypeBPTree:
+	default:
+		return fmt.Errorf("unsupported storage indexType: %q", c.IndexType)
+	}
+	return nil
+}
+
+// Validate 校验复制配置
+func (c ReplicationConfig) Validate() error {
+	switch c.Role {
+	case "":
+	case ReplicationRoleLeader:
+		if c.LogSize <= 0 {
+			return fmt.Errorf("invalid replication logSize: %d", c.LogSize)
+		}
+	case ReplicationRoleFollower:
+		if c.LeaderURL == "" {
+			return errors.New("replication leaderURL is required for followers")
+		}
+		if c.PollTimeout <= 0 {
+			return fmt.Errorf("invalid replication pollTimeout: %d", c.PollTimeout)
+		}
+	default:
+		return fmt.Errorf("unsupported replication role: %q", c.Role)
+	}
+	return nil
 }
 
 // LogConfig 包含日志的配置
@@ -42,9 +210,24 @@ func Load() (*Config, error) {
 			Port: "8080",
 		},
 		Storage: StorageConfig{
-			Type:      "leveldb",
-			Path:      "./data",
-			CacheSize: 1024,
+			Type:            StorageTypeFastDB,
+			Path:            "./data",
+			DefaultDatabase: "default",
+			CacheSize:       1024,
+			CacheMaxBytes:   64 * 1024 * 1024,
+			MaxBatchOps:     1000,
+			BackupDir:       "./backups",
+			ReapInterval:    1,
+			ReapBatchSize:   100,
+			FullTextSearch:  true,
+			WatchBufferSize: 1024,
+			Replication: ReplicationConfig{
+				LogSize:     100000,
+				PollTimeout: 30,
+			},
+			SegmentSize:   256 * 1024 * 1024,
+			IndexType:     IndexTypeBTree,
+			MMapAtStartup: true,
 		},
 		Log: LogConfig{
 			Level:  "info",
@@ -72,9 +255,14 @@ func Load() (*Config, error) {
 		}
 	}
 
+	// 校验存储配置
+	if err := cfg.Storage.Validate(); err != nil {
+		return nil, err
+	}
+
 	// 确保存储路径存在
 	if err := os.MkdirAll(cfg.Storage.Path, 0755); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("create storage path %s: %w", cfg.Storage.Path, err)
 	}
 
 	// 确保日志路径存在
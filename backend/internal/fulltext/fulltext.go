@@ -0,0 +1,198 @@
+// Package fulltext 提供全文检索使用的分词和高亮。
+//
+// 字母和数字组成的连续片段作为一个词，统一转为小写；
+// 中日韩文字没有空格分隔，按字切分为单字和相邻两字的二元组，
+// 例如“数据库”得到“数”“据”“库”“数据”“据库”。查询时连续两个以上的汉字只使用二元组，
+// 这样不需要词典也能匹配任意位置的词，同时避免单字带来的大量误命中
+package fulltext
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTermBytes 是词的最大字节数，更长的片段（如哈希值、base64）不进入索引
+const maxTermBytes = 64
+
+// Token 是文本中的一个词及其在原文中的字节范围[Start, End)
+type Token struct {
+	Term       string
+	Start, End int
+}
+
+// isCJK 判断字符是否属于需要按字切分的文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenizer 逐个字符扫描文本，维护当前的单词和连续汉字
+type tokenizer struct {
+	text     string
+	unigrams bool // 连续两个以上的汉字是否同时输出单字
+	tokens   []Token
+
+	word      strings.Builder
+	wordStart int
+	wordEnd   int
+
+	// 当前连续的汉字，cjkStarts为每个字的起点，cjkEnd为最后一个字的终点
+	cjkRun    []rune
+	cjkStarts []int
+	cjkEnd    int
+}
+
+// Tokenize 切分文本用于建立索引，返回的词可能重复，顺序与原文一致
+func Tokenize(text string) []Token {
+	return tokenize(text, true)
+}
+
+// QueryTerms 切分查询，返回去重后的词
+func QueryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range tokenize(query, false) {
+		if !seen[t.Term] {
+			seen[t.Term] = true
+			terms = append(terms, t.Term)
+		}
+	}
+	return terms
+}
+
+func tokenize(text string, unigrams bool) []Token {
+	t := &tokenizer{text: text, unigrams: unigrams}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			t.flushWord()
+			t.flushCJK()
+		case isCJK(r):
+			t.flushWord()
+			t.cjkRun = append(t.cjkRun, unicode.ToLower(r))
+			t.cjkStarts = append(t.cjkStarts, i)
+			t.cjkEnd = i + size
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			t.flushCJK()
+			if t.word.Len() == 0 {
+				t.wordStart = i
+			}
+			t.word.WriteRune(unicode.ToLower(r))
+			t.wordEnd = i + size
+		default:
+			t.flushWord()
+			t.flushCJK()
+		}
+		i += size
+	}
+	t.flushWord()
+	t.flushCJK()
+	return t.tokens
+}
+
+func (t *tokenizer) flushWord() {
+	if t.word.Len() == 0 {
+		return
+	}
+	if t.word.Len() <= maxTermBytes {
+		t.tokens = append(t.tokens, Token{Term: t.word.String(), Start: t.wordStart, End: t.wordEnd})
+	}
+	t.word.Reset()
+}
+
+func (t *tokenizer) flushCJK() {
+	n := len(t.cjkRun)
+	if n == 0 {
+		return
+	}
+	end := func(i int) int {
+		if i+1 < n {
+			return t.cjkStarts[i+1]
+		}
+		return t.cjkEnd
+	}
+	for i := 0; i < n; i++ {
+		if n == 1 || t.unigrams {
+			t.tokens = append(t.tokens, Token{Term: string(t.cjkRun[i]), Start: t.cjkStarts[i], End: end(i)})
+		}
+		if i+1 < n {
+			t.tokens = append(t.tokens, Token{Term: string(t.cjkRun[i : i+2]), Start: t.cjkStarts[i], End: end(i + 1)})
+		}
+	}
+	t.cjkRun, t.cjkStarts = t.cjkRun[:0], t.cjkStarts[:0]
+}
+
+// Highlight 返回text中包含第一个命中词的片段，命中的词用<mark></mark>包围。
+// 片段最多maxRunes个字符，被截断的一端加上省略号；其余文本经过HTML转义，可以直接插入页面。
+// 没有命中时返回文本开头的片段，matched为false
+func Highlight(text string, terms []string, maxRunes int) (snippet string, matched bool) {
+	want := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		want[term] = true
+	}
+	var spans [][2]int
+	for _, t := range Tokenize(text) {
+		if want[t.Term] {
+			spans = append(spans, [2]int{t.Start, t.End})
+		}
+	}
+	spans = mergeSpans(spans)
+
+	// 窗口从第一个命中之前约四分之一长度处开始
+	start := 0
+	if len(spans) > 0 {
+		start = spans[0][0]
+		for back := maxRunes / 4; back > 0 && start > 0; back-- {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+	}
+	end := start
+	for n := 0; n < maxRunes && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, span := range spans {
+		s, e := max(span[0], start), min(span[1], end)
+		if s >= e {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:s]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[s:e]))
+		b.WriteString("</mark>")
+		pos = e
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), len(spans) > 0
+}
+
+// mergeSpans 按起点排序并合并重叠或相邻的范围，二元组之间会相互重叠
+func mergeSpans(spans [][2]int) [][2]int {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span[0] <= last[1] {
+			last[1] = max(last[1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
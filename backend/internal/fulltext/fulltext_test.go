@@ -0,0 +1,83 @@
+package fulltext_test
+
+import (
+	"FastDB-Web/internal/fulltext"
+	"reflect"
+	"testing"
+)
+
+func terms(tokens []fulltext.Token) []string {
+	result := make([]string, len(tokens))
+	for i, t := range tokens {
+		result[i] = t.Term
+	}
+	return result
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"user:42:Profile", []string{"user", "42", "profile"}},
+		{"Hello, Wörld! naïve_café", []string{"hello", "wörld", "naïve", "café"}},
+		{"数据库", []string{"数", "数据", "据", "据库", "库"}},
+		{"FastDB是数据库", []string{"fastdb", "是", "是数", "数", "数据", "据", "据库", "库"}},
+		{"一 二", []string{"一", "二"}},
+		{"カタカナ", []string{"カ", "カタ", "タ", "タカ", "カ", "カナ", "ナ"}},
+		{"bad\xffbyte", []string{"bad", "byte"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := terms(fulltext.Tokenize(tt.text)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	// 位置指向原文中的字节范围
+	text := "Go语言"
+	for _, tok := range fulltext.Tokenize(text) {
+		if tok.Term == "语言" && text[tok.Start:tok.End] != "语言" {
+			t.Errorf("token %q spans %q", tok.Term, text[tok.Start:tok.End])
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Active users active", []string{"active", "users"}},
+		{"数据库", []string{"数据", "据库"}},
+		{"库", []string{"库"}},
+		{"  ,. ", nil},
+	}
+	for _, tt := range tests {
+		if got := fulltext.QueryTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryTerms(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text     string
+		terms    []string
+		maxRunes int
+		want     string
+		matched  bool
+	}{
+		{"the quick brown fox", []string{"quick", "fox"}, 100, "the <mark>quick</mark> brown <mark>fox</mark>", true},
+		{"<b>Quick</b> & co", []string{"quick"}, 100, "&lt;b&gt;<mark>Quick</mark>&lt;/b&gt; &amp; co", true},
+		{"我们使用全文检索功能", fulltext.QueryTerms("全文检索"), 100, "我们使用<mark>全文检索</mark>功能", true},
+		{"aaaa bbbb cccc dddd target eeee ffff", []string{"target"}, 12, "…dd <mark>target</mark> ee…", true},
+		{"nothing here at all", []string{"missing"}, 7, "nothing…", false},
+	}
+	for _, tt := range tests {
+		got, matched := fulltext.Highlight(tt.text, tt.terms, tt.maxRunes)
+		if got != tt.want || matched != tt.matched {
+			t.Errorf("Highlight(%q, %q) = %q, %v, want %q, %v", tt.text, tt.terms, got, matched, tt.want, tt.matched)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package fastdbpb 是由kv.proto生成的gRPC接口代码，修改kv.proto后执行go generate重新生成
+package fastdbpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kv.proto
@@ -0,0 +1,225 @@
+// Package grpcapi 实现fastdb.v1.KV gRPC服务，与REST API共用数据库注册表和连接凭据
+package grpcapi
+
+import (
+	"FastDB-Web/global"
+	"FastDB-Web/internal/grpcapi/fastdbpb"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// 请求metadata中的键
+const (
+	metadataUsername  = "username"
+	metadataPassword  = "password"
+	metadataRequestID = "x-request-id"
+)
+
+// requestIDKey 是请求ID在context中的键
+type requestIDKey struct{}
+
+// Server 是gRPC服务
+type Server struct {
+	grpc    *grpc.Server
+	service *kvService
+}
+
+// NewServer 创建gRPC服务并注册KV服务
+func NewServer(dbs *storage.Registry) *Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StreamInterceptor(streamInterceptor),
+	)
+	service := &kvService{dbs: dbs, stopping: make(chan struct{})}
+	fastdbpb.RegisterKVServer(s, service)
+	return &Server{grpc: s, service: service}
+}
+
+// ListenAndServe 在addr上监听并处理请求，直到Shutdown被调用，此时返回nil
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在已打开的监听器上处理请求，直到Shutdown被调用，此时返回nil
+func (s *Server) Serve(ln net.Listener) error {
+	return s.grpc.Serve(ln)
+}
+
+// Shutdown 停止接受新的请求，结束所有Watch订阅并等待进行中的请求完成，
+// ctx结束时强制关闭所有连接
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.service.stop()
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// authenticate 校验metadata中的用户名和密码，凭据与REST API连接数据库时使用的相同
+func authenticate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	username, password := first(md, metadataUsername), first(md, metadataPassword)
+	if subtle.ConstantTimeCompare([]byte(username), []byte(global.G_FastDB_UserName)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(global.G_FastDB_Password)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+	return nil
+}
+
+// first 返回metadata中键的第一个值
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// withRequestID 把请求ID放入context，客户端没有通过x-request-id提供时生成一个。
+// 写入的历史版本会记录请求ID，与REST API相同
+func withRequestID(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := first(md, metadataRequestID)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID), requestID
+}
+
+// requestID 返回context中的请求ID
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// unaryInterceptor 对一元调用进行认证、恢复panic并记录日志
+func unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	start := time.Now()
+	ctx, id := withRequestID(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+		logCall(ctx, info.FullMethod, id, start, err)
+	}()
+	if err := authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor 对流式调用进行认证、恢复panic并记录日志
+func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	ctx, id := withRequestID(ss.Context())
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+		logCall(ctx, info.FullMethod, id, start, err)
+	}()
+	if err := authenticate(ctx); err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream 用带有请求ID的context替换流原来的context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// recovered 记录处理请求时发生的panic，并转换为INTERNAL错误返回给客户端
+func recovered(method string, r any) error {
+	stack := make([]byte, 4096)
+	length := runtime.Stack(stack, false)
+	logger.Error("gRPC请求处理发生panic",
+		zap.String("method", method),
+		zap.Any("error", r),
+		zap.ByteString("stack", stack[:length]))
+	return status.Error(codes.Internal, fmt.Sprint("internal error: ", r))
+}
+
+// logCall 记录一次调用的结果
+func logCall(ctx context.Context, method, requestID string, start time.Time, err error) {
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP = p.Addr.String()
+	}
+	fields := []zap.Field{
+		zap.String("requestID", requestID),
+		zap.String("clientIP", clientIP),
+		zap.String("method", method),
+		zap.Duration("latency", time.Since(start)),
+		zap.String("code", status.Code(err).String()),
+	}
+	switch status.Code(err) {
+	case codes.OK, codes.Canceled:
+		logger.Info("gRPC请求", fields...)
+	case codes.Internal, codes.Unknown:
+		logger.Error("gRPC请求处理出错", append(fields, zap.Error(err))...)
+	default:
+		logger.Warn("gRPC请求返回错误", append(fields, zap.Error(err))...)
+	}
+}
+
+// storageError 把存储层的错误转换为gRPC状态，与REST API的状态码对应
+func storageError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, storage.ErrKeyNotFound),
+		errors.Is(err, storage.ErrDatabaseNotFound):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrKeyIsEmpty),
+		errors.Is(err, storage.ErrReservedKey),
+		errors.Is(err, storage.ErrInvalidExpireAt),
+		errors.Is(err, storage.ErrInvalidDatabaseName),
+		errors.Is(err, storage.ErrInvalidResumeToken):
+		code = codes.InvalidArgument
+	case errors.Is(err, storage.ErrBatchTooLarge):
+		code = codes.ResourceExhausted
+	case errors.Is(err, storage.ErrReadOnlyReplica):
+		code = codes.FailedPrecondition
+	case errors.Is(err, storage.ErrResumeTokenExpired):
+		code = codes.OutOfRange
+	case errors.Is(err, storage.ErrFeedClosed):
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,317 @@
+package grpcapi_test
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/grpcapi"
+	"FastDB-Web/internal/grpcapi/fastdbpb"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fastdb-web-logs")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(dir, "error", false)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startServer 在随机端口上启动gRPC服务，返回它所用的数据库注册表、服务和客户端
+func startServer(t *testing.T) (*storage.Registry, *grpcapi.Server, fastdbpb.KVClient) {
+	t.Helper()
+	dbs, err := storage.NewRegistry(config.StorageConfig{
+		Type:            "memory",
+		Path:            t.TempDir(),
+		DefaultDatabase: "default",
+		MaxBatchOps:     10,
+		BackupDir:       t.TempDir(),
+		ReapInterval:    1,
+		ReapBatchSize:   100,
+		WatchBufferSize: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpcapi.NewServer(dbs)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+
+	cc, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		dbs.Close()
+	})
+	return dbs, srv, fastdbpb.NewKVClient(cc)
+}
+
+// authorized 返回携带连接凭据的context
+func authorized(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, "username", "root", "password", "root")
+}
+
+// expectCode 检查错误的gRPC状态码
+func expectCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("got %v (%v), want %v", got, err, want)
+	}
+}
+
+// scanKeys 读取Scan返回的全部键
+func scanKeys(t *testing.T, client fastdbpb.KVClient, req *fastdbpb.ScanRequest) []string {
+	t.Helper()
+	stream, err := client.Scan(authorized(t), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for {
+		kv, err := stream.Recv()
+		if err == io.EOF {
+			return keys
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(kv.Key))
+	}
+}
+
+func TestAuth(t *testing.T) {
+	_, _, client := startServer(t)
+
+	_, err := client.Get(context.Background(), &fastdbpb.GetRequest{Key: []byte("a")})
+	expectCode(t, err, codes.Unauthenticated)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "username", "root", "password", "wrong")
+	_, err = client.Get(ctx, &fastdbpb.GetRequest{Key: []byte("a")})
+	expectCode(t, err, codes.Unauthenticated)
+
+	stream, err := client.Scan(context.Background(), &fastdbpb.ScanRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectCode(t, err, codes.Unauthenticated)
+	stream, err = client.Scan(ctx, &fastdbpb.ScanRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectCode(t, err, codes.Unauthenticated)
+}
+
+func TestKV(t *testing.T) {
+	dbs, _, client := startServer(t)
+	ctx := authorized(t)
+
+	put, err := client.Put(ctx, &fastdbpb.PutRequest{
+		Key:    []byte("a"),
+		Value:  []byte("1"),
+		Expiry: &fastdbpb.PutRequest_TtlSeconds{TtlSeconds: 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put.Meta.Version != 1 || put.Meta.ExpireAt == nil {
+		t.Errorf("Put meta = %v", put.Meta)
+	}
+	_, err = client.Put(ctx, &fastdbpb.PutRequest{
+		Key:    []byte("a"),
+		Expiry: &fastdbpb.PutRequest_TtlSeconds{TtlSeconds: -1},
+	})
+	expectCode(t, err, codes.InvalidArgument)
+
+	got, err := client.Get(ctx, &fastdbpb.GetRequest{Key: []byte("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Value) != "1" || got.Meta.Size != 1 || got.Meta.ExpireAt == nil {
+		t.Errorf("Get = %v", got)
+	}
+	// 与HTTP API使用同一个数据库
+	if v, err := dbs.Default().Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Errorf("Get(a) = %q, %v", v, err)
+	}
+
+	_, err = client.Get(ctx, &fastdbpb.GetRequest{Key: []byte("missing")})
+	expectCode(t, err, codes.NotFound)
+	_, err = client.Get(ctx, &fastdbpb.GetRequest{Database: "nope", Key: []byte("a")})
+	expectCode(t, err, codes.NotFound)
+	_, err = client.Put(ctx, &fastdbpb.PutRequest{Value: []byte("1")})
+	expectCode(t, err, codes.InvalidArgument)
+
+	_, err = client.Delete(ctx, &fastdbpb.DeleteRequest{Key: []byte("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Delete(ctx, &fastdbpb.DeleteRequest{Key: []byte("a")})
+	expectCode(t, err, codes.NotFound)
+}
+
+func TestBatchWrite(t *testing.T) {
+	_, _, client := startServer(t)
+	ctx := authorized(t)
+
+	resp, err := client.BatchWrite(ctx, &fastdbpb.BatchWriteRequest{Ops: []*fastdbpb.BatchOp{
+		{Op: fastdbpb.BatchOp_OP_PUT, Key: []byte("a"), Value: []byte("1")},
+		{Op: fastdbpb.BatchOp_OP_PUT, Key: []byte("b"), Value: []byte("2")},
+		{Op: fastdbpb.BatchOp_OP_DELETE, Key: []byte("a")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Applied != 3 {
+		t.Errorf("Applied = %d, want 3", resp.Applied)
+	}
+	if keys := scanKeys(t, client, &fastdbpb.ScanRequest{}); fmt.Sprint(keys) != "[b]" {
+		t.Errorf("keys after batch = %v", keys)
+	}
+
+	// 任何一个操作不合法时整个批次都不生效
+	_, err = client.BatchWrite(ctx, &fastdbpb.BatchWriteRequest{Ops: []*fastdbpb.BatchOp{
+		{Op: fastdbpb.BatchOp_OP_PUT, Key: []byte("c"), Value: []byte("3")},
+		{Op: fastdbpb.BatchOp_OP_PUT, Value: []byte("4")},
+	}})
+	expectCode(t, err, codes.InvalidArgument)
+	_, err = client.BatchWrite(ctx, &fastdbpb.BatchWriteRequest{Ops: []*fastdbpb.BatchOp{
+		{Key: []byte("c")},
+	}})
+	expectCode(t, err, codes.InvalidArgument)
+	if keys := scanKeys(t, client, &fastdbpb.ScanRequest{}); fmt.Sprint(keys) != "[b]" {
+		t.Errorf("keys after rejected batch = %v", keys)
+	}
+
+	ops := make([]*fastdbpb.BatchOp, 11)
+	for i := range ops {
+		ops[i] = &fastdbpb.BatchOp{Op: fastdbpb.BatchOp_OP_PUT, Key: []byte(fmt.Sprint(i))}
+	}
+	_, err = client.BatchWrite(ctx, &fastdbpb.BatchWriteRequest{Ops: ops})
+	expectCode(t, err, codes.ResourceExhausted)
+}
+
+func TestScan(t *testing.T) {
+	dbs, _, client := startServer(t)
+
+	// 超过一批的键，验证分批遍历时不重复也不遗漏
+	db := dbs.Default()
+	const n = 600
+	var want []string
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("k%04d", i)
+		if err := db.Put([]byte(key), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, key)
+	}
+	if err := db.Put([]byte("other"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := scanKeys(t, client, &fastdbpb.ScanRequest{Prefix: []byte("k")})
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("Scan returned %d keys, want %d in order", len(keys), n)
+	}
+	keys = scanKeys(t, client, &fastdbpb.ScanRequest{Prefix: []byte("k"), Reverse: true, Limit: 300})
+	if len(keys) != 300 || keys[0] != "k0599" || keys[299] != "k0300" {
+		t.Errorf("reverse Scan returned %d keys from %v", len(keys), keys[:min(len(keys), 1)])
+	}
+	keys = scanKeys(t, client, &fastdbpb.ScanRequest{Start: []byte("k0598"), End: []byte("p")})
+	if fmt.Sprint(keys) != "[k0598 k0599 other]" {
+		t.Errorf("range Scan = %v", keys)
+	}
+
+	stream, err := client.Scan(authorized(t), &fastdbpb.ScanRequest{Prefix: []byte("o"), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := stream.Recv()
+	if err != nil || string(kv.Key) != "other" || kv.Value != nil {
+		t.Errorf("keys only Scan = %v, %v", kv, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dbs, srv, client := startServer(t)
+	ctx := authorized(t)
+
+	stream, err := client.Watch(ctx, &fastdbpb.WatchRequest{Prefix: []byte("w")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := header.Get("watch-token")
+	if len(token) != 1 || token[0] == "" {
+		t.Fatalf("watch-token = %v", token)
+	}
+
+	db := dbs.Default()
+	for _, key := range []string{"x", "w1"} {
+		if err := db.Put([]byte(key), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Op != fastdbpb.ChangeEvent_OP_PUT || string(e.Key) != "w1" || e.Version != 1 {
+		t.Errorf("event = %v", e)
+	}
+
+	// 用响应头中的令牌恢复订阅，补齐之后的事件
+	resumed, err := client.Watch(ctx, &fastdbpb.WatchRequest{Prefix: []byte("w"), After: token[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := resumed.Recv(); err != nil || string(e.Key) != "w1" {
+		t.Errorf("resumed event = %v, %v", e, err)
+	}
+	bad, err := client.Watch(ctx, &fastdbpb.WatchRequest{After: "bad"})
+	if err == nil {
+		_, err = bad.Recv()
+	}
+	expectCode(t, err, codes.InvalidArgument)
+
+	// 关闭服务时结束订阅，不需要等待超时
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectCode(t, err, codes.Unavailable)
+}
@@ -0,0 +1,274 @@
+package grpcapi
+
+import (
+	"FastDB-Web/internal/grpcapi/fastdbpb"
+	"FastDB-Web/internal/storage"
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// scanChunkSize 是Scan每次在读锁内读取的键值对数，发送给客户端时不持有锁，
+	// 慢速的客户端不会阻塞写入
+	scanChunkSize = 256
+	// watchTokenHeader 是Watch响应头中当前位置的恢复令牌
+	watchTokenHeader = "watch-token"
+)
+
+// kvService 实现fastdb.v1.KV，所有操作都映射到存储层的DB上
+type kvService struct {
+	fastdbpb.UnimplementedKVServer
+	dbs *storage.Registry
+
+	// stopping 在服务关闭时关闭，通知Watch订阅结束
+	stopOnce sync.Once
+	stopping chan struct{}
+}
+
+// stop 通知所有Watch订阅结束
+func (s *kvService) stop() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// database 返回请求的数据库，name为空时返回默认数据库
+func (s *kvService) database(name string) (*storage.DB, error) {
+	if name == "" {
+		name = s.dbs.DefaultName()
+	}
+	db, err := s.dbs.Get(name)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return db, nil
+}
+
+// keyMeta 转换存储层的元数据，meta为nil时返回nil
+func keyMeta(meta *storage.KeyMeta, expireAt time.Time) *fastdbpb.KeyMeta {
+	if meta == nil {
+		return nil
+	}
+	m := &fastdbpb.KeyMeta{
+		CreatedAt: timestamppb.New(meta.CreatedAt),
+		UpdatedAt: timestamppb.New(meta.UpdatedAt),
+		Version:   meta.Version,
+		Size:      int64(meta.Size),
+	}
+	if !expireAt.IsZero() {
+		m.ExpireAt = timestamppb.New(expireAt)
+	}
+	return m
+}
+
+// Get 获取键的值和元数据
+func (s *kvService) Get(ctx context.Context, req *fastdbpb.GetRequest) (*fastdbpb.GetResponse, error) {
+	db, err := s.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+	value, meta, err := db.GetWithMeta(req.Key)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	// 读取过期时间时键可能刚好被删除或过期，此时只是不返回过期时间
+	expireAt, _, _ := db.TTL(req.Key)
+	return &fastdbpb.GetResponse{Value: value, Meta: keyMeta(meta, expireAt)}, nil
+}
+
+// Put 设置键值，过期时间由ttl_seconds或expire_at指定
+func (s *kvService) Put(ctx context.Context, req *fastdbpb.PutRequest) (*fastdbpb.PutResponse, error) {
+	var expireAt time.Time
+	switch expiry := req.Expiry.(type) {
+	case *fastdbpb.PutRequest_TtlSeconds:
+		if expiry.TtlSeconds <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "ttl_seconds must be a positive number of seconds")
+		}
+		expireAt = time.Now().Add(time.Duration(expiry.TtlSeconds) * time.Second)
+	case *fastdbpb.PutRequest_ExpireAt:
+		if err := expiry.ExpireAt.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid expire_at: "+err.Error())
+		}
+		if expireAt = expiry.ExpireAt.AsTime(); !expireAt.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expire_at must be in the future")
+		}
+	}
+
+	db, err := s.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := db.Update(req.Key, func(cur *storage.Entry) (*storage.Mutation, error) {
+		return &storage.Mutation{Value: req.Value, ExpireAt: expireAt, RequestID: requestID(ctx)}, nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &fastdbpb.PutResponse{Meta: keyMeta(meta, expireAt)}, nil
+}
+
+// Delete 删除键
+func (s *kvService) Delete(ctx context.Context, req *fastdbpb.DeleteRequest) (*fastdbpb.DeleteResponse, error) {
+	db, err := s.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Update(req.Key, func(cur *storage.Entry) (*storage.Mutation, error) {
+		if cur == nil {
+			return nil, storage.ErrKeyNotFound
+		}
+		return &storage.Mutation{Delete: true, RequestID: requestID(ctx)}, nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &fastdbpb.DeleteResponse{}, nil
+}
+
+// BatchWrite 在一个批量写入中原子地提交所有操作
+func (s *kvService) BatchWrite(ctx context.Context, req *fastdbpb.BatchWriteRequest) (*fastdbpb.BatchWriteResponse, error) {
+	if len(req.Ops) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "ops are required")
+	}
+	db, err := s.database(req.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐个加入批量写入，任何一个操作不合法都放弃整个批次
+	batch := db.NewWriteBatchWithRequestID(requestID(ctx))
+	for i, op := range req.Ops {
+		switch op.Op {
+		case fastdbpb.BatchOp_OP_PUT:
+			err = batch.Put(op.Key, op.Value)
+		case fastdbpb.BatchOp_OP_DELETE:
+			err = batch.Delete(op.Key)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "op %d: unsupported op %s", i, op.Op)
+		}
+		if err != nil {
+			return nil, status.Errorf(status.Code(storageError(err)), "op %d: %v", i, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, storageError(err)
+	}
+	return &fastdbpb.BatchWriteResponse{Applied: int32(len(req.Ops))}, nil
+}
+
+// Scan 分批遍历键值对并流式返回。每批在读锁内读取，发送前释放锁，
+// 下一批从上一批最后一个键之后继续，因此遍历期间的写入可能只有部分可见
+func (s *kvService) Scan(req *fastdbpb.ScanRequest, stream grpc.ServerStreamingServer[fastdbpb.KeyValue]) error {
+	db, err := s.database(req.Database)
+	if err != nil {
+		return err
+	}
+
+	opts := storage.ScanOptions{
+		Prefix:   req.Prefix,
+		Start:    req.Start,
+		End:      req.End,
+		Reverse:  req.Reverse,
+		KeysOnly: req.KeysOnly,
+	}
+	remaining := req.Limit
+	for {
+		size := scanChunkSize
+		if req.Limit > 0 {
+			size = min(size, int(remaining))
+		}
+
+		// 遍历回调中的键和值只在回调内有效，需要复制
+		chunk := make([]*fastdbpb.KeyValue, 0, size)
+		err := db.Scan(opts, func(key, value []byte) bool {
+			kv := &fastdbpb.KeyValue{Key: bytes.Clone(key)}
+			if !req.KeysOnly {
+				kv.Value = bytes.Clone(value)
+			}
+			chunk = append(chunk, kv)
+			return len(chunk) < size
+		})
+		if err != nil {
+			return storageError(err)
+		}
+		for _, kv := range chunk {
+			if err := stream.Send(kv); err != nil {
+				return err
+			}
+		}
+
+		if len(chunk) < size {
+			return nil
+		}
+		if req.Limit > 0 {
+			if remaining -= uint32(len(chunk)); remaining == 0 {
+				return nil
+			}
+		}
+		last := chunk[len(chunk)-1].Key
+		if req.Reverse {
+			opts.End = last
+		} else {
+			opts.Start = append(bytes.Clone(last), 0)
+		}
+	}
+}
+
+// changeOps 把存储层的变更类型转换为ChangeEvent.Op
+var changeOps = map[string]fastdbpb.ChangeEvent_Op{
+	storage.ChangeOpPut:    fastdbpb.ChangeEvent_OP_PUT,
+	storage.ChangeOpDelete: fastdbpb.ChangeEvent_OP_DELETE,
+	storage.ChangeOpExpire: fastdbpb.ChangeEvent_OP_EXPIRE,
+}
+
+// Watch 订阅键的变更并流式推送，直到客户端取消、数据库关闭或服务关闭
+func (s *kvService) Watch(req *fastdbpb.WatchRequest, stream grpc.ServerStreamingServer[fastdbpb.ChangeEvent]) error {
+	db, err := s.database(req.Database)
+	if err != nil {
+		return err
+	}
+	w, err := db.Watch(req.Prefix, req.After)
+	if err != nil {
+		return storageError(err)
+	}
+	// 先发送响应头，客户端收到后即可确认订阅已经建立
+	if err := stream.SendHeader(metadata.Pairs(watchTokenHeader, w.Token())); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		e, err := w.Next(ctx)
+		if err != nil {
+			if stream.Context().Err() == nil && ctx.Err() != nil {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			return storageError(err)
+		}
+		err = stream.Send(&fastdbpb.ChangeEvent{
+			Token:   e.Token,
+			Seq:     e.Seq,
+			Op:      changeOps[e.Op],
+			Key:     e.Key,
+			Version: e.Version,
+			Time:    timestamppb.New(e.Time),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package jsondoc 实现对以JSON文档形式存储的值的局部读取和修改：
+// JSON Pointer（RFC 6901）、JSON Patch（RFC 6902）和JSON Merge Patch（RFC 7396）。
+//
+// 文档解析为map[string]any、[]any和json.Number组成的树，数字保持原始文本，
+// 修改后的文档重新编码为紧凑的JSON，对象的键按字典序输出
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotJSON 表示存储的值不是合法的JSON文档
+	ErrNotJSON = errors.New("value is not a valid JSON document")
+	// ErrInvalidPointer 表示JSON Pointer的语法不正确
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+	// ErrPathNotFound 表示JSON Pointer指向的位置不存在
+	ErrPathNotFound = errors.New("path not found in document")
+	// ErrInvalidPatch 表示补丁文档本身不合法
+	ErrInvalidPatch = errors.New("invalid patch document")
+	// ErrPatchConflict 表示补丁无法应用到当前文档，包括test操作失败
+	ErrPatchConflict = errors.New("patch cannot be applied to the document")
+)
+
+// Parse 解析一个JSON文档，数字解析为json.Number以保持精度
+func Parse(data []byte) (any, error) {
+	doc, err := decode(data)
+	if err != nil {
+		return nil, ErrNotJSON
+	}
+	return doc, nil
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	// 文档之后只允许有空白
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+	return doc, nil
+}
+
+// Marshal 把文档编码为紧凑的JSON，不转义HTML字符
+func Marshal(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ParsePointer 把JSON Pointer拆分为引用的各级名称，空字符串表示整个文档
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPointer
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// ~只能出现在转义序列~0和~1中
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 >= len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, ErrInvalidPointer
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// Get 返回pointer在doc中指向的值
+func Get(doc any, pointer string) (any, error) {
+	tokens, err := ParsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return get(doc, tokens)
+}
+
+func get(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		child, err := getChild(node, token)
+		if err != nil {
+			return nil, err
+		}
+		node = child
+	}
+	return node, nil
+}
+
+func getChild(node any, token string) (any, error) {
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		return child, nil
+	case []any:
+		i, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		return n[i], nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// arrayIndex 解析数组下标，下标必须是不带前导零的十进制数且不大于max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, ErrPathNotFound
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
+
+// update 把tokens最后一级交给fn处理，fn返回修改后的父容器，update返回修改后的整个文档
+func update(node any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	child, err := getChild(node, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		n[tokens[0]] = child
+	case []any:
+		i, _ := arrayIndex(tokens[0], len(n)-1)
+		n[i] = child
+	}
+	return node, nil
+}
+
+// equal 按JSON语义比较两个值，数字按数值比较
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, _, errX := big.ParseFloat(string(x), 10, 256, big.ToNearestEven)
+		fy, _, errY := big.ParseFloat(string(y), 10, 256, big.ToNearestEven)
+		if errX != nil || errY != nil {
+			return x == y
+		}
+		return fx.Cmp(fy) == 0
+	default:
+		return a == b
+	}
+}
+
+// clone 深拷贝一个值，copy操作需要避免源和目标共享同一个容器
+func clone(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, child := range x {
+			m[k] = clone(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(x))
+		for i, child := range x {
+			s[i] = clone(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
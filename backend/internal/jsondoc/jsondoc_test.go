@@ -0,0 +1,122 @@
+package jsondoc_test
+
+import (
+	"FastDB-Web/internal/jsondoc"
+	"errors"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	doc, err := jsondoc.Parse([]byte(`{"a":{"b":[10,{"c":1.50}]},"x/y":1,"m~n":2,"":3}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tests := []struct {
+		pointer string
+		want    string
+		err     error
+	}{
+		{"", `{"":3,"a":{"b":[10,{"c":1.50}]},"m~n":2,"x/y":1}`, nil},
+		{"/a/b", `[10,{"c":1.50}]`, nil},
+		{"/a/b/1/c", `1.50`, nil},
+		{"/x~1y", `1`, nil},
+		{"/m~0n", `2`, nil},
+		{"/", `3`, nil},
+		{"/a/b/2", "", jsondoc.ErrPathNotFound},
+		{"/a/b/01", "", jsondoc.ErrPathNotFound},
+		{"/a/missing", "", jsondoc.ErrPathNotFound},
+		{"/a/b/0/c", "", jsondoc.ErrPathNotFound},
+		{"a", "", jsondoc.ErrInvalidPointer},
+		{"/a~2", "", jsondoc.ErrInvalidPointer},
+	}
+	for _, tt := range tests {
+		v, err := jsondoc.Get(doc, tt.pointer)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Get(%q) error = %v, want %v", tt.pointer, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		got, err := jsondoc.Marshal(v)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("Get(%q) = %s, %v, want %s", tt.pointer, got, err, tt.want)
+		}
+	}
+
+	if _, err := jsondoc.Parse([]byte(`hello`)); !errors.Is(err, jsondoc.ErrNotJSON) {
+		t.Errorf("Parse(non-JSON) error = %v, want ErrNotJSON", err)
+	}
+	if _, err := jsondoc.Parse([]byte(`{} {}`)); !errors.Is(err, jsondoc.ErrNotJSON) {
+		t.Errorf("Parse(two documents) error = %v, want ErrNotJSON", err)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":[1]}]`, `{"a":1,"b":[1]}`, nil},
+		{"add null", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"insert into array", `[1,3]`, `[{"op":"add","path":"/1","value":2}]`, `[1,2,3]`, nil},
+		{"append to nested array", `{"a":{"b":[1]}}`, `[{"op":"add","path":"/a/b/-","value":2}]`, `{"a":{"b":[1,2]}}`, nil},
+		{"replace root", `{"a":1}`, `[{"op":"add","path":"","value":"x"}]`, `"x"`, nil},
+		{"remove", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, nil},
+		{"replace", `{"a":"<b>"}`, `[{"op":"replace","path":"/a","value":"&"}]`, `{"a":"&"}`, nil},
+		{"move", `{"a":{"b":1},"c":[]}`, `[{"op":"move","from":"/a/b","path":"/c/0"}]`, `{"a":{},"c":[1]}`, nil},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"test numbers", `{"a":1.0}`, `[{"op":"test","path":"/a","value":1}]`, `{"a":1.0}`, nil},
+		{"test failed", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, "", jsondoc.ErrPatchConflict},
+		{"atomic", `{"a":1}`, `[{"op":"remove","path":"/a"},{"op":"remove","path":"/a"}]`, "", jsondoc.ErrPatchConflict},
+		{"replace missing", `{}`, `[{"op":"replace","path":"/a","value":1}]`, "", jsondoc.ErrPatchConflict},
+		{"add index out of range", `[1]`, `[{"op":"add","path":"/2","value":1}]`, "", jsondoc.ErrPatchConflict},
+		{"move into child", `{"a":{}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, "", jsondoc.ErrPatchConflict},
+		{"unknown op", `{}`, `[{"op":"nope","path":"/a"}]`, "", jsondoc.ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, "", jsondoc.ErrInvalidPatch},
+		{"not an array", `{}`, `{"op":"add"}`, "", jsondoc.ErrInvalidPatch},
+		{"bad pointer", `{}`, `[{"op":"remove","path":"a"}]`, "", jsondoc.ErrInvalidPointer},
+		{"not json", `plain text`, `[]`, "", jsondoc.ErrNotJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsondoc.ApplyPatch([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ApplyPatch error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && string(got) != tt.want {
+				t.Errorf("ApplyPatch = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c","d":1}}`, `{"a":{"b":null,"e":[1]}}`, `{"a":{"d":1,"e":[1]}}`},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{`["a"]`, `{"a":{"b":null}}`, `{"a":{}}`},
+		{`{"a":1}`, `"x"`, `"x"`},
+	}
+	for _, tt := range tests {
+		got, err := jsondoc.MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("MergePatch(%s, %s) = %s, %v, want %s", tt.doc, tt.patch, got, err, tt.want)
+		}
+	}
+
+	if _, err := jsondoc.MergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, jsondoc.ErrInvalidPatch) {
+		t.Errorf("MergePatch(invalid patch) error = %v, want ErrInvalidPatch", err)
+	}
+	if _, err := jsondoc.MergePatch([]byte(`abc`), []byte(`{}`)); !errors.Is(err, jsondoc.ErrNotJSON) {
+		t.Errorf("MergePatch(non-JSON value) error = %v, want ErrNotJSON", err)
+	}
+}
@@ -0,0 +1,220 @@
+package jsondoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// operation 是JSON Patch中的一个操作，Value为nil表示请求中没有value成员
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyPatch 把JSON Patch（RFC 6902）应用到doc上并返回新文档。
+// 操作按顺序执行，任何一个失败时整个补丁都不生效
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	root, err := Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("%w (operation %d: %s)", err, i, op.Op)
+		}
+	}
+	return Marshal(root)
+}
+
+func (op operation) apply(doc any) (any, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+	path, err := ParsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+		cur, err := get(doc, path)
+		if err != nil {
+			return nil, conflict(err)
+		}
+		if !equal(cur, value) {
+			return nil, fmt.Errorf("%w: test failed at %q", ErrPatchConflict, *op.Path)
+		}
+		return doc, nil
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		from, err := ParsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value, err := get(doc, from)
+			if err != nil {
+				return nil, conflict(err)
+			}
+			return add(doc, path, clone(value))
+		}
+		if *op.From == *op.Path {
+			if _, err := get(doc, from); err != nil {
+				return nil, conflict(err)
+			}
+			return doc, nil
+		}
+		// 不能把一个值移动到它自己的子节点中
+		if strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrPatchConflict)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// conflict 把路径不存在转换为补丁冲突，补丁中引用不存在的位置属于应用失败
+func conflict(err error) error {
+	if err == ErrPathNotFound {
+		return fmt.Errorf("%w: %v", ErrPatchConflict, err)
+	}
+	return err
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	doc, err := update(doc, path, func(parent any, token string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[token] = value
+			return p, nil
+		case []any:
+			if token == "-" {
+				return append(p, value), nil
+			}
+			i, err := arrayIndex(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+	return doc, conflict(err)
+}
+
+func replace(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	doc, err := update(doc, path, func(parent any, token string) (any, error) {
+		if _, err := getChild(parent, token); err != nil {
+			return nil, err
+		}
+		switch p := parent.(type) {
+		case map[string]any:
+			p[token] = value
+		case []any:
+			i, _ := arrayIndex(token, len(p)-1)
+			p[i] = value
+		}
+		return parent, nil
+	})
+	return doc, conflict(err)
+}
+
+// remove 删除path指向的值，同时返回被删除的值
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrPatchConflict)
+	}
+	var removed any
+	doc, err := update(doc, path, func(parent any, token string) (any, error) {
+		value, err := getChild(parent, token)
+		if err != nil {
+			return nil, err
+		}
+		removed = value
+		switch p := parent.(type) {
+		case map[string]any:
+			delete(p, token)
+			return p, nil
+		default:
+			s := parent.([]any)
+			i, _ := arrayIndex(token, len(s)-1)
+			return append(s[:i], s[i+1:]...), nil
+		}
+	})
+	if err != nil {
+		return nil, nil, conflict(err)
+	}
+	return doc, removed, nil
+}
+
+// MergePatch 把JSON Merge Patch（RFC 7396）应用到doc上并返回新文档
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	root, err := Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(merge(root, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = merge(t[k], v)
+	}
+	return t
+}
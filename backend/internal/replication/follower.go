@@ -0,0 +1,341 @@
+// Package replication 实现从节点一侧的主从复制：从主节点拉取复制日志并应用到本地数据库，
+// 本地位置不再被主节点的日志覆盖时先加载主节点的快照
+package replication
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// logBatchSize 是每次请求最多拉取的日志条数
+	logBatchSize = 500
+	// maxRetryInterval 是连接主节点失败后重试间隔的上限，重试间隔从1秒开始逐次加倍
+	maxRetryInterval = 30 * time.Second
+	// requestSlack 是日志请求在长轮询等待时间之外允许的额外耗时
+	requestSlack = 30 * time.Second
+)
+
+// 从节点上一个数据库的复制状态
+const (
+	StateConnecting = "connecting" // 正在连接主节点
+	StateSnapshot   = "snapshot"   // 正在加载主节点的快照
+	StateStreaming  = "streaming"  // 正在应用日志
+	StateError      = "error"      // 上一次请求失败，等待重试
+)
+
+// 主节点快照响应中携带日志位置的响应头
+const (
+	HeaderEpoch = "X-Replication-Epoch"
+	HeaderSeq   = "X-Replication-Seq"
+)
+
+// DatabaseStatus 是从节点上一个数据库的复制状态
+type DatabaseStatus struct {
+	Database   string `json:"database"`
+	State      string `json:"state"`
+	Epoch      string `json:"epoch,omitempty"`
+	AppliedSeq uint64 `json:"appliedSeq"`
+	LeaderSeq  uint64 `json:"leaderSeq"` // 最近一次从主节点得知的最新日志序号
+	Lag        uint64 `json:"lag"`       // 落后的日志条数
+	// LagSeconds 是已应用的最后一条日志与主节点最新日志的写入时间之差，没有落后时为0
+	LagSeconds  float64    `json:"lagSeconds"`
+	LastContact *time.Time `json:"lastContact,omitempty"`
+	Snapshots   int        `json:"snapshots"` // 加载快照的次数
+	LastError   string     `json:"lastError,omitempty"`
+
+	appliedTime time.Time
+	leaderTime  time.Time
+}
+
+// Follower 在后台为每个被复制的数据库从主节点拉取并应用复制日志
+type Follower struct {
+	dbs       *storage.Registry
+	leaderURL string
+	id        string
+	wait      time.Duration
+	client    *http.Client
+
+	mu     sync.Mutex
+	status map[string]*DatabaseStatus
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// NewFollower 创建从节点的复制任务，id在主节点的复制状态中标识本节点
+func NewFollower(dbs *storage.Registry, cfg config.ReplicationConfig, id string) *Follower {
+	f := &Follower{
+		dbs:       dbs,
+		leaderURL: strings.TrimRight(cfg.LeaderURL, "/"),
+		id:        id,
+		wait:      time.Duration(cfg.PollTimeout) * time.Second,
+		client:    &http.Client{},
+		status:    make(map[string]*DatabaseStatus),
+	}
+	for _, name := range dbs.Replicated() {
+		f.status[name] = &DatabaseStatus{Database: name, State: StateConnecting}
+	}
+	return f
+}
+
+// Start 为每个被复制的数据库启动复制goroutine
+func (f *Follower) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	for name := range f.status {
+		f.done.Add(1)
+		go f.run(ctx, name)
+	}
+	logger.Info("启动复制",
+		zap.String("leader", f.leaderURL),
+		zap.Strings("databases", f.dbs.Replicated()))
+}
+
+// Stop 停止复制并等待所有复制goroutine退出
+func (f *Follower) Stop() {
+	if f.cancel == nil {
+		return
+	}
+	f.cancel()
+	f.done.Wait()
+}
+
+// Status 返回各个被复制的数据库的复制状态，按数据库名排列
+func (f *Follower) Status() []DatabaseStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := make([]DatabaseStatus, 0, len(f.status))
+	for _, name := range f.dbs.Replicated() {
+		if s, ok := f.status[name]; ok {
+			statuses = append(statuses, *s)
+		}
+	}
+	return statuses
+}
+
+// update 在锁内修改数据库的复制状态
+func (f *Follower) update(name string, fn func(s *DatabaseStatus)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.status[name]
+	fn(s)
+	s.Lag = 0
+	if s.LeaderSeq > s.AppliedSeq {
+		s.Lag = s.LeaderSeq - s.AppliedSeq
+	}
+	s.LagSeconds = 0
+	if s.Lag > 0 && !s.appliedTime.IsZero() && s.leaderTime.After(s.appliedTime) {
+		s.LagSeconds = s.leaderTime.Sub(s.appliedTime).Seconds()
+	}
+}
+
+// run 持续复制一个数据库，失败后按指数退避重试，直到ctx结束
+func (f *Follower) run(ctx context.Context, name string) {
+	defer f.done.Done()
+	retry := time.Second
+	for ctx.Err() == nil {
+		err := f.sync(ctx, name)
+		if err == nil {
+			retry = time.Second
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("复制失败，稍后重试",
+			zap.String("database", name),
+			zap.Duration("retry", retry),
+			zap.Error(err))
+		f.update(name, func(s *DatabaseStatus) {
+			s.State = StateError
+			s.LastError = err.Error()
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, maxRetryInterval)
+	}
+}
+
+// sync 拉取并应用一批日志，本地没有可用的位置时先加载快照
+func (f *Follower) sync(ctx context.Context, name string) error {
+	db, err := f.database(name)
+	if err != nil {
+		return err
+	}
+	pos, ok := db.ReplicaPosition()
+	if !ok {
+		return fmt.Errorf("database %s is not a replica", name)
+	}
+	if pos.Epoch == "" {
+		return f.bootstrap(ctx, name)
+	}
+
+	batch, err := f.fetchLog(ctx, name, pos)
+	if errors.Is(err, storage.ErrSnapshotRequired) {
+		logger.Info("复制位置已不在主节点的日志中，重新加载快照",
+			zap.String("database", name),
+			zap.String("epoch", pos.Epoch),
+			zap.Uint64("seq", pos.Seq))
+		return f.bootstrap(ctx, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f.update(name, func(s *DatabaseStatus) {
+		s.State = StateStreaming
+		s.Epoch, s.AppliedSeq = pos.Epoch, pos.Seq
+		s.LeaderSeq, s.leaderTime = batch.LastSeq, batch.LastTime
+		s.LastContact = &now
+		s.LastError = ""
+	})
+	for _, entry := range batch.Entries {
+		if err := db.ApplyLog(batch.Epoch, entry); err != nil {
+			if errors.Is(err, storage.ErrSnapshotRequired) {
+				return f.bootstrap(ctx, name)
+			}
+			return fmt.Errorf("apply entry %d: %w", entry.Seq, err)
+		}
+		f.update(name, func(s *DatabaseStatus) {
+			s.AppliedSeq, s.appliedTime = entry.Seq, entry.Time
+		})
+	}
+	return nil
+}
+
+// database 返回被复制的本地数据库，默认数据库以外的数据库不存在时创建
+func (f *Follower) database(name string) (*storage.DB, error) {
+	db, err := f.dbs.Get(name)
+	if errors.Is(err, storage.ErrDatabaseNotFound) {
+		db, err = f.dbs.Create(name)
+		if errors.Is(err, storage.ErrDatabaseExists) {
+			db, err = f.dbs.Get(name)
+		}
+	}
+	return db, err
+}
+
+// leaderRequest 向主节点发送GET请求
+func (f *Follower) leaderRequest(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.leaderURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, storage.ErrSnapshotRequired
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	return nil, fmt.Errorf("leader returned %d: %s", resp.StatusCode, body.Message)
+}
+
+// fetchLog 从主节点拉取pos之后的日志，没有新日志时主节点最多等待f.wait
+func (f *Follower) fetchLog(ctx context.Context, name string, pos storage.ReplicationPosition) (*storage.LogBatch, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.wait+requestSlack)
+	defer cancel()
+	query := url.Values{
+		"database": {name},
+		"epoch":    {pos.Epoch},
+		"after":    {strconv.FormatUint(pos.Seq, 10)},
+		"limit":    {strconv.Itoa(logBatchSize)},
+		"wait":     {strconv.Itoa(int(f.wait / time.Second))},
+		"follower": {f.id},
+	}
+	resp, err := f.leaderRequest(ctx, "/api/v1/replication/log", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data storage.LogBatch `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode replication log: %w", err)
+	}
+	return &body.Data, nil
+}
+
+// bootstrap 下载主节点的快照并替换本地数据库的全部数据。
+// 快照先写入临时文件，下载完成后才替换，下载中断不会影响本地数据
+func (f *Follower) bootstrap(ctx context.Context, name string) error {
+	f.update(name, func(s *DatabaseStatus) { s.State = StateSnapshot })
+
+	resp, err := f.leaderRequest(ctx, "/api/v1/replication/snapshot", url.Values{
+		"database": {name},
+		"follower": {f.id},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	pos := storage.ReplicationPosition{Epoch: resp.Header.Get(HeaderEpoch)}
+	if pos.Seq, err = strconv.ParseUint(resp.Header.Get(HeaderSeq), 10, 64); err != nil || pos.Epoch == "" {
+		return errors.New("leader returned a snapshot without a replication position")
+	}
+
+	tmp, err := os.CreateTemp("", "fastdb-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		return fmt.Errorf("download snapshot: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	records, err := f.dbs.LoadSnapshot(name, tmp, pos)
+	if err != nil {
+		return err
+	}
+	logger.Info("加载主节点快照",
+		zap.String("database", name),
+		zap.String("epoch", pos.Epoch),
+		zap.Uint64("seq", pos.Seq),
+		zap.Int("records", records))
+	now := time.Now()
+	f.update(name, func(s *DatabaseStatus) {
+		s.State = StateStreaming
+		s.Epoch, s.AppliedSeq, s.LeaderSeq = pos.Epoch, pos.Seq, pos.Seq
+		s.appliedTime, s.leaderTime = now, now
+		s.LastContact = &now
+		s.Snapshots++
+		s.LastError = ""
+	})
+	return nil
+}
@@ -0,0 +1,630 @@
+package resp
+
+import (
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// redisVersion 是INFO和HELLO中报告的Redis版本，客户端据此判断可以使用哪些命令和协议特性
+	redisVersion = "7.0.0"
+	// defaultUser 是Redis 6以上版本AUTH命令中的默认用户名
+	defaultUser = "default"
+	// defaultScanCount 是SCAN未指定COUNT时每次检查的键数
+	defaultScanCount = 10
+)
+
+// client 是一个RESP连接的状态
+type client struct {
+	server *Server
+	id     int64
+	addr   string
+	name   string
+	authed bool
+	out    *writer
+}
+
+// command 描述一个RESP命令
+type command struct {
+	handler func(c *client, args [][]byte)
+	// arity 与Redis的含义相同：正数表示参数个数（包括命令名）必须相等，负数表示至少为其绝对值
+	arity int
+	// noAuth 表示配置了密码时未认证的连接也可以执行
+	noAuth bool
+}
+
+// commands 是支持的命令，键为小写的命令名
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":   {handler: (*client).ping, arity: -1},
+		"auth":   {handler: (*client).auth, arity: -2, noAuth: true},
+		"hello":  {handler: (*client).hello, arity: -1, noAuth: true},
+		"info":   {handler: (*client).info, arity: -1},
+		"dbsize": {handler: (*client).dbsize, arity: 1},
+		"get":    {handler: (*client).get, arity: 2},
+		"set":    {handler: (*client).set, arity: -3},
+		"del":    {handler: (*client).del, arity: -2},
+		"exists": {handler: (*client).exists, arity: -2},
+		"mget":   {handler: (*client).mget, arity: -2},
+		"mset":   {handler: (*client).mset, arity: -3},
+		"incr":   {handler: (*client).incr, arity: 2},
+		"keys":   {handler: (*client).keys, arity: 2},
+		"scan":   {handler: (*client).scan, arity: -2},
+	}
+}
+
+// execute 执行一个命令并写出回复，返回true表示客户端发送了QUIT，回复后应关闭连接
+func (c *client) execute(args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		c.out.ok()
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		var b strings.Builder
+		fmt.Fprintf(&b, "ERR unknown command '%s', with args beginning with: ", printable(args[0]))
+		for _, arg := range args[1:min(len(args), 4)] {
+			fmt.Fprintf(&b, "'%s' ", printable(arg))
+		}
+		c.out.error(b.String())
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.wrongArgs(name)
+		return false
+	}
+	if !c.authed && !cmd.noAuth {
+		c.out.error("NOAUTH Authentication required.")
+		return false
+	}
+	cmd.handler(c, args)
+	return false
+}
+
+// wrongArgs 回复参数个数错误
+func (c *client) wrongArgs(name string) {
+	c.out.error("ERR wrong number of arguments for '" + name + "' command")
+}
+
+// syntaxError 回复语法错误
+func (c *client) syntaxError() {
+	c.out.error("ERR syntax error")
+}
+
+// storageError 把存储层的错误转换为对应的Redis错误
+func (c *client) storageError(cmd string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrReadOnlyReplica):
+		c.out.error("READONLY You can't write against a read only replica.")
+	case errors.Is(err, storage.ErrNotNumber):
+		c.out.error("ERR value is not an integer or out of range")
+	case errors.Is(err, storage.ErrNumberOverflow):
+		c.out.error("ERR increment or decrement would overflow")
+	case errors.Is(err, storage.ErrKeyIsEmpty),
+		errors.Is(err, storage.ErrReservedKey),
+		errors.Is(err, storage.ErrBatchTooLarge):
+		c.out.error("ERR " + err.Error())
+	default:
+		logger.Warn("RESP命令执行失败",
+			zap.String("command", cmd),
+			zap.String("client", c.addr),
+			zap.Error(err))
+		c.out.error("ERR " + err.Error())
+	}
+}
+
+// db 返回默认数据库，与HTTP API的 /api/v1/kv 使用同一个数据库
+func (c *client) db(cmd string) *storage.DB {
+	dbs := c.server.dbs
+	db, err := dbs.Get(dbs.DefaultName())
+	if err != nil {
+		c.storageError(cmd, err)
+		return nil
+	}
+	return db
+}
+
+// lookup 读取键的值，ok为false表示键不存在。空键和保留键不可能存在，同样视为不存在
+func lookup(db *storage.DB, key []byte) (value []byte, ok bool, err error) {
+	value, err = db.Get(key)
+	if errors.Is(err, storage.ErrKeyNotFound) ||
+		errors.Is(err, storage.ErrKeyIsEmpty) ||
+		errors.Is(err, storage.ErrReservedKey) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+// checkPassword 校验AUTH或HELLO AUTH提供的用户名和密码
+func (c *client) checkPassword(user, password []byte) bool {
+	return string(user) == defaultUser &&
+		subtle.ConstantTimeCompare(password, []byte(c.server.password)) == 1
+}
+
+// ping 处理 PING [message]
+func (c *client) ping(args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.out.simple("PONG")
+	case 2:
+		c.out.bulk(args[1])
+	default:
+		c.wrongArgs("ping")
+	}
+}
+
+// auth 处理 AUTH [username] password
+func (c *client) auth(args [][]byte) {
+	if len(args) > 3 {
+		c.syntaxError()
+		return
+	}
+	if c.server.password == "" {
+		c.out.error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+	user := []byte(defaultUser)
+	if len(args) == 3 {
+		user = args[1]
+	}
+	if !c.checkPassword(user, args[len(args)-1]) {
+		logger.Warn("RESP认证失败", zap.String("client", c.addr), zap.ByteString("user", user))
+		c.out.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.authed = true
+	c.out.ok()
+}
+
+// hello 处理 HELLO [protover [AUTH username password] [SETNAME clientname]]，
+// 切换协议版本并返回服务端信息
+func (c *client) hello(args [][]byte) {
+	proto := c.out.proto
+	if len(args) > 1 {
+		v, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			c.out.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			c.out.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+
+	var user, password, name []byte
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); {
+		case opt == "auth" && i+2 < len(args):
+			user, password = args[i+1], args[i+2]
+			i += 2
+		case opt == "setname" && i+1 < len(args):
+			name = args[i+1]
+			i++
+		default:
+			c.out.error("ERR Syntax error in HELLO option '" + string(printable(args[i])) + "'")
+			return
+		}
+	}
+	if user != nil {
+		if c.server.password == "" || !c.checkPassword(user, password) {
+			c.out.error("WRONGPASS invalid username-password pair or user is disabled.")
+			return
+		}
+		c.authed = true
+	}
+	if !c.authed {
+		c.out.error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+	if name != nil {
+		c.name = string(name)
+	}
+
+	c.out.proto = proto
+	c.out.mapHeader(7)
+	c.out.bulkString("server")
+	c.out.bulkString("redis")
+	c.out.bulkString("version")
+	c.out.bulkString(redisVersion)
+	c.out.bulkString("proto")
+	c.out.integer(int64(proto))
+	c.out.bulkString("id")
+	c.out.integer(c.id)
+	c.out.bulkString("mode")
+	c.out.bulkString("standalone")
+	c.out.bulkString("role")
+	if c.server.isReplica() {
+		c.out.bulkString("replica")
+	} else {
+		c.out.bulkString("master")
+	}
+	c.out.bulkString("modules")
+	c.out.array(0)
+}
+
+// get 处理 GET key
+func (c *client) get(args [][]byte) {
+	db := c.db("get")
+	if db == nil {
+		return
+	}
+	value, ok, err := lookup(db, args[1])
+	switch {
+	case err != nil:
+		c.storageError("get", err)
+	case !ok:
+		c.out.null()
+	default:
+		c.out.bulk(value)
+	}
+}
+
+// set 处理 SET key value [NX | XX] [EX seconds | PX milliseconds | KEEPTTL]。
+// 条件判断和写入在同一次Update中完成，NX或XX的条件不满足时回复空值
+func (c *client) set(args [][]byte) {
+	var nx, xx, keepTTL bool
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); {
+		case opt == "nx" && !xx:
+			nx = true
+		case opt == "xx" && !nx:
+			xx = true
+		case opt == "keepttl" && ttl == 0:
+			keepTTL = true
+		case (opt == "ex" || opt == "px") && ttl == 0 && !keepTTL && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.out.error("ERR value is not an integer or out of range")
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > int64(time.Duration(1<<62)/unit) {
+				c.out.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			c.syntaxError()
+			return
+		}
+	}
+
+	db := c.db("set")
+	if db == nil {
+		return
+	}
+	written := false
+	_, err := db.Update(args[1], func(cur *storage.Entry) (*storage.Mutation, error) {
+		if (nx && cur != nil) || (xx && cur == nil) {
+			return nil, nil
+		}
+		written = true
+		m := &storage.Mutation{Value: args[2], KeepTTL: keepTTL}
+		if ttl > 0 {
+			m.ExpireAt = time.Now().Add(ttl)
+		}
+		return m, nil
+	})
+	switch {
+	case err != nil:
+		c.storageError("set", err)
+	case !written:
+		c.out.null()
+	default:
+		c.out.ok()
+	}
+}
+
+// del 处理 DEL key [key ...]，回复实际删除的键数
+func (c *client) del(args [][]byte) {
+	db := c.db("del")
+	if db == nil {
+		return
+	}
+	var deleted int64
+	for _, key := range args[1:] {
+		_, err := db.Update(key, func(cur *storage.Entry) (*storage.Mutation, error) {
+			if cur == nil {
+				return nil, nil
+			}
+			deleted++
+			return &storage.Mutation{Delete: true}, nil
+		})
+		if err != nil && !errors.Is(err, storage.ErrKeyIsEmpty) && !errors.Is(err, storage.ErrReservedKey) {
+			c.storageError("del", err)
+			return
+		}
+	}
+	c.out.integer(deleted)
+}
+
+// exists 处理 EXISTS key [key ...]，重复的键重复计数
+func (c *client) exists(args [][]byte) {
+	db := c.db("exists")
+	if db == nil {
+		return
+	}
+	var n int64
+	for _, key := range args[1:] {
+		_, ok, err := lookup(db, key)
+		if err != nil {
+			c.storageError("exists", err)
+			return
+		}
+		if ok {
+			n++
+		}
+	}
+	c.out.integer(n)
+}
+
+// mget 处理 MGET key [key ...]，不存在的键回复空值
+func (c *client) mget(args [][]byte) {
+	db := c.db("mget")
+	if db == nil {
+		return
+	}
+	values := make([][]byte, len(args)-1)
+	found := make([]bool, len(args)-1)
+	for i, key := range args[1:] {
+		value, ok, err := lookup(db, key)
+		if err != nil {
+			c.storageError("mget", err)
+			return
+		}
+		values[i], found[i] = value, ok
+	}
+	c.out.array(len(values))
+	for i, value := range values {
+		if found[i] {
+			c.out.bulk(value)
+		} else {
+			c.out.null()
+		}
+	}
+}
+
+// mset 处理 MSET key value [key value ...]，所有键在一个批量写入中原子提交，并清除原有的过期时间
+func (c *client) mset(args [][]byte) {
+	if len(args)%2 == 0 {
+		c.wrongArgs("mset")
+		return
+	}
+	db := c.db("mset")
+	if db == nil {
+		return
+	}
+	batch := db.NewWriteBatch()
+	for i := 1; i < len(args); i += 2 {
+		if err := batch.Put(args[i], args[i+1]); err != nil {
+			c.storageError("mset", err)
+			return
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		c.storageError("mset", err)
+		return
+	}
+	c.out.ok()
+}
+
+// incr 处理 INCR key，键不存在时视为0，原有的过期时间保持不变
+func (c *client) incr(args [][]byte) {
+	db := c.db("incr")
+	if db == nil {
+		return
+	}
+	n, _, err := db.IncrBy(args[1], 1)
+	if err != nil {
+		c.storageError("incr", err)
+		return
+	}
+	c.out.integer(n)
+}
+
+// keys 处理 KEYS pattern，按键的顺序回复所有匹配的键
+func (c *client) keys(args [][]byte) {
+	db := c.db("keys")
+	if db == nil {
+		return
+	}
+	pattern := args[1]
+	var matched [][]byte
+	err := db.Scan(storage.ScanOptions{Prefix: literalPrefix(pattern), KeysOnly: true}, func(key, _ []byte) bool {
+		if matchPattern(pattern, key) {
+			matched = append(matched, bytes.Clone(key))
+		}
+		return true
+	})
+	if err != nil {
+		c.storageError("keys", err)
+		return
+	}
+	c.out.array(len(matched))
+	for _, key := range matched {
+		c.out.bulk(key)
+	}
+}
+
+// scan 处理 SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]。
+// 每次最多检查count个键，游标对应下一次开始的键，保存在服务端的游标表中
+func (c *client) scan(args [][]byte) {
+	id, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.out.error("ERR invalid cursor")
+		return
+	}
+	var pattern []byte
+	var typ string
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.syntaxError()
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil {
+				c.out.error("ERR value is not an integer or out of range")
+				return
+			}
+			if count < 1 {
+				c.syntaxError()
+				return
+			}
+		case "type":
+			typ = strings.ToLower(string(args[i+1]))
+		default:
+			c.syntaxError()
+			return
+		}
+	}
+
+	var start []byte
+	if id != 0 {
+		var ok bool
+		if start, ok = c.server.cursors.get(id); !ok {
+			c.out.error("ERR invalid cursor")
+			return
+		}
+	}
+	db := c.db("scan")
+	if db == nil {
+		return
+	}
+
+	// 遍历到的键都是字符串，TYPE为其他类型时遍历照常进行，但不会有键匹配。
+	// 遍历回调中的键只在回调内有效，需要复制
+	var matched [][]byte
+	var next []byte
+	examined := 0
+	opts := storage.ScanOptions{Prefix: literalPrefix(pattern), Start: start, KeysOnly: true}
+	err = db.Scan(opts, func(key, _ []byte) bool {
+		if examined == count {
+			next = bytes.Clone(key)
+			return false
+		}
+		examined++
+		if (pattern == nil || matchPattern(pattern, key)) && (typ == "" || typ == "string") {
+			matched = append(matched, bytes.Clone(key))
+		}
+		return true
+	})
+	if err != nil {
+		c.storageError("scan", err)
+		return
+	}
+
+	var cursor uint64
+	if next != nil {
+		cursor = c.server.cursors.put(next)
+	}
+	c.out.array(2)
+	c.out.bulkString(strconv.FormatUint(cursor, 10))
+	c.out.array(len(matched))
+	for _, key := range matched {
+		c.out.bulk(key)
+	}
+}
+
+// dbsize 处理 DBSIZE，回复未过期的键数
+func (c *client) dbsize(args [][]byte) {
+	db := c.db("dbsize")
+	if db == nil {
+		return
+	}
+	stats, err := db.DatabaseStats()
+	if err != nil {
+		c.storageError("dbsize", err)
+		return
+	}
+	c.out.integer(stats.Keys)
+}
+
+// info 处理 INFO [section ...]，回复server、clients、stats、replication和keyspace各节的信息
+func (c *client) info(args [][]byte) {
+	want := make(map[string]bool)
+	for _, arg := range args[1:] {
+		want[strings.ToLower(string(arg))] = true
+	}
+	all := len(want) == 0 || want["all"] || want["default"] || want["everything"]
+
+	s := c.server
+	var b strings.Builder
+	section := func(name string, fields ...string) {
+		if !all && !want[strings.ToLower(name)] {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + name + "\r\n")
+		for i := 0; i+1 < len(fields); i += 2 {
+			b.WriteString(fields[i] + ":" + fields[i+1] + "\r\n")
+		}
+	}
+
+	uptime := time.Since(s.started)
+	section("Server",
+		"redis_version", redisVersion,
+		"redis_mode", "standalone",
+		"server_name", "fastdb-web",
+		"os", runtime.GOOS,
+		"arch_bits", strconv.Itoa(strconv.IntSize),
+		"go_version", runtime.Version(),
+		"process_id", strconv.Itoa(os.Getpid()),
+		"tcp_port", s.port(),
+		"uptime_in_seconds", strconv.FormatInt(int64(uptime/time.Second), 10),
+		"uptime_in_days", strconv.FormatInt(int64(uptime/(24*time.Hour)), 10),
+	)
+	section("Clients",
+		"connected_clients", strconv.FormatInt(s.connected.Load(), 10),
+	)
+	section("Stats",
+		"total_connections_received", strconv.FormatInt(s.accepted.Load(), 10),
+		"total_commands_processed", strconv.FormatInt(s.processed.Load(), 10),
+	)
+	replication := []string{"role", "master"}
+	if s.isReplica() {
+		replication = []string{"role", "slave", "leader_url", s.dbs.Replication().LeaderURL}
+	}
+	section("Replication", replication...)
+
+	if all || want["keyspace"] {
+		db := c.db("info")
+		if db == nil {
+			return
+		}
+		stats, err := db.DatabaseStats()
+		if err != nil {
+			c.storageError("info", err)
+			return
+		}
+		section("Keyspace", "db0", fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", stats.Keys, stats.ExpiringKeys))
+	}
+	c.out.bulkString(b.String())
+}
@@ -0,0 +1,131 @@
+package resp
+
+import "sync"
+
+// maxCursors 是游标表中保留的游标数，超出时丢弃最早的游标，之后使用它会得到invalid cursor
+const maxCursors = 4096
+
+// matchPattern 按Redis的glob规则匹配键：*匹配任意个字节，?匹配一个字节，
+// [abc]、[^abc]、[a-z]匹配字符集合，\转义下一个字符
+func matchPattern(pattern, s []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			rest, ok := matchClass(pattern[1:], s[0])
+			if !ok {
+				return false
+			}
+			pattern, s = rest, s[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// matchClass 匹配[之后的字符集合，返回]之后的模式。缺少]时集合延续到模式末尾
+func matchClass(pattern []byte, c byte) ([]byte, bool) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return pattern, matched != negate
+}
+
+// literalPrefix 返回模式开头不含通配符的部分，遍历时只需要检查带有该前缀的键
+func literalPrefix(pattern []byte) []byte {
+	for i, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return pattern[:i]
+		}
+	}
+	return pattern
+}
+
+// cursorTable 保存SCAN游标对应的下一个键。游标是递增的整数，同一个游标可以重复使用，
+// 所有连接共享，客户端可以在连接池的不同连接上继续遍历；服务重启后游标失效
+type cursorTable struct {
+	mu    sync.Mutex
+	last  uint64
+	keys  map[uint64][]byte
+	order []uint64
+}
+
+func newCursorTable() *cursorTable {
+	return &cursorTable{keys: make(map[uint64][]byte)}
+}
+
+// put 保存下一次开始遍历的键并返回游标
+func (t *cursorTable) put(key []byte) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.order) >= maxCursors {
+		delete(t.keys, t.order[0])
+		t.order = t.order[1:]
+	}
+	t.last++
+	t.keys[t.last] = key
+	t.order = append(t.order, t.last)
+	return t.last
+}
+
+// get 返回游标对应的键
+func (t *cursorTable) get(id uint64) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok := t.keys[id]
+	return key, ok
+}
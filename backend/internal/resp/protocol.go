@@ -0,0 +1,236 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkLen 是单个参数的最大长度，与Redis的proto-max-bulk-len默认值相同
+	maxBulkLen = 512 << 20
+	// maxArgs 是单个命令的最大参数个数
+	maxArgs = 1 << 20
+	// maxInlineLen 是内联命令及协议中每一行的最大长度
+	maxInlineLen = 64 << 10
+	// maxUnauthArgs 和 maxUnauthBulkLen 是认证前命令的参数个数和参数长度上限，与Redis相同
+	maxUnauthArgs    = 10
+	maxUnauthBulkLen = 16 << 10
+	// initialArgs 和 initialBulkLen 是预先分配的参数个数和参数长度，
+	// 更大的命令随着数据到达再扩容，不按客户端声明的长度一次分配
+	initialArgs    = 1024
+	initialBulkLen = 16 << 10
+)
+
+// errProtocol 表示客户端发送的数据不符合RESP协议，连接会在回复错误后关闭
+var errProtocol = errors.New("protocol error")
+
+// readCommand 读取一个命令：RESP数组形式的多条批量字符串，或telnet等工具发送的以空格分隔的内联命令。
+// 空行返回空命令。authed为false时使用更小的参数个数和长度上限，未认证的连接不能让服务端分配大块内存
+func readCommand(r *bufio.Reader, authed bool) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return parseInline(line)
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	if !authed && n > maxUnauthArgs {
+		return nil, fmt.Errorf("%w: unauthenticated multibulk length", errProtocol)
+	}
+	args := make([][]byte, 0, min(max(n, 0), initialArgs))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, printable(line))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		if !authed && size > maxUnauthBulkLen {
+			return nil, fmt.Errorf("%w: unauthenticated bulk length", errProtocol)
+		}
+		arg, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk 读取size字节的批量字符串及结尾的\r\n，缓冲区随读到的数据增长
+func readBulk(r *bufio.Reader, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(min(size+2, initialBulkLen))
+	if _, err := io.CopyN(&buf, r, int64(size+2)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	b := buf.Bytes()
+	if b[size] != '\r' || b[size+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", errProtocol)
+	}
+	return b[:size], nil
+}
+
+// readLine 读取以\n结尾的一行并去掉行尾的\r\n
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// parseInline 按空格切分内联命令，支持双引号和单引号包围的参数
+func parseInline(line []byte) ([][]byte, error) {
+	var args [][]byte
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		var arg []byte
+		switch quote := line[i]; quote {
+		case '"', '\'':
+			i++
+			for ; i < len(line) && line[i] != quote; i++ {
+				if quote == '"' && line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					default:
+						arg = append(arg, line[i])
+					}
+					continue
+				}
+				arg = append(arg, line[i])
+			}
+			if i == len(line) {
+				return nil, fmt.Errorf("%w: unbalanced quotes in request", errProtocol)
+			}
+			i++
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			arg = line[start:i]
+		}
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// printable 把协议错误中引用的客户端数据截短
+func printable(b []byte) []byte {
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	return bytes.ToValidUTF8(b, []byte("?"))
+}
+
+// writer 按连接协商的协议版本写出回复，RESP3只在空值和映射上与RESP2不同
+type writer struct {
+	w     *bufio.Writer
+	proto int
+}
+
+// simple 写出简单字符串
+func (w *writer) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// ok 写出+OK
+func (w *writer) ok() {
+	w.simple("OK")
+}
+
+// error 写出错误，msg以错误码开头，如 ERR syntax error
+func (w *writer) error(msg string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(msg)
+	w.w.WriteString("\r\n")
+}
+
+// integer 写出整数
+func (w *writer) integer(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+// bulk 写出批量字符串
+func (w *writer) bulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// bulkString 写出批量字符串
+func (w *writer) bulkString(s string) {
+	w.bulk([]byte(s))
+}
+
+// null 写出空值，RESP2为空批量字符串
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("$-1\r\n")
+}
+
+// array 写出数组的头部，之后由调用方写出n个元素
+func (w *writer) array(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// mapHeader 写出映射的头部，之后由调用方依次写出n对键和值。RESP2没有映射，写成2n个元素的数组
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.w.WriteByte('%')
+		w.w.WriteString(strconv.Itoa(n))
+		w.w.WriteString("\r\n")
+		return
+	}
+	w.array(2 * n)
+}
@@ -0,0 +1,195 @@
+// Package resp 实现兼容Redis的RESP2/RESP3协议的TCP服务，
+// 在同一进程内与HTTP API共用默认数据库，可以直接使用redis-cli等现有工具访问
+package resp
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server 是RESP协议的TCP服务
+type Server struct {
+	dbs      *storage.Registry
+	password string
+	started  time.Time
+
+	cursors *cursorTable
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	done     sync.WaitGroup
+
+	// 统计信息，供INFO命令使用
+	connected atomic.Int64
+	accepted  atomic.Int64
+	processed atomic.Int64
+}
+
+// NewServer 创建RESP服务，password为空表示不需要AUTH
+func NewServer(dbs *storage.Registry, password string) *Server {
+	return &Server{
+		dbs:      dbs,
+		password: password,
+		started:  time.Now(),
+		cursors:  newCursorTable(),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 在addr上监听并处理连接，直到Shutdown被调用
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在已打开的监听器上处理连接，直到Shutdown被调用，此时返回nil
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.done.Add(1)
+		s.mu.Unlock()
+		s.accepted.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown 停止接受新连接并关闭所有连接，等待正在执行的命令结束，ctx结束时不再等待
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveConn 依次读取并执行连接上的命令。客户端连续发送的多个命令（pipeline）
+// 执行完后一起写回，读缓冲中没有剩余的命令时才刷新输出
+func (s *Server) serveConn(conn net.Conn) {
+	s.connected.Add(1)
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.connected.Add(-1)
+		s.done.Done()
+	}()
+
+	c := &client{
+		server: s,
+		id:     s.accepted.Load(),
+		addr:   conn.RemoteAddr().String(),
+		authed: s.password == "",
+		out:    &writer{w: bufio.NewWriter(conn), proto: 2},
+	}
+	br := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(br, c.authed)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.out.error("ERR Protocol error: " + strings.TrimPrefix(err.Error(), errProtocol.Error()+": "))
+				c.out.w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Debug("RESP连接读取失败", zap.String("client", c.addr), zap.Error(err))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.processed.Add(1)
+		quit := c.execute(args)
+		if br.Buffered() == 0 || quit {
+			if err := c.out.w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// isReplica 判断本节点是否为复制的从节点，从节点上被复制的数据库拒绝写入
+func (s *Server) isReplica() bool {
+	return s.dbs.Replication().Role == config.ReplicationRoleFollower
+}
+
+// port 返回监听的端口
+func (s *Server) port() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return "0"
+	}
+	if addr, ok := s.listener.Addr().(*net.TCPAddr); ok {
+		return strconv.Itoa(addr.Port)
+	}
+	return "0"
+}
@@ -0,0 +1,291 @@
+package resp_test
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/resp"
+	"FastDB-Web/internal/storage"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fastdb-web-logs")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(dir, "error", false)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// conn 是测试用的RESP客户端，把回复解码为Go值：简单字符串和批量字符串为string，
+// 错误为error，整数为int64，空值为nil，数组为[]any，映射为map[string]any
+type conn struct {
+	t  *testing.T
+	c  net.Conn
+	br *bufio.Reader
+}
+
+func (c *conn) do(args ...string) any {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.c.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.read()
+}
+
+func (c *conn) read() any {
+	c.t.Helper()
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '_':
+		return nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, buf); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]any, n)
+		for i := range items {
+			items[i] = c.read()
+		}
+		return items
+	case '%':
+		n, _ := strconv.Atoi(line[1:])
+		m := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			key := c.read().(string)
+			m[key] = c.read()
+		}
+		return m
+	}
+	c.t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+// startServer 在随机端口上启动RESP服务，返回它所用的数据库注册表和监听地址
+func startServer(t *testing.T, password string) (*storage.Registry, string) {
+	t.Helper()
+	dbs, err := storage.NewRegistry(config.StorageConfig{
+		Type:            "memory",
+		Path:            t.TempDir(),
+		DefaultDatabase: "default",
+		MaxBatchOps:     10,
+		BackupDir:       t.TempDir(),
+		ReapInterval:    1,
+		ReapBatchSize:   100,
+		WatchBufferSize: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := resp.NewServer(dbs, password)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		dbs.Close()
+	})
+	return dbs, ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *conn {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &conn{t: t, c: c, br: bufio.NewReader(c)}
+}
+
+// expect 比较回复的字符串形式，错误只比较开头的错误码
+func expect(t *testing.T, got any, want string) {
+	t.Helper()
+	if err, ok := got.(error); ok {
+		if !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("got error %q, want %q", err, want)
+		}
+		return
+	}
+	if s := fmt.Sprint(got); s != want {
+		t.Errorf("got %s, want %s", s, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dbs, addr := startServer(t, "")
+	c := dial(t, addr)
+
+	expect(t, c.do("PING"), "PONG")
+	expect(t, c.do("SET", "a", "1"), "OK")
+	expect(t, c.do("SET", "a", "2", "NX"), "<nil>")
+	expect(t, c.do("SET", "b", "2", "XX"), "<nil>")
+	expect(t, c.do("SET", "a", "3", "XX", "PX", "60000"), "OK")
+	expect(t, c.do("SET", "a", "3", "EX", "0"), "ERR invalid expire time")
+	expect(t, c.do("SET", "a", "3", "EX", "1", "PX", "1"), "ERR syntax error")
+	expect(t, c.do("GET", "a"), "3")
+	expect(t, c.do("GET", "missing"), "<nil>")
+	expect(t, c.do("INCR", "a"), "4")
+	expect(t, c.do("INCR", "n"), "1")
+	expect(t, c.do("MSET", "k1", "v1", "k2", "", "k3", "v3"), "OK")
+	expect(t, c.do("MSET", "k1"), "ERR wrong number of arguments")
+	expect(t, c.do("MGET", "k1", "missing", "k2"), "[v1 <nil> ]")
+	expect(t, c.do("EXISTS", "k1", "k1", "missing"), "2")
+	expect(t, c.do("DEL", "k3", "missing"), "1")
+	expect(t, c.do("DBSIZE"), "4")
+	expect(t, c.do("KEYS", "k*"), "[k1 k2]")
+	expect(t, c.do("KEYS", "[an]"), "[a n]")
+	expect(t, c.do("KEYS", "?[^1]"), "[k2]")
+	expect(t, c.do("NOPE", "x"), "ERR unknown command 'NOPE'")
+	expect(t, c.do("GET"), "ERR wrong number of arguments for 'get' command")
+
+	// INCR保留SET设置的过期时间
+	db := dbs.Default()
+	if _, ok, err := db.TTL([]byte("a")); err != nil || !ok {
+		t.Errorf("TTL(a) = %v, %v, want a TTL", ok, err)
+	}
+	// 与HTTP API使用同一个数据库
+	if v, err := db.Get([]byte("k1")); err != nil || string(v) != "v1" {
+		t.Errorf("Get(k1) = %q, %v", v, err)
+	}
+
+	// SCAN按COUNT分批遍历，游标为0时结束
+	var keys []string
+	cursor := "0"
+	for i := 0; ; i++ {
+		reply := c.do("SCAN", cursor, "MATCH", "*", "COUNT", "1").([]any)
+		for _, k := range reply[1].([]any) {
+			keys = append(keys, k.(string))
+		}
+		if cursor = reply[0].(string); cursor == "0" {
+			break
+		}
+		if i > 10 {
+			t.Fatal("SCAN did not finish")
+		}
+	}
+	if fmt.Sprint(keys) != "[a k1 k2 n]" {
+		t.Errorf("SCAN returned %v", keys)
+	}
+	expect(t, c.do("SCAN", "12345"), "ERR invalid cursor")
+
+	// RESP3的空值和映射
+	hello := c.do("HELLO", "3").(map[string]any)
+	if hello["proto"] != int64(3) || hello["role"] != "master" {
+		t.Errorf("HELLO 3 = %v", hello)
+	}
+	expect(t, c.do("GET", "missing"), "<nil>")
+	if info := c.do("INFO").(string); !strings.Contains(info, "db0:keys=4,expires=1") {
+		t.Errorf("INFO = %q", info)
+	}
+
+	// 内联命令和pipeline
+	c.c.Write([]byte("SET inline \"a b\"\r\nGET inline\r\n"))
+	expect(t, c.read(), "OK")
+	expect(t, c.read(), "a b")
+	expect(t, c.do("QUIT"), "OK")
+}
+
+func TestAuth(t *testing.T) {
+	_, addr := startServer(t, "secret")
+	c := dial(t, addr)
+
+	expect(t, c.do("GET", "a"), "NOAUTH")
+	expect(t, c.do("HELLO", "3"), "NOAUTH")
+	expect(t, c.do("AUTH", "wrong"), "WRONGPASS")
+	expect(t, c.do("AUTH", "secret"), "OK")
+	expect(t, c.do("GET", "a"), "<nil>")
+
+	c = dial(t, addr)
+	hello := c.do("HELLO", "3", "AUTH", "default", "secret").(map[string]any)
+	if hello["proto"] != int64(3) {
+		t.Errorf("HELLO 3 AUTH = %v", hello)
+	}
+	expect(t, c.do("SET", "a", "1"), "OK")
+}
+
+func TestProtocolLimits(t *testing.T) {
+	_, addr := startServer(t, "secret")
+	// maxLine 超过服务端允许的单行长度
+	const maxLine = 64<<10 + 1
+
+	// rejected 发送原始数据，检查回复的协议错误并且连接随后被关闭
+	rejected := func(raw, want string) {
+		t.Helper()
+		c := dial(t, addr)
+		if _, err := c.c.Write([]byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+		c.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		expect(t, c.read(), "ERR Protocol error: "+want)
+		if _, err := c.br.ReadByte(); err != io.EOF {
+			t.Errorf("after %q: read error = %v, want EOF", want, err)
+		}
+	}
+	// 认证前只接受很小的命令，不按声明的长度分配内存
+	rejected("*1048576\r\n", "unauthenticated multibulk length")
+	rejected("*2\r\n$4\r\nAUTH\r\n$536870912\r\n", "unauthenticated bulk length")
+	rejected("*2\r\n$4\r\nAUTH\r\n$"+strings.Repeat("1", maxLine)+"\r\n", "too big inline request")
+	rejected(strings.Repeat("a", maxLine)+"\r\n", "too big inline request")
+	rejected("*1\r\n$536870913\r\n", "invalid bulk length")
+
+	// 认证后可以发送大的参数
+	c := dial(t, addr)
+	expect(t, c.do("AUTH", "secret"), "OK")
+	large := strings.Repeat("v", 1<<20)
+	expect(t, c.do("SET", "large", large), "OK")
+	if got := c.do("GET", "large"); got != large {
+		t.Errorf("GET large returned %d bytes, want %d", len(fmt.Sprint(got)), len(large))
+	}
+	args := make([]string, 0, 101)
+	args = append(args, "DEL")
+	for i := 0; i < 100; i++ {
+		args = append(args, fmt.Sprint("k", i))
+	}
+	expect(t, c.do(args...), "0")
+}
@@ -0,0 +1,531 @@
+package storage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupFormatVersion 是备份归档格式的版本
+	backupFormatVersion = 1
+	// backupManifestName 是归档中清单文件的名称，总是归档的第一个文件
+	backupManifestName = "manifest.json"
+	// backupDataName 是归档中数据文件的名称
+	backupDataName = "data.kv"
+	// backupFileSuffix 是备份归档的文件后缀
+	backupFileSuffix = ".tar.gz"
+	// maxBackupRecordSize 限制单个键或值的大小，防止损坏的归档导致分配过大的内存
+	maxBackupRecordSize = 1 << 30
+)
+
+var (
+	// ErrInvalidBackup 表示备份归档不合法或校验失败
+	ErrInvalidBackup = errors.New("invalid backup archive")
+	// ErrBackupNotFound 表示备份归档不存在
+	ErrBackupNotFound = errors.New("backup not found")
+)
+
+// BackupManifest 描述备份归档的内容
+type BackupManifest struct {
+	Version     int          `json:"version"`
+	Database    string       `json:"database"`
+	StorageType string       `json:"storageType"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	Records     int          `json:"records"` // 数据文件中的记录数，包括内部记录
+	Files       []BackupFile `json:"files"`
+}
+
+// BackupFile 描述归档中的一个文件及其校验和
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupInfo 描述备份目录中的一个备份归档
+type BackupInfo struct {
+	File     string          `json:"file"`
+	Size     int64           `json:"size"`
+	Manifest *BackupManifest `json:"manifest,omitempty"`
+}
+
+// dumpChunkSize 是导出时每次从存储读取的记录数，写出记录时不持有任何锁
+const dumpChunkSize = 1024
+
+// Dump 把包括内部记录在内的全部数据写入w，返回写入的记录数。
+// 导出不阻塞写入，得到的是调用时刻的一致快照
+func (d *DB) Dump(w io.Writer) (int, error) {
+	d.dumpMu.Lock()
+	defer d.dumpMu.Unlock()
+	d.mu.Lock()
+	d.store.beginDump()
+	d.mu.Unlock()
+	return d.store.dump(w)
+}
+
+// dumpStore 包装DB的底层存储。导出进行期间，尚未导出的键在第一次被修改前记录其旧值，
+// 导出时用旧值代替存储中的新值，因此导出只需分批遍历存储，不需要在整个过程中持有DB的锁。
+// 记录的旧值占用的内存与导出期间修改的键数成正比
+type dumpStore struct {
+	KVStore
+
+	mu     sync.Mutex
+	active bool
+	cursor []byte               // 已经导出到的最后一个键，nil表示还没有导出任何键
+	saved  map[string]dumpSaved // 导出开始后被修改的、尚未导出的键 -> 导出开始时的值
+	err    error                // 记录旧值时读取存储失败
+}
+
+// dumpRecord 是导出中的一条记录
+type dumpRecord struct {
+	key, value []byte
+}
+
+// dumpSaved 是一个键在导出开始时的值，exists为false表示当时键不存在
+type dumpSaved struct {
+	value  []byte
+	exists bool
+}
+
+func newDumpStore(store KVStore) *dumpStore {
+	return &dumpStore{KVStore: store}
+}
+
+// Unwrap 返回被包装的存储
+func (s *dumpStore) Unwrap() KVStore {
+	return s.KVStore
+}
+
+// beginDump 开始一次导出，调用方必须持有DB的写锁，使导出从一个没有写入进行中的时刻开始
+func (s *dumpStore) beginDump() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active, s.cursor, s.saved, s.err = true, nil, make(map[string]dumpSaved), nil
+}
+
+// preserve 在修改key之前记录它在导出开始时的值
+func (s *dumpStore) preserve(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active || (s.cursor != nil && bytes.Compare(key, s.cursor) <= 0) {
+		return
+	}
+	if _, ok := s.saved[string(key)]; ok {
+		return
+	}
+	value, err := s.KVStore.Get(key)
+	switch {
+	case err == nil:
+		s.saved[string(key)] = dumpSaved{value: value, exists: true}
+	case errors.Is(err, ErrKeyNotFound):
+		s.saved[string(key)] = dumpSaved{}
+	case s.err == nil:
+		s.err = err
+	}
+}
+
+// dump 分批遍历存储并把导出开始时的数据写入w，复制日志和复制位置只对本节点有意义，不会导出
+func (s *dumpStore) dump(w io.Writer) (int, error) {
+	defer func() {
+		s.mu.Lock()
+		s.active, s.cursor, s.saved = false, nil, nil
+		s.mu.Unlock()
+	}()
+
+	replPrefix := internalKey(replicationNamespace, nil)
+	count := 0
+	write := func(records []dumpRecord) error {
+		for _, r := range records {
+			if bytes.HasPrefix(r.key, replPrefix) {
+				continue
+			}
+			if err := writeDumpRecord(w, r.key, r.value); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}
+
+	var opts ScanOptions
+	for {
+		var chunk []dumpRecord
+		err := s.KVStore.Scan(opts, func(key []byte, value []byte) bool {
+			chunk = append(chunk, dumpRecord{cloneBytes(key), cloneBytes(value)})
+			return len(chunk) < dumpChunkSize
+		})
+		if err != nil {
+			return count, err
+		}
+
+		// 读取之后被修改过的键使用记录的旧值，导出开始后才写入的键不导出
+		s.mu.Lock()
+		records := chunk[:0]
+		for _, r := range chunk {
+			if saved, ok := s.saved[string(r.key)]; ok {
+				delete(s.saved, string(r.key))
+				if !saved.exists {
+					continue
+				}
+				r.value = saved.value
+			}
+			records = append(records, r)
+		}
+		if len(chunk) > 0 {
+			s.cursor = chunk[len(chunk)-1].key
+		}
+		err = s.err
+		s.mu.Unlock()
+		if err != nil {
+			return count, err
+		}
+		if err := write(records); err != nil {
+			return count, err
+		}
+		if len(chunk) < dumpChunkSize {
+			break
+		}
+		opts.Start = append(cloneBytes(chunk[len(chunk)-1].key), 0)
+	}
+
+	// 剩下的是导出开始后被删除、遍历时已经不在存储中的键
+	s.mu.Lock()
+	var records []dumpRecord
+	for key, saved := range s.saved {
+		if saved.exists {
+			records = append(records, dumpRecord{[]byte(key), saved.value})
+		}
+	}
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return count, err
+	}
+	return count, write(records)
+}
+
+// Put 在写入前记录旧值
+func (s *dumpStore) Put(key, value []byte) error {
+	s.preserve(key)
+	return s.KVStore.Put(key, value)
+}
+
+// Delete 在删除前记录旧值
+func (s *dumpStore) Delete(key []byte) error {
+	s.preserve(key)
+	return s.KVStore.Delete(key)
+}
+
+// NewWriteBatch 创建一个在加入操作时记录旧值的批量写入
+func (s *dumpStore) NewWriteBatch() WriteBatch {
+	return &dumpWriteBatch{WriteBatch: s.KVStore.NewWriteBatch(), store: s}
+}
+
+type dumpWriteBatch struct {
+	WriteBatch
+	store *dumpStore
+}
+
+func (b *dumpWriteBatch) Put(key, value []byte) error {
+	b.store.preserve(key)
+	return b.WriteBatch.Put(key, value)
+}
+
+func (b *dumpWriteBatch) Delete(key []byte) error {
+	b.store.preserve(key)
+	return b.WriteBatch.Delete(key)
+}
+
+// writeDumpRecord 写出一条记录：uvarint(键长度) 键 uvarint(值长度) 值
+func writeDumpRecord(w io.Writer, key, value []byte) error {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+len(key)+len(value))
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	buf = append(buf, value...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readDumpRecord 读取一条记录，没有更多记录时返回io.EOF
+func readDumpRecord(r *bufio.Reader) (key, value []byte, err error) {
+	if key, err = readDumpField(r); err != nil {
+		return nil, nil, err
+	}
+	if value, err = readDumpField(r); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+func readDumpField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBackupRecordSize {
+		return nil, ErrInvalidBackup
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// loadDump 把Dump导出的记录按批写入存储，返回写入的记录数
+func loadDump(store KVStore, r io.Reader, batchSize int) (int, error) {
+	br := bufio.NewReader(r)
+	count := 0
+	batch := store.NewWriteBatch()
+	pending := 0
+	for {
+		key, value, err := readDumpRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := batch.Put(key, value); err != nil {
+			return count, err
+		}
+		count++
+		if pending++; pending == batchSize {
+			if err := batch.Commit(); err != nil {
+				return count, err
+			}
+			batch, pending = store.NewWriteBatch(), 0
+		}
+	}
+	if pending > 0 {
+		if err := batch.Commit(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// writeBackup 把数据库导出为path处的备份归档
+func writeBackup(db *DB, database, storageType, path string) (*BackupManifest, error) {
+	dir := filepath.Dir(path)
+
+	// 先把数据导出到临时文件，得到大小和校验和后再写入归档
+	dump, err := os.CreateTemp(dir, ".dump-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		dump.Close()
+		os.Remove(dump.Name())
+	}()
+
+	hash := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(dump, hash))
+	manifest := &BackupManifest{
+		Version:     backupFormatVersion,
+		Database:    database,
+		StorageType: storageType,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if manifest.Records, err = db.Dump(bw); err != nil {
+		return nil, fmt.Errorf("dump database %s: %w", database, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	size, err := dump.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Files = []BackupFile{{
+		Name:   backupDataName,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}}
+	if _, err := dump.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// 归档先写入临时文件，完成后再重命名，避免留下不完整的归档
+	tmp := path + ".tmp"
+	if err := writeBackupArchive(tmp, manifest, dump, size); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBackupArchive 依次写入清单和数据文件
+func writeBackupArchive(path string, manifest *BackupManifest, data io.Reader, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0644,
+		Size:    int64(len(manifestJSON)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifestJSON); err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    backupDataName,
+		Mode:    0644,
+		Size:    size,
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readBackupManifest 只读取归档开头的清单
+func readBackupManifest(path string) (*BackupManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	tr := tar.NewReader(gr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if hdr.Name != backupManifestName {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupManifestName)
+	}
+	return decodeBackupManifest(tr)
+}
+
+func decodeBackupManifest(r io.Reader) (*BackupManifest, error) {
+	var manifest BackupManifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if manifest.Version != backupFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// extractBackup 校验归档并把数据文件解压到dir下的临时文件，返回清单和临时文件路径
+func extractBackup(path, dir string) (*BackupManifest, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return nil, "", fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupManifestName)
+	}
+	manifest, err := decodeBackupManifest(tr)
+	if err != nil {
+		return nil, "", err
+	}
+	var expected *BackupFile
+	for i := range manifest.Files {
+		if manifest.Files[i].Name == backupDataName {
+			expected = &manifest.Files[i]
+		}
+	}
+	if expected == nil {
+		return nil, "", fmt.Errorf("%w: manifest does not list %s", ErrInvalidBackup, backupDataName)
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != backupDataName {
+		return nil, "", fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupDataName)
+	}
+	dump, err := os.CreateTemp(dir, ".restore-*")
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dump, hash), tr)
+	if closeErr := dump.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && (size != expected.Size || hex.EncodeToString(hash.Sum(nil)) != expected.SHA256) {
+		err = fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidBackup, backupDataName)
+	}
+	if err != nil {
+		os.Remove(dump.Name())
+		return nil, "", err
+	}
+	return manifest, dump.Name(), nil
+}
+
+// backupFileName 生成备份归档的文件名
+func backupFileName(database string, now time.Time) string {
+	return database + "-" + now.UTC().Format("20060102-150405.000") + backupFileSuffix
+}
+
+// validateBackupFile 校验备份文件名，只允许备份目录下的归档
+func validateBackupFile(file string) error {
+	if file != filepath.Base(file) || strings.HasPrefix(file, ".") || !strings.HasSuffix(file, backupFileSuffix) {
+		return fmt.Errorf("%w: bad file name %q", ErrInvalidBackup, file)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltFileName 是bbolt数据文件在数据目录下的文件名
+	boltFileName = "data.bolt"
+	// boltOpenTimeout 是等待数据文件锁的最长时间
+	boltOpenTimeout = time.Second
+)
+
+// boltDataBucket 存放所有用户键
+var boltDataBucket = []byte("data")
+
+// errInvalidInternalKey 表示内部键不符合 0x00+命名空间+0x00+键 的格式
+var errInvalidInternalKey = errors.New("invalid internal key")
+
+// BoltStore 是基于bbolt的KV存储实现。用户键存放在data bucket中，
+// 每个内部命名空间对应一个以 0x00+命名空间+0x00 命名的bucket，
+// 按bucket名的顺序依次遍历即可得到与单一键空间相同的字典序
+type BoltStore struct {
+	db     *bolt.DB
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBoltStore 根据存储配置打开bbolt数据文件，每次提交都会持久化到磁盘
+func NewBoltStore(cfg config.StorageConfig) (*BoltStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(cfg.Path, boltFileName)
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bbolt at %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltDataBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// boltLocate 返回键所在的bucket以及它在bucket内的键
+func boltLocate(key []byte) (bucket, sub []byte, err error) {
+	if len(key) == 0 {
+		return nil, nil, ErrKeyIsEmpty
+	}
+	if !isInternalKey(key) {
+		return boltDataBucket, key, nil
+	}
+	i := bytes.IndexByte(key[1:], internalKeyPrefix) + 2
+	if i < 2 || i == len(key) {
+		return nil, nil, errInvalidInternalKey
+	}
+	return key[:i], key[i:], nil
+}
+
+// Get 获取键对应的值
+func (s *BoltStore) Get(key []byte) ([]byte, error) {
+	bucket, sub, err := boltLocate(key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+
+	var value []byte
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return ErrKeyNotFound
+		}
+		v := b.Get(sub)
+		if v == nil {
+			return ErrKeyNotFound
+		}
+		// bbolt返回的切片只在事务内有效
+		value = append(make([]byte, 0, len(v)), v...)
+		return nil
+	})
+	return value, err
+}
+
+// Put 设置键值对
+func (s *BoltStore) Put(key, value []byte) error {
+	b := s.NewWriteBatch()
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+// Delete 删除键值对，键不存在时不返回错误
+func (s *BoltStore) Delete(key []byte) error {
+	b := s.NewWriteBatch()
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+// Fold 按键的顺序遍历所有键值对
+func (s *BoltStore) Fold(f func(key []byte, value []byte) bool) error {
+	return s.Scan(ScanOptions{}, f)
+}
+
+// GetListKeys 按顺序获取所有的键
+func (s *BoltStore) GetListKeys() [][]byte {
+	var keys [][]byte
+	s.Scan(ScanOptions{}, func(key []byte, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Scan 在一个只读事务中按序遍历满足条件的键值对，f中不能写入同一个存储
+func (s *BoltStore) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		// 内部命名空间的bucket名以0x00开头，排在data bucket之前
+		var names [][]byte
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if isInternalKey(name) {
+				names = append(names, name)
+			}
+			return nil
+		})
+		names = append(names, boltDataBucket)
+		if opts.Reverse {
+			for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+				names[i], names[j] = names[j], names[i]
+			}
+		}
+
+		for _, name := range names {
+			// data bucket中的键就是存储键，命名空间bucket中的键需要加上bucket名
+			var base []byte
+			if isInternalKey(name) {
+				base = name
+			}
+			if !scanBoltBucket(tx.Bucket(name).Cursor(), base, opts, f) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// scanBoltBucket 遍历bucket中满足条件的键，返回false表示整个遍历已经结束
+func scanBoltBucket(c *bolt.Cursor, base []byte, opts ScanOptions, f func(key []byte, value []byte) bool) bool {
+	var k, v []byte
+	if opts.Reverse {
+		// 逆序时前缀的上界同样可以作为遍历终点
+		end := opts.End
+		if limit := PrefixEnd(opts.Prefix); limit != nil && (len(end) == 0 || bytes.Compare(limit, end) < 0) {
+			end = limit
+		}
+		k, v = seekBoltLast(c, base, end)
+	} else {
+		pivot := opts.Start
+		if bytes.Compare(opts.Prefix, pivot) > 0 {
+			pivot = opts.Prefix
+		}
+		k, v = seekBoltFirst(c, base, pivot)
+	}
+
+	for ; k != nil; k, v = boltStep(c, opts.Reverse) {
+		key := append(append(make([]byte, 0, len(base)+len(k)), base...), k...)
+		if !bytes.HasPrefix(key, opts.Prefix) {
+			// 已经越过前缀对应的区间时停止遍历
+			cmp := bytes.Compare(key, opts.Prefix)
+			if (opts.Reverse && cmp > 0) || (!opts.Reverse && cmp < 0) {
+				continue
+			}
+			return false
+		}
+		if opts.beforeRange(key) {
+			continue
+		}
+		if opts.afterRange(key) {
+			return false
+		}
+		if !f(key, append(make([]byte, 0, len(v)), v...)) {
+			return false
+		}
+	}
+	return true
+}
+
+// seekBoltFirst 把游标定位到bucket中第一个不小于pivot的键
+func seekBoltFirst(c *bolt.Cursor, base, pivot []byte) ([]byte, []byte) {
+	switch {
+	case bytes.Compare(pivot, base) <= 0:
+		return c.First()
+	case bytes.HasPrefix(pivot, base):
+		return c.Seek(pivot[len(base):])
+	default:
+		// pivot大于bucket中所有的键
+		return nil, nil
+	}
+}
+
+// seekBoltLast 把游标定位到bucket中最后一个小于end的键，end为空表示不限制
+func seekBoltLast(c *bolt.Cursor, base, end []byte) ([]byte, []byte) {
+	switch {
+	case len(end) == 0:
+		return c.Last()
+	case bytes.Compare(end, base) <= 0:
+		// end不大于bucket中所有的键
+		return nil, nil
+	case bytes.HasPrefix(end, base):
+		if k, _ := c.Seek(end[len(base):]); k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	default:
+		return c.Last()
+	}
+}
+
+func boltStep(c *bolt.Cursor, reverse bool) ([]byte, []byte) {
+	if reverse {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// Stats 返回bbolt数据文件的统计信息，B+树索引就在mmap映射的数据文件中，不单独占用堆内存
+func (s *BoltStore) Stats() (*StoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+
+	stats := &StoreStats{
+		Engine:          config.StorageTypeBBolt,
+		Version:         moduleVersion(boltModulePath),
+		SegmentFiles:    1,
+		ReclaimableSize: int64(s.db.Stats().FreeAlloc),
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.DiskSize = tx.Size()
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			stats.KeyCount += int64(b.Stats().KeyN)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// NewWriteBatch 创建bbolt的批量写入，提交时在同一个读写事务中应用全部操作
+func (s *BoltStore) NewWriteBatch() WriteBatch {
+	return &boltWriteBatch{store: s}
+}
+
+// Close 关闭数据文件
+func (s *BoltStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.closed = true
+	return s.db.Close()
+}
+
+// Sync 把数据文件刷到磁盘
+func (s *BoltStore) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	return s.db.Sync()
+}
+
+// boltWriteBatch 缓存操作，提交时在一个读写事务中全部应用
+type boltWriteBatch struct {
+	store *BoltStore
+	ops   []boltBatchOp
+}
+
+type boltBatchOp struct {
+	bucket []byte
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *boltWriteBatch) Put(key, value []byte) error {
+	bucket, sub, err := boltLocate(key)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, boltBatchOp{bucket: cloneBytes(bucket), key: cloneBytes(sub), value: cloneBytes(value)})
+	return nil
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *boltWriteBatch) Delete(key []byte) error {
+	bucket, sub, err := boltLocate(key)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, boltBatchOp{bucket: cloneBytes(bucket), key: cloneBytes(sub), delete: true})
+	return nil
+}
+
+// Commit 原子地提交所有操作
+func (b *boltWriteBatch) Commit() error {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+	if b.store.closed {
+		return ErrStoreClosed
+	}
+
+	err := b.store.db.Update(func(tx *bolt.Tx) error {
+		for _, op := range b.ops {
+			if op.delete {
+				if bucket := tx.Bucket(op.bucket); bucket != nil {
+					if err := bucket.Delete(op.key); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			bucket, err := tx.CreateBucketIfNotExists(op.bucket)
+			if err != nil {
+				return err
+			}
+			value := op.value
+			if value == nil {
+				// bbolt用nil表示键不存在，空值需要存成非nil的空切片
+				value = []byte{}
+			}
+			if err := bucket.Put(op.key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		b.ops = nil
+	}
+	return err
+}
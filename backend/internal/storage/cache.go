@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cacheEntryOverhead 估算缓存中每个条目除键值本身外占用的字节数
+const cacheEntryOverhead = 96
+
+// CacheStats 描述值缓存的统计信息
+type CacheStats struct {
+	Entries    int     `json:"entries"`
+	Bytes      int64   `json:"bytes"`
+	MaxEntries int     `json:"maxEntries"`
+	MaxBytes   int64   `json:"maxBytes"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	Evictions  uint64  `json:"evictions"`
+	HitRate    float64 `json:"hitRate"` // 命中次数占读取次数的比例，尚无读取时为0
+}
+
+// cacheEntry 是LRU链表中的一个条目
+type cacheEntry struct {
+	key   string
+	value []byte
+	size  int64
+}
+
+// CachedStore 在任意KVStore之外维护一个有界的LRU值缓存。
+// 读取未命中时从底层存储读取并放入缓存，写入和删除在底层提交后使缓存失效
+type CachedStore struct {
+	store KVStore
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // 队首是最近使用的条目
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	// gen 在每次失效时递增，读取未命中期间gen发生变化说明读到的值可能已经过时，不放入缓存
+	gen       uint64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	closed    bool
+}
+
+// NewCachedStore 用最多maxEntries个条目、maxBytes字节的LRU缓存包装store，
+// maxBytes为0表示只限制条目数
+func NewCachedStore(store KVStore, maxEntries int, maxBytes int64) *CachedStore {
+	return &CachedStore{
+		store:      store,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// Unwrap 返回被包装的存储
+func (s *CachedStore) Unwrap() KVStore {
+	return s.store
+}
+
+// Get 优先从缓存读取，未命中时读取底层存储并放入缓存
+func (s *CachedStore) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrStoreClosed
+	}
+	if elem, ok := s.entries[string(key)]; ok {
+		s.lru.MoveToFront(elem)
+		s.hits++
+		value := cloneBytes(elem.Value.(*cacheEntry).value)
+		s.mu.Unlock()
+		return value, nil
+	}
+	s.misses++
+	gen := s.gen
+	s.mu.Unlock()
+
+	value, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if !s.closed && s.gen == gen {
+		s.insertLocked(string(key), cloneBytes(value))
+	}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Put 写入底层存储后使缓存中的旧值失效
+func (s *CachedStore) Put(key, value []byte) error {
+	err := s.store.Put(key, value)
+	s.invalidate(key)
+	return err
+}
+
+// Delete 从底层存储删除后使缓存中的值失效
+func (s *CachedStore) Delete(key []byte) error {
+	err := s.store.Delete(key)
+	s.invalidate(key)
+	return err
+}
+
+// Fold 直接遍历底层存储
+func (s *CachedStore) Fold(f func(key []byte, value []byte) bool) error {
+	return s.store.Fold(f)
+}
+
+// GetListKeys 直接获取底层存储的键
+func (s *CachedStore) GetListKeys() [][]byte {
+	return s.store.GetListKeys()
+}
+
+// Scan 直接遍历底层存储
+func (s *CachedStore) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	return s.store.Scan(opts, f)
+}
+
+// NewWriteBatch 创建一个批量写入，提交后使涉及的键全部失效
+func (s *CachedStore) NewWriteBatch() WriteBatch {
+	return &cachedWriteBatch{store: s, wb: s.store.NewWriteBatch()}
+}
+
+// Stats 返回底层存储的统计信息，并附带缓存的统计信息
+func (s *CachedStore) Stats() (*StoreStats, error) {
+	stats, err := s.store.Stats()
+	if err != nil {
+		return nil, err
+	}
+	cache := s.CacheStats()
+	stats.Cache = &cache
+	return stats, nil
+}
+
+// CacheStats 返回缓存的统计信息
+func (s *CachedStore) CacheStats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := CacheStats{
+		Entries:    s.lru.Len(),
+		Bytes:      s.bytes,
+		MaxEntries: s.maxEntries,
+		MaxBytes:   s.maxBytes,
+		Hits:       s.hits,
+		Misses:     s.misses,
+		Evictions:  s.evictions,
+	}
+	if total := s.hits + s.misses; total > 0 {
+		stats.HitRate = float64(s.hits) / float64(total)
+	}
+	return stats
+}
+
+// Close 清空缓存并关闭底层存储
+func (s *CachedStore) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.clearLocked()
+	s.mu.Unlock()
+	return s.store.Close()
+}
+
+// Sync 持久化底层存储的数据
+func (s *CachedStore) Sync() error {
+	return s.store.Sync()
+}
+
+// invalidate 从缓存中移除keys
+func (s *CachedStore) invalidate(keys ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	for _, key := range keys {
+		if elem, ok := s.entries[string(key)]; ok {
+			s.removeLocked(elem)
+		}
+	}
+}
+
+// insertLocked 放入一个条目并按需淘汰最久未使用的条目，调用方必须持有锁
+func (s *CachedStore) insertLocked(key string, value []byte) {
+	size := int64(len(key)+len(value)) + cacheEntryOverhead
+	if s.maxEntries <= 0 || (s.maxBytes > 0 && size > s.maxBytes) {
+		return
+	}
+	if elem, ok := s.entries[key]; ok {
+		s.removeLocked(elem)
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, value: value, size: size})
+	s.bytes += size
+
+	for s.lru.Len() > s.maxEntries || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.removeLocked(s.lru.Back())
+		s.evictions++
+	}
+}
+
+// removeLocked 移除一个条目，调用方必须持有锁
+func (s *CachedStore) removeLocked(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.size
+}
+
+// clearLocked 清空缓存，调用方必须持有锁
+func (s *CachedStore) clearLocked() {
+	s.gen++
+	s.entries = make(map[string]*list.Element)
+	s.lru.Init()
+	s.bytes = 0
+}
+
+// cachedWriteBatch 记录批量写入涉及的键，提交后使它们失效
+type cachedWriteBatch struct {
+	store *CachedStore
+	wb    WriteBatch
+	keys  [][]byte
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *cachedWriteBatch) Put(key, value []byte) error {
+	if err := b.wb.Put(key, value); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, cloneBytes(key))
+	return nil
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *cachedWriteBatch) Delete(key []byte) error {
+	if err := b.wb.Delete(key); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, cloneBytes(key))
+	return nil
+}
+
+// Commit 原子地提交所有操作，无论成功与否都使涉及的键失效
+func (b *cachedWriteBatch) Commit() error {
+	err := b.wb.Commit()
+	b.store.invalidate(b.keys...)
+	b.keys = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	// ErrNotNumber 表示键的值不是计数器要求的数字
+	ErrNotNumber = errors.New("value is not a number")
+	// ErrNumberOverflow 表示自增后的结果超出范围
+	ErrNumberOverflow = errors.New("increment would overflow")
+)
+
+// IncrBy 把键的整数值加上delta并返回新值，键不存在时视为0，键原有的过期时间保持不变。
+// 读-改-写有意在Update的数据库写锁内完成，而不是使用按键的锁：每次写入都要在这把锁内
+// 分配版本号、暂存历史版本和索引并追加复制日志，按键加锁也无法让不同键的自增并行提交，
+// 反而会让同一个键上不经过该锁的Put覆盖自增的结果。锁内额外的开销只是一次读取和数字解析
+func (d *DB) IncrBy(key []byte, delta int64) (int64, *KeyMeta, error) {
+	var result int64
+	meta, err := d.Update(key, func(cur *Entry) (*Mutation, error) {
+		var n int64
+		if cur != nil {
+			var err error
+			if n, err = strconv.ParseInt(string(cur.Value), 10, 64); err != nil {
+				return nil, ErrNotNumber
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, ErrNumberOverflow
+		}
+		result = n + delta
+		return &Mutation{Value: []byte(strconv.FormatInt(result, 10)), KeepTTL: true}, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return result, meta, nil
+}
+
+// IncrByFloat 把键的数值加上delta并返回新值，键不存在时视为0，结果不能是NaN或无穷大。
+// 与IncrBy一样在数据库写锁内完成读-改-写
+func (d *DB) IncrByFloat(key []byte, delta float64) (float64, *KeyMeta, error) {
+	var result float64
+	meta, err := d.Update(key, func(cur *Entry) (*Mutation, error) {
+		var f float64
+		if cur != nil {
+			var err error
+			if f, err = strconv.ParseFloat(string(cur.Value), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return nil, ErrNotNumber
+			}
+		}
+		result = f + delta
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, ErrNumberOverflow
+		}
+		return &Mutation{Value: []byte(strconv.FormatFloat(result, 'f', -1, 64)), KeepTTL: true}, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return result, meta, nil
+}
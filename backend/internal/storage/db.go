@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 内部键以0x00开头，存放过期时间、元数据等附属记录，对外不可见
+const internalKeyPrefix byte = 0x00
+
+var (
+	// ErrKeyIsEmpty 表示键为空
+	ErrKeyIsEmpty = errors.New("key is empty")
+	// ErrReservedKey 表示键以保留前缀0x00开头
+	ErrReservedKey = errors.New("keys starting with 0x00 are reserved")
+)
+
+// userKeyStart 是最小的用户键，所有内部键都排在它之前
+var userKeyStart = []byte{internalKeyPrefix + 1}
+
+// DB 在KVStore之上提供面向用户的键空间：
+// 隐藏内部键、过滤已过期的键，并保证每次写入与其附属记录原子提交
+type DB struct {
+	store *dumpStore
+
+	// dumpMu 串行化备份和复制快照的导出
+	dumpMu sync.Mutex
+
+	// mu 串行化所有写入，并保护下面的内存状态
+	mu          sync.RWMutex
+	maxBatchOps int
+
+	// 过期时间索引：键 -> 过期时间（UnixNano）
+	expires       map[string]int64
+	reapInterval  time.Duration
+	reapBatchSize int
+	reaperStop    chan struct{}
+	reaperDone    chan struct{}
+
+	// 合并状态与自动合并策略，由mergeMu保护，合并不持有mu
+	mergeMu         sync.Mutex
+	mergeRatio      float64
+	mergeInterval   time.Duration
+	mergeCurrent    *MergeRun
+	mergeLast       *MergeRun
+	mergePolicyStop chan struct{}
+	mergePolicyDone chan struct{}
+
+	// 二级索引：索引名 -> 索引，由mu保护
+	indexes map[string]*index
+	// 全文索引，未启用全文检索时为nil，由mu保护
+	search *searchIndex
+
+	// 最近的变更事件，供Watch订阅
+	feed *changeFeed
+
+	// 历史版本的保留策略，historyPrunedAt只由后台清理使用
+	history         historyRules
+	historyPrunedAt time.Time
+
+	// 复制：主节点上replLog为复制日志，从节点上replica为已应用的位置，均由mu保护。
+	// 应用主节点的日志期间replApplyAt为日志的写入时间，此时允许从节点写入
+	replLog     *replicationLog
+	replica     *ReplicationPosition
+	replApplyAt time.Time
+
+	// 供上层模块使用的内部命名空间，由nsMu保护
+	nsMu       sync.Mutex
+	namespaces map[string]*Namespace
+}
+
+// NewDB 在已打开的KVStore之上创建DB，并从存储中加载过期时间索引、二级索引、全文索引和复制状态
+func NewDB(store KVStore, cfg config.StorageConfig) (*DB, error) {
+	d := &DB{
+		store:         newDumpStore(store),
+		maxBatchOps:   cfg.MaxBatchOps,
+		expires:       make(map[string]int64),
+		indexes:       make(map[string]*index),
+		feed:          newChangeFeed(cfg.WatchBufferSize),
+		history:       newHistoryRules(cfg),
+		reapInterval:  time.Duration(cfg.ReapInterval) * time.Second,
+		reapBatchSize: cfg.ReapBatchSize,
+		mergeRatio:    cfg.MergeRatio,
+		mergeInterval: time.Duration(cfg.MergeInterval) * time.Second,
+	}
+	if err := d.loadExpires(); err != nil {
+		return nil, err
+	}
+	if err := d.loadIndexes(); err != nil {
+		return nil, err
+	}
+	if err := d.loadSearch(cfg.FullTextSearch); err != nil {
+		return nil, err
+	}
+	if err := d.loadReplication(cfg.Replication); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Open 按配置打开底层存储并创建DB
+func Open(cfg config.StorageConfig) (*DB, error) {
+	store, err := NewKVStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDB(store, cfg)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// isInternalKey 判断是否为内部键
+func isInternalKey(key []byte) bool {
+	return len(key) > 0 && key[0] == internalKeyPrefix
+}
+
+// internalKey 生成指定命名空间下的内部键：0x00 + 命名空间 + 0x00 + 用户键
+func internalKey(namespace string, key []byte) []byte {
+	buf := make([]byte, 0, len(namespace)+len(key)+2)
+	buf = append(buf, internalKeyPrefix)
+	buf = append(buf, namespace...)
+	buf = append(buf, internalKeyPrefix)
+	return append(buf, key...)
+}
+
+// checkUserKey 校验用户键
+func checkUserKey(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if isInternalKey(key) {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+// writeOp 表示一次用户写操作
+type writeOp struct {
+	key      []byte
+	value    []byte
+	delete   bool
+	expireAt int64 // 过期时间（UnixNano），0表示永不过期
+	keepTTL  bool  // 保留键原有的过期时间，此时忽略expireAt
+	expired  bool  // 删除的是已过期的键
+	// requestID 是发起写入的请求ID，记录在历史版本中
+	requestID string
+	// raw 表示内部命名空间中的记录，直接写入，不维护过期时间、元数据等附属记录
+	raw bool
+	// persist 表示只清除键的过期时间，不修改值
+	persist bool
+}
+
+// nextValue 返回写操作之后键的值，删除时返回nil，空值返回非nil的空切片
+func (op writeOp) nextValue() []byte {
+	if op.delete {
+		return nil
+	}
+	if op.value == nil {
+		return []byte{}
+	}
+	return op.value
+}
+
+// prevValue 返回一个读取键在op之前的值的函数，只在第一次调用时读取，键不存在时返回nil。
+// pending记录本批次内已经暂存的值，调用方必须持有写锁
+func (d *DB) prevValue(key []byte, pending map[string][]byte) func() ([]byte, error) {
+	var value []byte
+	var err error
+	loaded := false
+	return func() ([]byte, error) {
+		if loaded {
+			return value, err
+		}
+		loaded = true
+		if staged, ok := pending[string(key)]; ok {
+			value = staged
+			return value, nil
+		}
+		value, err = d.store.Get(key)
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+			value, err = nil, nil
+		case err == nil && value == nil:
+			value = []byte{}
+		}
+		return value, err
+	}
+}
+
+// applyLocked 把一组写操作连同附属的内部记录放进同一个批量写入原子提交，
+// 返回写入后各键的元数据（被删除的键对应nil），调用方必须持有写锁。
+// 主节点上同一批量写入还会追加一条复制日志，从节点上只允许应用主节点的日志
+func (d *DB) applyLocked(ops []writeOp) (map[string]*KeyMeta, error) {
+	if d.replica != nil && d.replApplyAt.IsZero() {
+		return nil, ErrReadOnlyReplica
+	}
+	batch := d.store.NewWriteBatch()
+	now := time.Now()
+	if !d.replApplyAt.IsZero() {
+		// 使用主节点的写入时间，两边的元数据和历史版本保持一致
+		now = d.replApplyAt
+	}
+	expires := make(map[string]int64)
+	metas := make(map[string]*KeyMeta)
+	values := make(map[string][]byte)
+	var search searchDelta
+	history := make(map[string]uint64)
+	events := make([]ChangeEvent, 0, len(ops))
+	for _, op := range ops {
+		if op.raw {
+			if err := stageRaw(batch, op); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if op.persist {
+			if err := d.stageExpire(batch, writeOp{key: op.key, delete: true}, expires); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var err error
+		if op.delete {
+			err = batch.Delete(op.key)
+		} else {
+			err = batch.Put(op.key, op.value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := d.stageExpire(batch, op, expires); err != nil {
+			return nil, err
+		}
+		if err := d.stageMeta(batch, op, now, metas, history); err != nil {
+			return nil, err
+		}
+		if err := d.stageHistory(batch, op, metas[string(op.key)], now, history); err != nil {
+			return nil, err
+		}
+		prev := d.prevValue(op.key, values)
+		if err := d.stageIndexes(batch, op, prev); err != nil {
+			return nil, err
+		}
+		if err := d.stageSearch(batch, op, prev, &search); err != nil {
+			return nil, err
+		}
+		values[string(op.key)] = op.nextValue()
+		if !isInternalKey(op.key) {
+			events = append(events, changeEvent(op, metas[string(op.key)], now))
+		}
+	}
+	if err := d.stageSearchStats(batch, search); err != nil {
+		return nil, err
+	}
+	seq, first, err := d.stageLog(batch, ops, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+
+	// 提交成功后再更新内存状态
+	d.replLog.appended(seq, first, now)
+	d.applySearchDelta(search)
+	d.feed.publish(events)
+	for key, expireAt := range expires {
+		if expireAt == 0 {
+			delete(d.expires, key)
+		} else {
+			d.expires[key] = expireAt
+		}
+	}
+	return metas, nil
+}
+
+// Get 获取键对应的值，已过期的键视为不存在
+func (d *DB) Get(key []byte) ([]byte, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.expiredLocked(key, time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	return d.store.Get(key)
+}
+
+// Put 设置键值对，并清除键上原有的过期时间
+func (d *DB) Put(key, value []byte) error {
+	if err := checkUserKey(key); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.applyLocked([]writeOp{{key: key, value: value}})
+	return err
+}
+
+// Delete 删除键值对
+func (d *DB) Delete(key []byte) error {
+	if err := checkUserKey(key); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.applyLocked([]writeOp{{key: key, delete: true}})
+	return err
+}
+
+// Fold 遍历所有未过期的用户键值对
+func (d *DB) Fold(f func(key []byte, value []byte) bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := time.Now().UnixNano()
+	return d.store.Fold(func(key []byte, value []byte) bool {
+		if isInternalKey(key) || d.expiredLocked(key, now) {
+			return true
+		}
+		return f(key, value)
+	})
+}
+
+// GetListKeys 获取所有未过期的用户键
+func (d *DB) GetListKeys() [][]byte {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := time.Now().UnixNano()
+	keys := d.store.GetListKeys()
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if isInternalKey(key) || d.expiredLocked(key, now) {
+			continue
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// Scan 按序遍历未过期的用户键值对
+func (d *DB) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	// 内部键都排在userKeyStart之前，收紧范围起点即可跳过
+	if bytes.Compare(opts.Start, userKeyStart) < 0 {
+		opts.Start = userKeyStart
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := time.Now().UnixNano()
+	return d.store.Scan(opts, func(key []byte, value []byte) bool {
+		if d.expiredLocked(key, now) {
+			return true
+		}
+		return f(key, value)
+	})
+}
+
+// NewWriteBatch 创建一个原子批量写入，操作数受maxBatchOps限制
+func (d *DB) NewWriteBatch() WriteBatch {
+	return &dbWriteBatch{db: d}
+}
+
+// NewWriteBatchWithRequestID 创建一个原子批量写入，写入的历史版本记录发起写入的请求ID
+func (d *DB) NewWriteBatchWithRequestID(requestID string) WriteBatch {
+	return &dbWriteBatch{db: d, requestID: requestID}
+}
+
+// Close 停止后台任务并关闭底层存储
+func (d *DB) Close() error {
+	d.StopReaper()
+	d.StopMergePolicy()
+	d.stopIndexBuilds()
+	d.stopSearchRebuild()
+	d.feed.close()
+	d.closeReplicationLog()
+	return d.store.Close()
+}
+
+// Sync 持久化数据
+func (d *DB) Sync() error {
+	return d.store.Sync()
+}
+
+// dbWriteBatch 先缓存用户操作，提交时再与附属记录一起写入底层批量写入
+type dbWriteBatch struct {
+	db        *DB
+	ops       []writeOp
+	requestID string
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *dbWriteBatch) Put(key, value []byte) error {
+	return b.add(writeOp{key: key, value: value, requestID: b.requestID})
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *dbWriteBatch) Delete(key []byte) error {
+	return b.add(writeOp{key: key, delete: true, requestID: b.requestID})
+}
+
+func (b *dbWriteBatch) add(op writeOp) error {
+	if err := checkUserKey(op.key); err != nil {
+		return err
+	}
+	if len(b.ops) >= b.db.maxBatchOps {
+		return ErrBatchTooLarge
+	}
+	b.ops = append(b.ops, op)
+	return nil
+}
+
+// Commit 原子地提交所有操作
+func (b *dbWriteBatch) Commit() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	_, err := b.db.applyLocked(b.ops)
+	return err
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFeedSize 是未配置时变更事件缓冲区保留的事件数
+const defaultFeedSize = 1024
+
+// 变更事件的操作类型
+const (
+	ChangeOpPut    = "put"
+	ChangeOpDelete = "delete"
+	ChangeOpExpire = "expire" // 过期的键被后台清理
+)
+
+var (
+	// ErrInvalidResumeToken 表示恢复令牌格式错误或指向尚未发生的事件
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrResumeTokenExpired 表示恢复令牌之后的事件已经不在缓冲区中（数据库被重新打开或订阅方太慢），
+	// 需要重新读取数据后再订阅
+	ErrResumeTokenExpired = errors.New("resume token has expired, events were missed")
+	// ErrFeedClosed 表示数据库已经关闭
+	ErrFeedClosed = errors.New("change feed is closed")
+)
+
+// ChangeEvent 是一次成功写入产生的变更事件
+type ChangeEvent struct {
+	// Token 是恢复令牌，重新订阅时传入可以从该事件之后继续
+	Token string
+	Seq   uint64
+	Op    string
+	Key   []byte
+	// Version 是写入后键的版本号，删除和过期时为0
+	Version uint64
+	Time    time.Time
+}
+
+// changeFeed 在内存中按顺序保留最近的变更事件，供订阅方读取。
+// 序号在每次打开数据库时从1开始，恢复令牌带有本次打开的纪元，因此旧的令牌不会被误用
+type changeFeed struct {
+	mu     sync.Mutex
+	epoch  string
+	seq    uint64        // 最后一个事件的序号
+	events []ChangeEvent // 环形缓冲区，序号为seq的事件位于events[seq%len(events)]
+	notify chan struct{} // 有新事件或关闭时关闭并替换
+	closed bool
+}
+
+func newChangeFeed(size int) *changeFeed {
+	if size <= 0 {
+		size = defaultFeedSize
+	}
+	return &changeFeed{
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		events: make([]ChangeEvent, size),
+		notify: make(chan struct{}),
+	}
+}
+
+// oldest 返回缓冲区中最早的事件序号，调用方必须持有f.mu
+func (f *changeFeed) oldest() uint64 {
+	if f.seq < uint64(len(f.events)) {
+		return 1
+	}
+	return f.seq - uint64(len(f.events)) + 1
+}
+
+// publish 为一次批量写入中的各个操作追加事件并唤醒订阅方
+func (f *changeFeed) publish(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range events {
+		f.seq++
+		e.Seq = f.seq
+		e.Token = f.epoch + "-" + strconv.FormatUint(f.seq, 10)
+		f.events[f.seq%uint64(len(f.events))] = e
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *changeFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.notify)
+	}
+}
+
+// Watcher 是对变更事件的一个订阅
+type Watcher struct {
+	feed   *changeFeed
+	prefix []byte
+	last   uint64 // 已经返回的最后一个事件的序号
+}
+
+// Watch 订阅键以prefix开头的变更事件。after为空时只接收之后的新事件，
+// 否则从恢复令牌after对应的事件之后继续
+func (d *DB) Watch(prefix []byte, after string) (*Watcher, error) {
+	f := d.feed
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, ErrFeedClosed
+	}
+
+	w := &Watcher{feed: f, prefix: prefix, last: f.seq}
+	if after == "" {
+		return w, nil
+	}
+	epoch, seqStr, ok := strings.Cut(after, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil {
+		return nil, ErrInvalidResumeToken
+	}
+	if epoch != f.epoch {
+		return nil, ErrResumeTokenExpired
+	}
+	if seq > f.seq {
+		return nil, ErrInvalidResumeToken
+	}
+	if seq+1 < f.oldest() {
+		return nil, ErrResumeTokenExpired
+	}
+	w.last = seq
+	return w, nil
+}
+
+// Next 阻塞直到有匹配的事件、ctx结束或数据库关闭。订阅方落后太多、
+// 未读的事件已经被覆盖时返回ErrResumeTokenExpired
+func (w *Watcher) Next(ctx context.Context) (ChangeEvent, error) {
+	f := w.feed
+	for {
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			return ChangeEvent{}, ErrFeedClosed
+		}
+		if w.last+1 < f.oldest() {
+			f.mu.Unlock()
+			return ChangeEvent{}, ErrResumeTokenExpired
+		}
+		for w.last < f.seq {
+			w.last++
+			e := f.events[w.last%uint64(len(f.events))]
+			if bytes.HasPrefix(e.Key, w.prefix) {
+				f.mu.Unlock()
+				return e, nil
+			}
+		}
+		notify := f.notify
+		f.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ChangeEvent{}, ctx.Err()
+		}
+	}
+}
+
+// Token 返回已经读取到的位置对应的恢复令牌，包括因为前缀不匹配而跳过的事件
+func (w *Watcher) Token() string {
+	return w.feed.epoch + "-" + strconv.FormatUint(w.last, 10)
+}
+
+// changeEvent 构造写操作对应的变更事件，序号和恢复令牌在发布时分配
+func changeEvent(op writeOp, meta *KeyMeta, now time.Time) ChangeEvent {
+	e := ChangeEvent{Op: ChangeOpPut, Key: append([]byte(nil), op.key...), Time: now}
+	switch {
+	case op.expired:
+		e.Op = ChangeOpExpire
+	case op.delete:
+		e.Op = ChangeOpDelete
+	case meta != nil:
+		e.Version = meta.Version
+	}
+	return e
+}
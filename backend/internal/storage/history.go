@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// historyNamespace 是存放键的历史版本的内部命名空间，
+// 记录的键为 uvarint(len(key)) + key + 大端序的版本号，因此同一个键的版本按版本号排列
+const historyNamespace = "history"
+
+// historyPruneInterval 是后台按保留时间清理历史版本的最小间隔
+const historyPruneInterval = time.Minute
+
+var (
+	// ErrVersionNotFound 表示键的历史版本不存在或已经被清理
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrHistoryDisabled 表示键没有启用版本历史
+	ErrHistoryDisabled = errors.New("version history is not enabled for this key")
+)
+
+// historyPolicy 是一个键的历史版本保留策略
+type historyPolicy struct {
+	versions int           // 最多保留的版本数（包括当前版本），0表示不保留
+	maxAge   time.Duration // 版本的最长保留时间，0表示不限制
+}
+
+// historyRule 是按前缀覆盖的保留策略
+type historyRule struct {
+	prefix string
+	historyPolicy
+}
+
+// historyRules 按最长前缀匹配键的保留策略，没有匹配的前缀时使用全局策略
+type historyRules struct {
+	global historyPolicy
+	rules  []historyRule // 按前缀长度从长到短排列
+}
+
+func newHistoryRules(cfg config.StorageConfig) historyRules {
+	r := historyRules{global: historyPolicy{
+		versions: cfg.HistoryVersions,
+		maxAge:   time.Duration(cfg.HistoryMaxAge) * time.Second,
+	}}
+	for _, rule := range cfg.HistoryRules {
+		r.rules = append(r.rules, historyRule{
+			prefix: rule.Prefix,
+			historyPolicy: historyPolicy{
+				versions: rule.Versions,
+				maxAge:   time.Duration(rule.MaxAge) * time.Second,
+			},
+		})
+	}
+	sort.SliceStable(r.rules, func(i, j int) bool { return len(r.rules[i].prefix) > len(r.rules[j].prefix) })
+	return r
+}
+
+func (r historyRules) policy(key []byte) historyPolicy {
+	for _, rule := range r.rules {
+		if strings.HasPrefix(string(key), rule.prefix) {
+			return rule.historyPolicy
+		}
+	}
+	return r.global
+}
+
+// enabled 判断是否有任何键需要保留历史版本
+func (r historyRules) enabled() bool {
+	if r.global.versions > 0 {
+		return true
+	}
+	for _, rule := range r.rules {
+		if rule.versions > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Version 是键的一个历史版本
+type Version struct {
+	KeyMeta
+	RequestID string
+	Value     []byte // History 返回的列表中为nil
+}
+
+// storedVersion 是历史版本头部的存储格式，值紧跟在头部之后
+type storedVersion struct {
+	CreatedAt int64  `json:"c"`
+	UpdatedAt int64  `json:"u"`
+	Version   uint64 `json:"v"`
+	Size      int    `json:"s"`
+	RequestID string `json:"r,omitempty"`
+}
+
+func encodeVersion(meta KeyMeta, requestID string, value []byte) []byte {
+	header, _ := json.Marshal(storedVersion{
+		CreatedAt: meta.CreatedAt.UnixNano(),
+		UpdatedAt: meta.UpdatedAt.UnixNano(),
+		Version:   meta.Version,
+		Size:      meta.Size,
+		RequestID: requestID,
+	})
+	buf := binary.AppendUvarint(nil, uint64(len(header)))
+	buf = append(buf, header...)
+	return append(buf, value...)
+}
+
+func decodeVersion(data []byte) (Version, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return Version{}, errors.New("corrupted version record")
+	}
+	var sv storedVersion
+	if err := json.Unmarshal(data[size:size+int(n)], &sv); err != nil {
+		return Version{}, err
+	}
+	return Version{
+		KeyMeta: KeyMeta{
+			CreatedAt: time.Unix(0, sv.CreatedAt),
+			UpdatedAt: time.Unix(0, sv.UpdatedAt),
+			Version:   sv.Version,
+			Size:      sv.Size,
+		},
+		RequestID: sv.RequestID,
+		Value:     data[size+int(n):],
+	}, nil
+}
+
+// historyPrefix 返回键的所有历史版本共同的前缀
+func historyPrefix(key []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(key)))
+	return internalKey(historyNamespace, append(buf, key...))
+}
+
+func historyKey(key []byte, version uint64) []byte {
+	return binary.BigEndian.AppendUint64(historyPrefix(key), version)
+}
+
+// lastHistoryVersionLocked 返回键最新的历史版本号，没有历史时返回0。
+// 键被删除后重新创建时从这里继续编号，避免与保留下来的历史版本冲突
+func (d *DB) lastHistoryVersionLocked(key []byte, pending map[string]uint64) (uint64, error) {
+	if v, ok := pending[string(key)]; ok {
+		return v, nil
+	}
+	if !d.history.enabled() {
+		return 0, nil
+	}
+	prefix := historyPrefix(key)
+	var last uint64
+	err := d.store.Scan(ScanOptions{Prefix: prefix, Reverse: true, KeysOnly: true}, func(k []byte, _ []byte) bool {
+		last = binary.BigEndian.Uint64(k[len(prefix):])
+		return false
+	})
+	return last, err
+}
+
+// stageHistory 把写入的新版本加入批量写入，并按数量和保留时间清理旧版本。
+// 删除不会清除历史，删除后仍可以回滚
+func (d *DB) stageHistory(batch WriteBatch, op writeOp, meta *KeyMeta, now time.Time, pending map[string]uint64) error {
+	if op.delete || meta == nil || isInternalKey(op.key) {
+		return nil
+	}
+	policy := d.history.policy(op.key)
+	if policy.versions <= 0 {
+		return nil
+	}
+	if err := batch.Put(historyKey(op.key, meta.Version), encodeVersion(*meta, op.requestID, op.value)); err != nil {
+		return err
+	}
+	pending[string(op.key)] = meta.Version
+
+	// 同一批次中先写入的版本还没有提交，这里看不到，下次写入时再清理
+	prefix := historyPrefix(op.key)
+	var versions []uint64
+	err := d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, func(k []byte, _ []byte) bool {
+		if v := binary.BigEndian.Uint64(k[len(prefix):]); v != meta.Version {
+			versions = append(versions, v)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	excess := len(versions) + 1 - policy.versions
+	for i, v := range versions {
+		if i >= excess && !d.versionExpiredLocked(op.key, v, policy, now) {
+			break
+		}
+		if err := batch.Delete(historyKey(op.key, v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionExpiredLocked 判断历史版本是否超过了保留时间
+func (d *DB) versionExpiredLocked(key []byte, version uint64, policy historyPolicy, now time.Time) bool {
+	if policy.maxAge <= 0 {
+		return false
+	}
+	data, err := d.store.Get(historyKey(key, version))
+	if err != nil {
+		return false
+	}
+	v, err := decodeVersion(data)
+	return err == nil && now.Sub(v.UpdatedAt) > policy.maxAge
+}
+
+// History 返回键的历史版本（不含值），按版本号从新到旧排列，包括当前版本。
+// 键已经被删除时仍会返回保留下来的历史
+func (d *DB) History(key []byte) ([]Version, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var versions []Version
+	var decodeErr error
+	err := d.store.Scan(ScanOptions{Prefix: historyPrefix(key), Reverse: true}, func(_ []byte, value []byte) bool {
+		var v Version
+		if v, decodeErr = decodeVersion(value); decodeErr != nil {
+			return false
+		}
+		v.Value = nil
+		versions = append(versions, v)
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 && d.history.policy(key).versions <= 0 {
+		return nil, ErrHistoryDisabled
+	}
+	return versions, nil
+}
+
+// GetVersion 读取键的某个历史版本
+func (d *DB) GetVersion(key []byte, version uint64) (*Version, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.getVersionLocked(key, version)
+}
+
+func (d *DB) getVersionLocked(key []byte, version uint64) (*Version, error) {
+	data, err := d.store.Get(historyKey(key, version))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Rollback 把键恢复为某个历史版本的值，恢复作为一次新的写入产生新的版本，
+// 键仍存在时保留原有的过期时间。返回写入后键的元数据
+func (d *DB) Rollback(key []byte, version uint64, requestID string) (*KeyMeta, []byte, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	v, err := d.getVersionLocked(key, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	cur, err := d.entryLocked(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	op := writeOp{key: key, value: v.Value, keepTTL: cur != nil, requestID: requestID}
+	metas, err := d.applyLocked([]writeOp{op})
+	if err != nil {
+		return nil, nil, err
+	}
+	return metas[string(key)], v.Value, nil
+}
+
+// pruneHistory 在后台清理超过保留时间的历史版本，未被再次写入的键的旧版本也会被清理。
+// 两次清理至少间隔historyPruneInterval，每批最多检查indexBatchSize个版本，批次之间释放锁
+func (d *DB) pruneHistory(stop <-chan struct{}) {
+	if !d.history.enabled() || time.Since(d.historyPrunedAt) < historyPruneInterval {
+		return
+	}
+	d.historyPrunedAt = time.Now()
+
+	start := internalKey(historyNamespace, nil)
+	removed := 0
+	for start != nil {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		var n int
+		var err error
+		start, n, err = d.pruneHistoryBatch(start)
+		if err != nil {
+			logger.Error("清理历史版本失败", zap.Error(err))
+			return
+		}
+		removed += n
+	}
+	if removed > 0 {
+		logger.Debug("清理历史版本", zap.Int("count", removed))
+	}
+}
+
+// pruneHistoryBatch 在写锁内检查从start开始的一批历史版本，返回下一批的起点，全部检查完时为nil
+func (d *DB) pruneHistoryBatch(start []byte) ([]byte, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	nsPrefix := internalKey(historyNamespace, nil)
+	batch := d.store.NewWriteBatch()
+	var next []byte
+	count, removed := 0, 0
+	var stageErr error
+	err := d.store.Scan(ScanOptions{Prefix: nsPrefix, Start: start}, func(k []byte, value []byte) bool {
+		if count == indexBatchSize {
+			next = append([]byte(nil), k...)
+			return false
+		}
+		count++
+		rest := k[len(nsPrefix):]
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || uint64(len(rest)-size) < n {
+			return true
+		}
+		policy := d.history.policy(rest[size : size+int(n)])
+		if policy.maxAge <= 0 {
+			return true
+		}
+		v, err := decodeVersion(value)
+		if err != nil || now.Sub(v.UpdatedAt) <= policy.maxAge {
+			return true
+		}
+		removed++
+		stageErr = batch.Delete(k)
+		return stageErr == nil
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if removed > 0 {
+		if err := batch.Commit(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return next, removed, nil
+}
@@ -0,0 +1,668 @@
+package storage
+
+import (
+	"FastDB-Web/internal/jsondoc"
+	"FastDB-Web/internal/logger"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// indexNamespace 是存放二级索引定义和索引记录的内部命名空间
+const indexNamespace = "index"
+
+// 索引命名空间中记录类型的前缀
+const (
+	indexDefPrefix   byte = 'd' // d + 索引名 -> 索引定义
+	indexEntryPrefix byte = 'e' // e + uvarint(len(索引名)) + 索引名 + 编码后的值 + 用户键 -> 空
+)
+
+// indexBatchSize 是后台构建和删除索引时每批处理的键数，批次之间释放写锁
+const indexBatchSize = 500
+
+// 索引值的类型
+const (
+	IndexTypeString = "string"
+	IndexTypeNumber = "number"
+)
+
+// 索引的状态
+const (
+	IndexStateBuilding = "building" // 正在为已有数据建立索引，新的写入已经开始维护索引
+	IndexStateReady    = "ready"
+	indexStateDropping = "dropping" // 正在删除索引记录，对外不可见
+)
+
+var (
+	// ErrIndexNotFound 表示索引不存在
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrIndexExists 表示同名索引已存在
+	ErrIndexExists = errors.New("index already exists")
+	// ErrIndexNotReady 表示索引仍在构建，查询结果会不完整
+	ErrIndexNotReady = errors.New("index is still building")
+	// ErrInvalidIndex 表示索引定义不合法
+	ErrInvalidIndex = errors.New("invalid index definition")
+	// ErrInvalidIndexValue 表示查询值与索引类型不匹配
+	ErrInvalidIndexValue = errors.New("query value does not match the index type")
+)
+
+// indexNamePattern 限制索引名只能包含字母、数字、下划线和连字符
+var indexNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// IndexDef 描述一个二级索引：为键以Prefix开头、值为JSON文档的键，
+// 按Path（JSON Pointer）处的值建立索引。值不是JSON、路径不存在或类型不是Type的键不进入索引
+type IndexDef struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+}
+
+// IndexInfo 是索引的定义和状态
+type IndexInfo struct {
+	IndexDef
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Indexed 是本次启动以来后台构建已经处理的键数
+	Indexed int64 `json:"indexed"`
+}
+
+// storedIndex 是索引定义的存储格式
+type storedIndex struct {
+	Prefix    string `json:"p"`
+	Path      string `json:"j"`
+	Type      string `json:"t"`
+	State     string `json:"s"`
+	CreatedAt int64  `json:"c"`
+}
+
+// index 是内存中的索引，字段由DB.mu保护
+type index struct {
+	def       IndexDef
+	state     string
+	createdAt time.Time
+	indexed   int64
+	// entryPrefix 是该索引所有记录共同的键前缀
+	entryPrefix []byte
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+func newIndex(def IndexDef, state string, createdAt time.Time) *index {
+	prefix := internalKey(indexNamespace, []byte{indexEntryPrefix})
+	prefix = binary.AppendUvarint(prefix, uint64(len(def.Name)))
+	return &index{
+		def:         def,
+		state:       state,
+		createdAt:   createdAt,
+		entryPrefix: append(prefix, def.Name...),
+	}
+}
+
+func indexDefKey(name string) []byte {
+	return internalKey(indexNamespace, append([]byte{indexDefPrefix}, name...))
+}
+
+func (idx *index) info() IndexInfo {
+	return IndexInfo{IndexDef: idx.def, State: idx.state, CreatedAt: idx.createdAt, Indexed: idx.indexed}
+}
+
+func (idx *index) encodeDef() []byte {
+	data, _ := json.Marshal(storedIndex{
+		Prefix:    idx.def.Prefix,
+		Path:      idx.def.Path,
+		Type:      idx.def.Type,
+		State:     idx.state,
+		CreatedAt: idx.createdAt.UnixNano(),
+	})
+	return data
+}
+
+// validate 校验索引定义
+func (def IndexDef) validate() error {
+	if !indexNamePattern.MatchString(def.Name) {
+		return errors.New("index name must be 1-64 letters, digits, underscores or hyphens")
+	}
+	if isInternalKey([]byte(def.Prefix)) {
+		return ErrReservedKey
+	}
+	if _, err := jsondoc.ParsePointer(def.Path); err != nil || def.Path == "" {
+		return errors.New("path must be a JSON pointer such as /status")
+	}
+	if def.Type != IndexTypeString && def.Type != IndexTypeNumber {
+		return errors.New("type must be string or number")
+	}
+	return nil
+}
+
+// encodeIndexValue 把值编码为保序的字节串：
+// 字符串中的0x00转义为0x00 0xff并以0x00 0x01结尾，数字编码为8字节
+func encodeIndexValue(typ string, v any) ([]byte, bool) {
+	switch typ {
+	case IndexTypeString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		buf := make([]byte, 0, len(s)+2)
+		for i := 0; i < len(s); i++ {
+			buf = append(buf, s[i])
+			if s[i] == 0x00 {
+				buf = append(buf, 0xff)
+			}
+		}
+		return append(buf, 0x00, 0x01), true
+	case IndexTypeNumber:
+		var f float64
+		switch n := v.(type) {
+		case json.Number:
+			var err error
+			if f, err = n.Float64(); err != nil {
+				return nil, false
+			}
+		case float64:
+			f = n
+		default:
+			return nil, false
+		}
+		if math.IsNaN(f) {
+			return nil, false
+		}
+		if f == 0 {
+			// -0与0相等，统一编码为0
+			f = 0
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return binary.BigEndian.AppendUint64(nil, bits), true
+	}
+	return nil, false
+}
+
+// decodeEntryKey 从索引记录中去掉索引前缀和编码后的值，返回用户键
+func (idx *index) decodeEntryKey(entry []byte) ([]byte, bool) {
+	rest := entry[len(idx.entryPrefix):]
+	if idx.def.Type == IndexTypeNumber {
+		if len(rest) < 8 {
+			return nil, false
+		}
+		return rest[8:], true
+	}
+	for i := 0; i+1 < len(rest); i++ {
+		if rest[i] == 0x00 {
+			if rest[i+1] == 0x01 {
+				return rest[i+2:], true
+			}
+			i++
+		}
+	}
+	return nil, false
+}
+
+// entryKey 返回键在索引中的记录，doc为nil或路径处的值不能被索引时返回nil
+func (idx *index) entryKey(doc any, key []byte) []byte {
+	if doc == nil {
+		return nil
+	}
+	v, err := jsondoc.Get(doc, idx.def.Path)
+	if err != nil {
+		return nil
+	}
+	enc, ok := encodeIndexValue(idx.def.Type, v)
+	if !ok {
+		return nil
+	}
+	entry := make([]byte, 0, len(idx.entryPrefix)+len(enc)+len(key))
+	entry = append(entry, idx.entryPrefix...)
+	entry = append(entry, enc...)
+	return append(entry, key...)
+}
+
+// parseIndexDoc 把值解析为JSON文档，值不是JSON时返回nil
+func parseIndexDoc(value []byte) any {
+	if value == nil {
+		return nil
+	}
+	doc, err := jsondoc.Parse(value)
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+// stageIndexes 把写操作对二级索引的修改加入批量写入，prev返回键在本次写入之前的值，
+// 调用方必须持有写锁
+func (d *DB) stageIndexes(batch WriteBatch, op writeOp, prev func() ([]byte, error)) error {
+	var matched []*index
+	for _, idx := range d.indexes {
+		if idx.state != indexStateDropping && bytes.HasPrefix(op.key, []byte(idx.def.Prefix)) {
+			matched = append(matched, idx)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	prevValue, err := prev()
+	if err != nil {
+		return err
+	}
+	prevDoc, nextDoc := parseIndexDoc(prevValue), parseIndexDoc(op.nextValue())
+	for _, idx := range matched {
+		oldEntry, newEntry := idx.entryKey(prevDoc, op.key), idx.entryKey(nextDoc, op.key)
+		if bytes.Equal(oldEntry, newEntry) {
+			continue
+		}
+		if oldEntry != nil {
+			if err := batch.Delete(oldEntry); err != nil {
+				return err
+			}
+		}
+		if newEntry != nil {
+			if err := batch.Put(newEntry, []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadIndexes 从存储中加载索引定义，继续未完成的构建和删除
+func (d *DB) loadIndexes() error {
+	prefix := indexDefKey("")
+	var loaded []*index
+	var decodeErr error
+	err := d.store.Scan(ScanOptions{Prefix: prefix}, func(key []byte, value []byte) bool {
+		var si storedIndex
+		if decodeErr = json.Unmarshal(value, &si); decodeErr != nil {
+			return false
+		}
+		def := IndexDef{Name: string(key[len(prefix):]), Prefix: si.Prefix, Path: si.Path, Type: si.Type}
+		loaded = append(loaded, newIndex(def, si.State, time.Unix(0, si.CreatedAt)))
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range loaded {
+		if idx.state == indexStateDropping {
+			// 上次删除被中断，此时还没有其他goroutine访问DB，直接删完剩余的记录
+			if err := d.dropIndexEntries(idx); err != nil {
+				return err
+			}
+			continue
+		}
+		d.indexes[idx.def.Name] = idx
+		if idx.state == IndexStateBuilding {
+			d.startIndexBuild(idx)
+		}
+	}
+	return nil
+}
+
+// CreateIndex 创建二级索引并在后台为已有数据建立索引。
+// 返回时新的写入已经开始维护索引，构建完成前索引处于building状态
+func (d *DB) CreateIndex(def IndexDef) (*IndexInfo, error) {
+	if def.Type == "" {
+		def.Type = IndexTypeString
+	}
+	if err := def.validate(); err != nil {
+		return nil, errors.Join(ErrInvalidIndex, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.indexes[def.Name]; ok {
+		return nil, ErrIndexExists
+	}
+	idx := newIndex(def, IndexStateBuilding, time.Now())
+	if err := d.store.Put(indexDefKey(def.Name), idx.encodeDef()); err != nil {
+		return nil, err
+	}
+	d.indexes[def.Name] = idx
+	d.startIndexBuild(idx)
+
+	logger.Info("创建二级索引",
+		zap.String("index", def.Name),
+		zap.String("prefix", def.Prefix),
+		zap.String("path", def.Path))
+	info := idx.info()
+	return &info, nil
+}
+
+// startIndexBuild 启动后台构建，调用方必须持有写锁或独占DB
+func (d *DB) startIndexBuild(idx *index) {
+	idx.stop = make(chan struct{})
+	idx.done = make(chan struct{})
+	go d.buildIndex(idx, idx.stop)
+}
+
+// cancelBuildLocked 通知后台构建退出，返回等待其退出的channel，没有构建时返回nil，调用方必须持有写锁
+func (idx *index) cancelBuildLocked() <-chan struct{} {
+	if idx.stop == nil {
+		return nil
+	}
+	close(idx.stop)
+	idx.stop = nil
+	return idx.done
+}
+
+// buildIndex 分批遍历前缀下的所有键写入索引记录，批次之间释放写锁
+func (d *DB) buildIndex(idx *index, stop <-chan struct{}) {
+	defer close(idx.done)
+	start := []byte(idx.def.Prefix)
+	if bytes.Compare(start, userKeyStart) < 0 {
+		start = userKeyStart
+	}
+	for start != nil {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		var err error
+		if start, err = d.buildIndexBatch(idx, start); err != nil {
+			logger.Error("构建二级索引失败", zap.String("index", idx.def.Name), zap.Error(err))
+			return
+		}
+	}
+	logger.Info("二级索引构建完成", zap.String("index", idx.def.Name))
+}
+
+// buildIndexBatch 在写锁内为从start开始的一批键写入索引记录，返回下一批的起点，全部完成时返回nil
+func (d *DB) buildIndexBatch(idx *index, start []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.indexes[idx.def.Name] != idx || idx.state != IndexStateBuilding {
+		return nil, nil
+	}
+
+	batch := d.store.NewWriteBatch()
+	var next []byte
+	count := 0
+	var stageErr error
+	err := d.store.Scan(ScanOptions{Prefix: []byte(idx.def.Prefix), Start: start}, func(key []byte, value []byte) bool {
+		if count == indexBatchSize {
+			next = append([]byte(nil), key...)
+			return false
+		}
+		count++
+		if entry := idx.entryKey(parseIndexDoc(value), key); entry != nil {
+			stageErr = batch.Put(entry, []byte{})
+		}
+		return stageErr == nil
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := idx.state
+	if next == nil {
+		idx.state = IndexStateReady
+		err = batch.Put(indexDefKey(idx.def.Name), idx.encodeDef())
+		idx.state = state
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+	idx.indexed += int64(count)
+	if next == nil {
+		idx.state = IndexStateReady
+	}
+	return next, nil
+}
+
+// DropIndex 删除索引及其全部记录
+func (d *DB) DropIndex(name string) error {
+	d.mu.Lock()
+	idx, ok := d.indexes[name]
+	if !ok || idx.state == indexStateDropping {
+		d.mu.Unlock()
+		return ErrIndexNotFound
+	}
+	// 先持久化dropping状态，删除中断后重新打开时会继续删除
+	state := idx.state
+	idx.state = indexStateDropping
+	if err := d.store.Put(indexDefKey(name), idx.encodeDef()); err != nil {
+		idx.state = state
+		d.mu.Unlock()
+		return err
+	}
+	done := idx.cancelBuildLocked()
+	d.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	err := d.dropIndexEntries(idx)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	delete(d.indexes, name)
+	logger.Info("删除二级索引", zap.String("index", name))
+	return nil
+}
+
+// dropIndexEntries 分批删除索引的全部记录，最后删除索引定义
+func (d *DB) dropIndexEntries(idx *index) error {
+	for {
+		n, err := d.dropIndexBatch(idx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// dropIndexBatch 在写锁内删除一批索引记录，没有剩余记录时删除索引定义并返回0
+func (d *DB) dropIndexBatch(idx *index) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	batch := d.store.NewWriteBatch()
+	count := 0
+	var stageErr error
+	err := d.store.Scan(ScanOptions{Prefix: idx.entryPrefix, KeysOnly: true}, func(key []byte, _ []byte) bool {
+		stageErr = batch.Delete(key)
+		count++
+		return stageErr == nil && count < indexBatchSize
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, d.store.Delete(indexDefKey(idx.def.Name))
+	}
+	return count, batch.Commit()
+}
+
+// stopIndexBuilds 停止所有后台构建并等待其退出，未完成的构建在下次打开时从头继续
+func (d *DB) stopIndexBuilds() {
+	d.mu.Lock()
+	var running []<-chan struct{}
+	for _, idx := range d.indexes {
+		if done := idx.cancelBuildLocked(); done != nil {
+			running = append(running, done)
+		}
+	}
+	d.mu.Unlock()
+	for _, done := range running {
+		<-done
+	}
+}
+
+// Indexes 返回所有索引，按名称排序
+func (d *DB) Indexes() []IndexInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	infos := make([]IndexInfo, 0, len(d.indexes))
+	for _, idx := range d.indexes {
+		if idx.state != indexStateDropping {
+			infos = append(infos, idx.info())
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Index 返回名为name的索引
+func (d *DB) Index(name string) (*IndexInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	idx, ok := d.indexes[name]
+	if !ok || idx.state == indexStateDropping {
+		return nil, ErrIndexNotFound
+	}
+	info := idx.info()
+	return &info, nil
+}
+
+// IndexQuery 描述索引查询的条件，Eq与Gte、Lte互斥，边界都包含在内
+type IndexQuery struct {
+	Eq, Gte, Lte *string
+	// After 是上一页返回的游标，结果从它之后继续
+	After   []byte
+	Limit   int
+	Reverse bool
+}
+
+// IndexMatch 是索引查询命中的一个键
+type IndexMatch struct {
+	Key   []byte
+	Value []byte
+}
+
+// QueryIndex 按索引值查询键，结果按索引值排序，值相同时按键排序。
+// 还有更多结果时返回下一页的游标，否则游标为nil
+func (d *DB) QueryIndex(name string, q IndexQuery) ([]IndexMatch, []byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	idx, ok := d.indexes[name]
+	if !ok || idx.state == indexStateDropping {
+		return nil, nil, ErrIndexNotFound
+	}
+	if idx.state != IndexStateReady {
+		return nil, nil, ErrIndexNotReady
+	}
+
+	opts, err := idx.queryRange(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 多取一条用于判断是否还有下一页
+	now := time.Now().UnixNano()
+	var keys, entries [][]byte
+	hasMore := false
+	err = d.store.Scan(opts, func(entry []byte, _ []byte) bool {
+		key, ok := idx.decodeEntryKey(entry)
+		if !ok || d.expiredLocked(key, now) {
+			return true
+		}
+		if q.Limit > 0 && len(keys) == q.Limit {
+			hasMore = true
+			return false
+		}
+		keys = append(keys, append([]byte(nil), key...))
+		entries = append(entries, entry[len(idx.entryPrefix):])
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 遍历结束后再读取值，避免在遍历回调中读取存储
+	matches := make([]IndexMatch, 0, len(keys))
+	for _, key := range keys {
+		value, err := d.store.Get(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		matches = append(matches, IndexMatch{Key: key, Value: value})
+	}
+	var cursor []byte
+	if hasMore {
+		cursor = append([]byte(nil), entries[len(entries)-1]...)
+	}
+	return matches, cursor, nil
+}
+
+// queryRange 把查询条件转换为索引记录上的遍历范围
+func (idx *index) queryRange(q IndexQuery) (ScanOptions, error) {
+	opts := ScanOptions{Prefix: idx.entryPrefix, Reverse: q.Reverse, KeysOnly: true}
+	bound := func(v string) ([]byte, error) {
+		var value any = v
+		if idx.def.Type == IndexTypeNumber {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(f) {
+				return nil, ErrInvalidIndexValue
+			}
+			value = f
+		}
+		enc, _ := encodeIndexValue(idx.def.Type, value)
+		return append(append([]byte(nil), idx.entryPrefix...), enc...), nil
+	}
+
+	if q.Eq != nil {
+		q.Gte, q.Lte = q.Eq, q.Eq
+	}
+	if q.Gte != nil {
+		start, err := bound(*q.Gte)
+		if err != nil {
+			return opts, err
+		}
+		opts.Start = start
+	}
+	if q.Lte != nil {
+		end, err := bound(*q.Lte)
+		if err != nil {
+			return opts, err
+		}
+		// 包含值等于Lte的所有记录
+		opts.End = PrefixEnd(end)
+	}
+
+	if q.After != nil {
+		after := append(append([]byte(nil), idx.entryPrefix...), q.After...)
+		if q.Reverse {
+			if opts.End == nil || bytes.Compare(after, opts.End) < 0 {
+				opts.End = after
+			}
+		} else if after = append(after, 0); bytes.Compare(after, opts.Start) > 0 {
+			opts.Start = after
+		}
+	}
+	return opts, nil
+}
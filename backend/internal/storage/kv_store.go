@@ -2,7 +2,10 @@ package storage
 
 import (
 	"FastDB-Web/internal/config"
+	"bytes"
 	"errors"
+	"fmt"
+	"math"
 	"sync"
 
 	fastdb "github.com/qishenonly/FastDB/db"
@@ -15,44 +18,159 @@ type KVStore interface {
 	Delete(key []byte) error
 	Fold(f func(key []byte, value []byte) bool) error
 	GetListKeys() [][]byte
+	// Scan 按键的字典序遍历满足条件的键值对，f返回false时停止遍历
+	Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error
+	// NewWriteBatch 创建一个原子批量写入，Commit时要么全部生效要么全部不生效
+	NewWriteBatch() WriteBatch
+
+	// Stats 返回存储引擎的统计信息
+	Stats() (*StoreStats, error)
 
 	Close() error
 	Sync() error
 }
 
+// WriteBatch 是原子批量写入的接口
+type WriteBatch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Commit() error
+}
+
+var (
+	// ErrKeyNotFound 表示键不存在（或已过期）
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrBatchTooLarge 表示批量写入的操作数超过上限
+	ErrBatchTooLarge = errors.New("too many operations in write batch")
+	// ErrStoreClosed 表示存储已关闭
+	ErrStoreClosed = errors.New("store is closed")
+)
+
+// ScanOptions 描述范围/前缀遍历的条件
+type ScanOptions struct {
+	Prefix  []byte // 只遍历带有该前缀的键
+	Start   []byte // 范围起点（包含），为空表示不限制
+	End     []byte // 范围终点（不包含），为空表示不限制
+	Reverse bool   // 是否按逆序遍历，逆序时从End向Start遍历
+	// KeysOnly 表示调用方只需要键，存储可以不读取值而传入nil
+	KeysOnly bool
+}
+
+// PrefixEnd 返回大于所有带该前缀的键的最小键，可以作为前缀遍历的范围终点，不存在时返回nil
+func PrefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			end := append([]byte(nil), prefix[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+// beforeRange 判断键是否还未进入遍历范围
+func (o ScanOptions) beforeRange(key []byte) bool {
+	if o.Reverse {
+		return len(o.End) > 0 && bytes.Compare(key, o.End) >= 0
+	}
+	return len(o.Start) > 0 && bytes.Compare(key, o.Start) < 0
+}
+
+// afterRange 判断键是否已经越过遍历范围
+func (o ScanOptions) afterRange(key []byte) bool {
+	if o.Reverse {
+		return len(o.Start) > 0 && bytes.Compare(key, o.Start) < 0
+	}
+	return len(o.End) > 0 && bytes.Compare(key, o.End) >= 0
+}
+
 // FastDBStore 是基于FastDB的KV存储实现
 type FastDBStore struct {
-	db *fastdb.DB
-	mu sync.RWMutex
+	db         *fastdb.DB
+	mu         sync.RWMutex
+	syncWrites bool
+	indexType  string
+	closed     bool
+
+	// merges 记录正在进行的合并，关闭存储前需要等待它们结束
+	merges sync.WaitGroup
 }
 
-// NewKVStore 创建一个新的KV存储
+// NewKVStore 创建一个新的KV存储，cacheSize大于0时为磁盘存储加上LRU值缓存
 func NewKVStore(cfg config.StorageConfig) (KVStore, error) {
+	var store KVStore
+	var err error
 	switch cfg.Type {
-	case "fastdb":
-		options := fastdb.DefaultOptions
-		options.DirPath = "../fastdb"
-		db, err := fastdb.NewFastDB(options)
-		if err != nil {
-			panic(err)
-		}
-		return &FastDBStore{db: db}, nil
+	case config.StorageTypeFastDB:
+		store, err = NewFastDBStore(cfg)
+	case config.StorageTypeBBolt:
+		store, err = NewBoltStore(cfg)
+	case config.StorageTypeMemory:
+		// 内存存储本身就在内存中，不需要缓存
+		return NewMemoryStore(), nil
 	default:
-		return nil, errors.New("unsupported storage type")
+		return nil, fmt.Errorf("unsupported storage type: %q", cfg.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CacheSize > 0 {
+		store = NewCachedStore(store, cfg.CacheSize, cfg.CacheMaxBytes)
+	}
+	return store, nil
+}
+
+// NewFastDBStore 根据存储配置打开FastDB
+func NewFastDBStore(cfg config.StorageConfig) (*FastDBStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	options := fastdb.DefaultOptions
+	options.DirPath = cfg.Path
+	options.DataFileSize = cfg.SegmentSize
+	options.SyncWrites = cfg.SyncWrites
+	options.BytesPerSync = cfg.BytesPerSync
+	options.MMapAtStartup = cfg.MMapAtStartup
+	// 是否需要合并由DB的合并策略决定，引擎本身不再拒绝合并
+	options.DataFileMergeRatio = 0
+	switch cfg.IndexType {
+	case config.IndexTypeBTree:
+		options.IndexType = fastdb.BTree
+	case config.IndexTypeART:
+		options.IndexType = fastdb.ART
+	case config.IndexTypeBPTree:
+		options.IndexType = fastdb.BPlusTree
+	}
+
+	db, err := fastdb.NewFastDB(options)
+	if err != nil {
+		return nil, fmt.Errorf("open fastdb at %s: %w", cfg.Path, err)
+	}
+	return &FastDBStore{db: db, syncWrites: cfg.SyncWrites, indexType: cfg.IndexType}, nil
 }
 
 // Get 获取键对应的值
 func (s *FastDBStore) Get(key []byte) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.db.Get(key)
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	value, err := s.db.Get(key)
+	if errors.Is(err, fastdb.ErrKeyNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	return value, err
 }
 
 // Put 设置键值对
 func (s *FastDBStore) Put(key, value []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
 	return s.db.Put(key, value)
 }
 
@@ -60,6 +178,9 @@ func (s *FastDBStore) Put(key, value []byte) error {
 func (s *FastDBStore) Delete(key []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
 	return s.db.Delete(key)
 }
 
@@ -67,6 +188,11 @@ func (s *FastDBStore) Delete(key []byte) error {
 func (s *FastDBStore) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.closed = true
+	s.merges.Wait()
 	return s.db.Close()
 }
 
@@ -74,6 +200,9 @@ func (s *FastDBStore) Close() error {
 func (s *FastDBStore) Sync() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
 	return s.db.Sync()
 }
 
@@ -81,6 +210,9 @@ func (s *FastDBStore) Sync() error {
 func (s *FastDBStore) Fold(f func(key []byte, value []byte) bool) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
 	return s.db.Fold(f)
 }
 
@@ -88,5 +220,149 @@ func (s *FastDBStore) Fold(f func(key []byte, value []byte) bool) error {
 func (s *FastDBStore) GetListKeys() [][]byte {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
 	return s.db.GetListKeys()
 }
+
+// Scan 使用FastDB的迭代器按序遍历，不会一次性加载全部键
+func (s *FastDBStore) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+
+	it := s.db.NewIterator(fastdb.IteratorOptions{
+		Prefix:  opts.Prefix,
+		Reverse: opts.Reverse,
+	})
+	defer it.Close()
+
+	// 定位到范围起点
+	switch {
+	case opts.Reverse && len(opts.End) > 0:
+		it.Seek(opts.End)
+	case !opts.Reverse && len(opts.Start) > 0:
+		it.Seek(opts.Start)
+	default:
+		it.Rewind()
+	}
+
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		if opts.beforeRange(key) {
+			continue
+		}
+		if opts.afterRange(key) {
+			break
+		}
+		var value []byte
+		if !opts.KeysOnly {
+			var err error
+			if value, err = it.Value(); err != nil {
+				return err
+			}
+		}
+		if !f(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// Merge 合并数据文件以回收被删除和覆盖的数据占用的空间，合并期间不阻塞读写
+func (s *FastDBStore) Merge() error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrStoreClosed
+	}
+	s.merges.Add(1)
+	s.mu.RUnlock()
+	defer s.merges.Done()
+
+	if err := s.db.Merge(); err != nil {
+		if errors.Is(err, fastdb.ErrMergeIsProgress) {
+			return ErrMergeInProgress
+		}
+		return err
+	}
+	return nil
+}
+
+// DiskUsage 返回数据目录的磁盘占用以及其中可回收的字节数
+func (s *FastDBStore) DiskUsage() (total, reclaimable int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, 0, ErrStoreClosed
+	}
+	stat := s.db.Stat()
+	return stat.DiskSize, stat.ReclaimableSize, nil
+}
+
+// Stats 返回FastDB引擎的统计信息
+func (s *FastDBStore) Stats() (*StoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	stat := s.db.Stat()
+	return &StoreStats{
+		Engine:          config.StorageTypeFastDB,
+		Version:         moduleVersion(fastDBModulePath),
+		KeyCount:        int64(stat.KeyNum),
+		DiskSize:        stat.DiskSize,
+		ReclaimableSize: stat.ReclaimableSize,
+		SegmentFiles:    int(stat.DataFileNum),
+		IndexMemory:     int64(stat.KeyNum) * fastDBIndexEntrySize[s.indexType],
+	}, nil
+}
+
+// NewWriteBatch 创建基于FastDB WriteBatch的批量写入。每个用户操作都会带上数量不定的附属记录
+// （过期时间、元数据、历史版本、二级索引、全文索引、复制日志），引擎按操作数的限制无法与
+// maxBatchOps对应，因此不限制操作数：用户的批量写入由DB按maxBatchOps限制，后台任务自行分批
+func (s *FastDBStore) NewWriteBatch() WriteBatch {
+	options := fastdb.DefaultWriteBatchOptions
+	options.MaxBatchNum = math.MaxUint
+	options.SyncWrites = s.syncWrites
+	return &fastDBWriteBatch{
+		store: s,
+		wb:    s.db.NewWriteBatch(options),
+	}
+}
+
+// fastDBWriteBatch 包装FastDB的WriteBatch，提交时持有存储的写锁
+type fastDBWriteBatch struct {
+	store *FastDBStore
+	wb    *fastdb.WriteBatch
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *fastDBWriteBatch) Put(key, value []byte) error {
+	return b.wb.Put(key, value)
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *fastDBWriteBatch) Delete(key []byte) error {
+	return b.wb.Delete(key)
+}
+
+// Commit 原子地提交所有操作
+func (b *fastDBWriteBatch) Commit() error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+	if b.store.closed {
+		return ErrStoreClosed
+	}
+	if err := b.wb.Commit(); err != nil {
+		if errors.Is(err, fastdb.ErrExceedMaxBatchNum) {
+			return ErrBatchTooLarge
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"bytes"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+// memoryItem 是内存存储中的一个键值对
+type memoryItem struct {
+	key   []byte
+	value []byte
+}
+
+// memoryItemOverhead 估算每个键值对在B树中除键值本身外占用的字节数
+const memoryItemOverhead = 64
+
+func memoryItemLess(a, b memoryItem) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// MemoryStore 是基于内存B树的KV存储实现，进程退出后数据丢失，主要用于测试
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tree   *btree.BTreeG[memoryItem]
+	size   int64 // 所有键和值占用的字节数
+	closed bool
+}
+
+// NewMemoryStore 创建一个空的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tree: btree.NewG(32, memoryItemLess)}
+}
+
+// cloneBytes 复制字节切片，避免调用方修改存储中的数据
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// Get 获取键对应的值
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	item, ok := s.tree.Get(memoryItem{key: key})
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return cloneBytes(item.value), nil
+}
+
+// Put 设置键值对
+func (s *MemoryStore) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.insertLocked(memoryItem{key: cloneBytes(key), value: cloneBytes(value)})
+	return nil
+}
+
+// Delete 删除键值对，键不存在时不返回错误
+func (s *MemoryStore) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.deleteLocked(key)
+	return nil
+}
+
+// Fold 按键的顺序遍历所有键值对
+func (s *MemoryStore) Fold(f func(key []byte, value []byte) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.tree.Ascend(func(item memoryItem) bool {
+		return f(cloneBytes(item.key), cloneBytes(item.value))
+	})
+	return nil
+}
+
+// GetListKeys 按顺序获取所有的键
+func (s *MemoryStore) GetListKeys() [][]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	keys := make([][]byte, 0, s.tree.Len())
+	s.tree.Ascend(func(item memoryItem) bool {
+		keys = append(keys, cloneBytes(item.key))
+		return true
+	})
+	return keys
+}
+
+// Scan 按序遍历满足条件的键值对
+func (s *MemoryStore) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+
+	visit := func(item memoryItem) bool {
+		if !bytes.HasPrefix(item.key, opts.Prefix) {
+			// 已经越过前缀对应的区间时停止遍历
+			cmp := bytes.Compare(item.key, opts.Prefix)
+			return (opts.Reverse && cmp > 0) || (!opts.Reverse && cmp < 0)
+		}
+		if opts.beforeRange(item.key) {
+			return true
+		}
+		if opts.afterRange(item.key) {
+			return false
+		}
+		return f(cloneBytes(item.key), cloneBytes(item.value))
+	}
+
+	if opts.Reverse {
+		if len(opts.End) > 0 {
+			s.tree.DescendLessOrEqual(memoryItem{key: opts.End}, visit)
+		} else {
+			s.tree.Descend(visit)
+		}
+		return nil
+	}
+
+	// 正序遍历直接从范围起点和前缀中较大的一个开始
+	pivot := opts.Start
+	if bytes.Compare(opts.Prefix, pivot) > 0 {
+		pivot = opts.Prefix
+	}
+	s.tree.AscendGreaterOrEqual(memoryItem{key: pivot}, visit)
+	return nil
+}
+
+// insertLocked 插入或替换键值对并更新占用的字节数，调用方必须持有写锁
+func (s *MemoryStore) insertLocked(item memoryItem) {
+	if old, ok := s.tree.ReplaceOrInsert(item); ok {
+		s.size -= int64(len(old.key) + len(old.value))
+	}
+	s.size += int64(len(item.key) + len(item.value))
+}
+
+// deleteLocked 删除键值对并更新占用的字节数，调用方必须持有写锁
+func (s *MemoryStore) deleteLocked(key []byte) {
+	if old, ok := s.tree.Delete(memoryItem{key: key}); ok {
+		s.size -= int64(len(old.key) + len(old.value))
+	}
+}
+
+// Stats 返回内存存储的统计信息，数据全部在内存中，没有磁盘占用
+func (s *MemoryStore) Stats() (*StoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	return &StoreStats{
+		Engine:      config.StorageTypeMemory,
+		KeyCount:    int64(s.tree.Len()),
+		IndexMemory: s.size + int64(s.tree.Len())*memoryItemOverhead,
+	}, nil
+}
+
+// NewWriteBatch 创建内存存储的批量写入
+func (s *MemoryStore) NewWriteBatch() WriteBatch {
+	return &memoryWriteBatch{store: s}
+}
+
+// Close 关闭存储并释放数据
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.closed = true
+	s.tree.Clear(false)
+	s.size = 0
+	return nil
+}
+
+// Sync 内存存储无需持久化
+func (s *MemoryStore) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+// memoryWriteBatch 缓存操作，提交时在同一把写锁内全部应用
+type memoryWriteBatch struct {
+	store *MemoryStore
+	ops   []memoryBatchOp
+}
+
+type memoryBatchOp struct {
+	item   memoryItem
+	delete bool
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *memoryWriteBatch) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	b.ops = append(b.ops, memoryBatchOp{item: memoryItem{key: cloneBytes(key), value: cloneBytes(value)}})
+	return nil
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *memoryWriteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	b.ops = append(b.ops, memoryBatchOp{item: memoryItem{key: cloneBytes(key)}, delete: true})
+	return nil
+}
+
+// Commit 原子地提交所有操作
+func (b *memoryWriteBatch) Commit() error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+	if b.store.closed {
+		return ErrStoreClosed
+	}
+	for _, op := range b.ops {
+		if op.delete {
+			b.store.deleteLocked(op.item.key)
+		} else {
+			b.store.insertLocked(op.item)
+		}
+	}
+	b.ops = nil
+	return nil
+}
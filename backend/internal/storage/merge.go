@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"FastDB-Web/internal/logger"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 触发合并的方式
+const (
+	MergeTriggerManual   = "manual"
+	MergeTriggerRatio    = "ratio"
+	MergeTriggerSchedule = "schedule"
+)
+
+// mergeCheckInterval 是合并策略检查可回收空间的间隔
+const mergeCheckInterval = time.Minute
+
+var (
+	// ErrMergeInProgress 表示已经有合并正在进行
+	ErrMergeInProgress = errors.New("merge is already in progress")
+	// ErrMergeUnsupported 表示存储引擎不需要也不支持合并
+	ErrMergeUnsupported = errors.New("storage engine does not support merge")
+)
+
+// Merger 由日志结构、需要合并才能回收空间的存储实现
+type Merger interface {
+	// Merge 合并数据文件，返回前不能再次调用
+	Merge() error
+	// DiskUsage 返回数据目录的磁盘占用以及其中可回收的字节数
+	DiskUsage() (total, reclaimable int64, err error)
+}
+
+// mergerOf 返回存储（或被包装的存储）实现的Merger
+func mergerOf(store KVStore) (Merger, bool) {
+	if dump, ok := store.(*dumpStore); ok {
+		store = dump.Unwrap()
+	}
+	if cached, ok := store.(*CachedStore); ok {
+		store = cached.Unwrap()
+	}
+	merger, ok := store.(Merger)
+	return merger, ok
+}
+
+// MergeRun 描述一次合并
+type MergeRun struct {
+	Trigger           string     `json:"trigger"`
+	StartedAt         time.Time  `json:"startedAt"`
+	FinishedAt        *time.Time `json:"finishedAt,omitempty"`
+	DurationMs        int64      `json:"durationMs"` // 进行中的合并为已经过的时间
+	DiskSizeBefore    int64      `json:"diskSizeBefore"`
+	ReclaimableBefore int64      `json:"reclaimableBefore"` // 合并开始时预计可回收的字节数
+	DiskSizeAfter     int64      `json:"diskSizeAfter,omitempty"`
+	BytesReclaimed    int64      `json:"bytesReclaimed"`
+	Error             string     `json:"error,omitempty"`
+}
+
+// MergePolicy 描述自动合并的策略
+type MergePolicy struct {
+	Ratio    float64 `json:"ratio"`    // 可回收空间占比超过该值时合并，0表示不启用
+	Interval int     `json:"interval"` // 定期合并的间隔（秒），0表示不启用
+}
+
+// MergeStatus 描述数据库的合并状态
+type MergeStatus struct {
+	Supported bool        `json:"supported"`
+	Running   bool        `json:"running"`
+	Current   *MergeRun   `json:"current,omitempty"`
+	Last      *MergeRun   `json:"last,omitempty"`
+	Policy    MergePolicy `json:"policy"`
+}
+
+// StartMerge 在后台开始一次合并并立即返回，已有合并在进行时返回ErrMergeInProgress
+func (d *DB) StartMerge(trigger string) (*MergeRun, error) {
+	merger, ok := mergerOf(d.store)
+	if !ok {
+		return nil, ErrMergeUnsupported
+	}
+
+	d.mergeMu.Lock()
+	defer d.mergeMu.Unlock()
+	if d.mergeCurrent != nil {
+		return nil, ErrMergeInProgress
+	}
+	total, reclaimable, err := merger.DiskUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &MergeRun{
+		Trigger:           trigger,
+		StartedAt:         time.Now(),
+		DiskSizeBefore:    total,
+		ReclaimableBefore: reclaimable,
+	}
+	d.mergeCurrent = run
+	go d.runMerge(merger, run)
+
+	snapshot := *run
+	return &snapshot, nil
+}
+
+func (d *DB) runMerge(merger Merger, run *MergeRun) {
+	logger.Info("开始合并数据文件",
+		zap.String("trigger", run.Trigger),
+		zap.Int64("diskSize", run.DiskSizeBefore),
+		zap.Int64("reclaimable", run.ReclaimableBefore),
+	)
+	err := merger.Merge()
+	total, _, usageErr := merger.DiskUsage()
+	finished := time.Now()
+
+	d.mergeMu.Lock()
+	defer d.mergeMu.Unlock()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	if err == nil {
+		err = usageErr
+	}
+	if err != nil {
+		run.Error = err.Error()
+		logger.Error("合并数据文件失败", zap.String("trigger", run.Trigger), zap.Error(err))
+	} else {
+		run.DiskSizeAfter = total
+		run.BytesReclaimed = max(run.DiskSizeBefore-total, 0)
+		logger.Info("合并数据文件完成",
+			zap.String("trigger", run.Trigger),
+			zap.Int64("durationMs", run.DurationMs),
+			zap.Int64("reclaimed", run.BytesReclaimed),
+		)
+	}
+	d.mergeCurrent = nil
+	d.mergeLast = run
+}
+
+// MergeStatus 返回数据库当前的合并状态
+func (d *DB) MergeStatus() MergeStatus {
+	_, supported := mergerOf(d.store)
+	status := MergeStatus{
+		Supported: supported,
+		Policy: MergePolicy{
+			Ratio:    d.mergeRatio,
+			Interval: int(d.mergeInterval / time.Second),
+		},
+	}
+
+	d.mergeMu.Lock()
+	defer d.mergeMu.Unlock()
+	if d.mergeCurrent != nil {
+		current := *d.mergeCurrent
+		current.DurationMs = time.Since(current.StartedAt).Milliseconds()
+		status.Running = true
+		status.Current = &current
+	}
+	if d.mergeLast != nil {
+		last := *d.mergeLast
+		status.Last = &last
+	}
+	return status
+}
+
+// StartMergePolicy 按配置的策略在后台自动合并，未配置策略或引擎不支持合并时不做任何事
+func (d *DB) StartMergePolicy() {
+	if _, ok := mergerOf(d.store); !ok || (d.mergeRatio <= 0 && d.mergeInterval <= 0) {
+		return
+	}
+	d.mergeMu.Lock()
+	defer d.mergeMu.Unlock()
+	if d.mergePolicyStop != nil {
+		return
+	}
+	d.mergePolicyStop = make(chan struct{})
+	d.mergePolicyDone = make(chan struct{})
+	go d.mergePolicyLoop(d.mergePolicyStop, d.mergePolicyDone)
+}
+
+// StopMergePolicy 停止自动合并并等待其退出，不会中断正在进行的合并
+func (d *DB) StopMergePolicy() {
+	d.mergeMu.Lock()
+	stop, done := d.mergePolicyStop, d.mergePolicyDone
+	d.mergePolicyStop, d.mergePolicyDone = nil, nil
+	d.mergeMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (d *DB) mergePolicyLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	interval := mergeCheckInterval
+	if d.mergeInterval > 0 && d.mergeInterval < interval {
+		interval = d.mergeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastScheduled := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			trigger := d.mergeTrigger(now, lastScheduled)
+			if trigger == "" {
+				continue
+			}
+			if trigger == MergeTriggerSchedule {
+				lastScheduled = now
+			}
+			if _, err := d.StartMerge(trigger); err != nil && !errors.Is(err, ErrMergeInProgress) {
+				logger.Error("自动合并失败", zap.String("trigger", trigger), zap.Error(err))
+			}
+		}
+	}
+}
+
+// mergeTrigger 判断此刻是否需要合并，返回触发方式，不需要时返回空字符串
+func (d *DB) mergeTrigger(now, lastScheduled time.Time) string {
+	if d.mergeInterval > 0 && now.Sub(lastScheduled) >= d.mergeInterval {
+		return MergeTriggerSchedule
+	}
+	if merger, ok := mergerOf(d.store); ok && d.mergeRatio > 0 {
+		total, reclaimable, err := merger.DiskUsage()
+		if err == nil && total > 0 && float64(reclaimable)/float64(total) >= d.mergeRatio {
+			return MergeTriggerRatio
+		}
+	}
+	return ""
+}
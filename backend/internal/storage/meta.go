@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// metaNamespace 是存放键元数据的内部命名空间
+const metaNamespace = "meta"
+
+// KeyMeta 是每个键的元数据，随每次写入一起原子更新
+type KeyMeta struct {
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   uint64    `json:"version"` // 每次写入加1，从1开始
+	Size      int       `json:"size"`    // 值的字节数
+}
+
+// storedMeta 是元数据的存储格式
+type storedMeta struct {
+	CreatedAt int64  `json:"c"`
+	UpdatedAt int64  `json:"u"`
+	Version   uint64 `json:"v"`
+	Size      int    `json:"s"`
+}
+
+func encodeMeta(m KeyMeta) []byte {
+	data, _ := json.Marshal(storedMeta{
+		CreatedAt: m.CreatedAt.UnixNano(),
+		UpdatedAt: m.UpdatedAt.UnixNano(),
+		Version:   m.Version,
+		Size:      m.Size,
+	})
+	return data
+}
+
+func decodeMeta(data []byte) (KeyMeta, error) {
+	var sm storedMeta
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return KeyMeta{}, err
+	}
+	return KeyMeta{
+		CreatedAt: time.Unix(0, sm.CreatedAt),
+		UpdatedAt: time.Unix(0, sm.UpdatedAt),
+		Version:   sm.Version,
+		Size:      sm.Size,
+	}, nil
+}
+
+// readMetaLocked 从存储中读取键的元数据，没有元数据时ok为false
+func (d *DB) readMetaLocked(key []byte) (meta KeyMeta, ok bool, err error) {
+	data, err := d.store.Get(internalKey(metaNamespace, key))
+	if errors.Is(err, ErrKeyNotFound) {
+		return KeyMeta{}, false, nil
+	}
+	if err != nil {
+		return KeyMeta{}, false, err
+	}
+	meta, err = decodeMeta(data)
+	if err != nil {
+		return KeyMeta{}, false, err
+	}
+	return meta, true, nil
+}
+
+// stageMeta 把写操作对元数据的修改加入批量写入，
+// pending记录本批次内已经暂存的元数据，nil表示已删除
+func (d *DB) stageMeta(batch WriteBatch, op writeOp, now time.Time, pending map[string]*KeyMeta, history map[string]uint64) error {
+	key := string(op.key)
+	metaKey := internalKey(metaNamespace, op.key)
+	if op.delete {
+		pending[key] = nil
+		return batch.Delete(metaKey)
+	}
+
+	prev, staged := pending[key]
+	// 已过期但尚未清理的键与Get一样视为不存在，重新写入时创建时间和版本号不沿用旧值
+	if !staged && !d.expiredLocked(op.key, now.UnixNano()) {
+		meta, ok, err := d.readMetaLocked(op.key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			prev = &meta
+		}
+	}
+
+	next := KeyMeta{
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+		Size:      len(op.value),
+	}
+	if prev != nil {
+		next.CreatedAt = prev.CreatedAt
+		next.Version = prev.Version + 1
+	} else {
+		// 删除后保留了历史版本的键继续编号
+		last, err := d.lastHistoryVersionLocked(op.key, history)
+		if err != nil {
+			return err
+		}
+		next.Version = last + 1
+	}
+	pending[key] = &next
+	return batch.Put(metaKey, encodeMeta(next))
+}
+
+// GetWithMeta 获取键的值和元数据，键存在但没有元数据（如旧版本写入的数据）时meta为nil
+func (d *DB) GetWithMeta(key []byte) ([]byte, *KeyMeta, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.expiredLocked(key, time.Now().UnixNano()) {
+		return nil, nil, ErrKeyNotFound
+	}
+	value, err := d.store.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, ok, err := d.readMetaLocked(key)
+	if err != nil || !ok {
+		return value, nil, err
+	}
+	return value, &meta, nil
+}
+
+// GetMetas 批量获取键的元数据，结果与keys一一对应，没有元数据的位置为nil
+func (d *DB) GetMetas(keys [][]byte) ([]*KeyMeta, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	metas := make([]*KeyMeta, len(keys))
+	for i, key := range keys {
+		meta, ok, err := d.readMetaLocked(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			metas[i] = &meta
+		}
+	}
+	return metas, nil
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// namespaceLockStripes 是命名空间键锁的分段数
+const namespaceLockStripes = 64
+
+// Namespace 是DB中的一个内部命名空间，供数据结构等上层模块存放自己的记录。
+// 它实现了KVStore，键对用户的键值接口不可见，写入与DB的其他写入串行，
+// 因此备份得到的仍是一致的快照。Namespace不拥有底层存储，Close不做任何事
+type Namespace struct {
+	db     *DB
+	prefix []byte
+	locks  [namespaceLockStripes]sync.Mutex
+}
+
+// Namespace 返回名为name的内部命名空间，同一个名称总是返回同一个实例。
+// ttl、meta、index、search、history、replication由DB自身使用，名称不能为空或包含0x00，否则panic
+func (d *DB) Namespace(name string) *Namespace {
+	if name == "" || name == ttlNamespace || name == metaNamespace || name == indexNamespace || name == searchNamespace || name == historyNamespace || name == replicationNamespace || strings.IndexByte(name, internalKeyPrefix) >= 0 {
+		panic("storage: invalid namespace " + name)
+	}
+	d.nsMu.Lock()
+	defer d.nsMu.Unlock()
+	if ns, ok := d.namespaces[name]; ok {
+		return ns
+	}
+	if d.namespaces == nil {
+		d.namespaces = make(map[string]*Namespace)
+	}
+	ns := &Namespace{db: d, prefix: internalKey(name, nil)}
+	d.namespaces[name] = ns
+	return ns
+}
+
+// LockKey 锁住key所在的分段，返回解锁函数，用于串行化同一个键上的读-改-写
+func (n *Namespace) LockKey(key []byte) (unlock func()) {
+	h := fnv.New32a()
+	h.Write(key)
+	mu := &n.locks[h.Sum32()%namespaceLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (n *Namespace) key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(n.prefix)+len(key)), n.prefix...), key...)
+}
+
+// Get 获取键对应的值
+func (n *Namespace) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	n.db.mu.RLock()
+	defer n.db.mu.RUnlock()
+	return n.db.store.Get(n.key(key))
+}
+
+// Put 设置键值对
+func (n *Namespace) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	n.db.mu.Lock()
+	defer n.db.mu.Unlock()
+	_, err := n.db.applyLocked([]writeOp{{key: n.key(key), value: value, raw: true}})
+	return err
+}
+
+// Delete 删除键值对
+func (n *Namespace) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	n.db.mu.Lock()
+	defer n.db.mu.Unlock()
+	_, err := n.db.applyLocked([]writeOp{{key: n.key(key), delete: true, raw: true}})
+	return err
+}
+
+// Fold 按序遍历命名空间中的所有键值对
+func (n *Namespace) Fold(f func(key []byte, value []byte) bool) error {
+	return n.Scan(ScanOptions{}, f)
+}
+
+// GetListKeys 按序获取命名空间中所有的键
+func (n *Namespace) GetListKeys() [][]byte {
+	var keys [][]byte
+	n.Scan(ScanOptions{KeysOnly: true}, func(key []byte, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Scan 按序遍历命名空间中满足条件的键值对，传给f的键不带命名空间前缀
+func (n *Namespace) Scan(opts ScanOptions, f func(key []byte, value []byte) bool) error {
+	inner := ScanOptions{
+		Prefix:   n.key(opts.Prefix),
+		Reverse:  opts.Reverse,
+		KeysOnly: opts.KeysOnly,
+	}
+	if len(opts.Start) > 0 {
+		inner.Start = n.key(opts.Start)
+	}
+	if len(opts.End) > 0 {
+		inner.End = n.key(opts.End)
+	}
+	n.db.mu.RLock()
+	defer n.db.mu.RUnlock()
+	return n.db.store.Scan(inner, func(key []byte, value []byte) bool {
+		return f(bytes.Clone(key[len(n.prefix):]), value)
+	})
+}
+
+// NewWriteBatch 创建命名空间内的原子批量写入
+func (n *Namespace) NewWriteBatch() WriteBatch {
+	return &namespaceWriteBatch{ns: n}
+}
+
+// Stats 返回底层存储的统计信息
+func (n *Namespace) Stats() (*StoreStats, error) {
+	return n.db.store.Stats()
+}
+
+// Close 命名空间不拥有底层存储，由DB负责关闭
+func (n *Namespace) Close() error {
+	return nil
+}
+
+// Sync 持久化底层存储的数据
+func (n *Namespace) Sync() error {
+	return n.db.store.Sync()
+}
+
+// namespaceWriteBatch 给键加上命名空间前缀，提交时持有DB的写锁，与DB的其他写入一样记录复制日志。
+// 它不限制操作数，可能涉及大量记录的操作（如删除整个数据结构）由调用方分批提交
+type namespaceWriteBatch struct {
+	ns  *Namespace
+	ops []writeOp
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *namespaceWriteBatch) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	b.ops = append(b.ops, writeOp{key: b.ns.key(key), value: value, raw: true})
+	return nil
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *namespaceWriteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	b.ops = append(b.ops, writeOp{key: b.ns.key(key), delete: true, raw: true})
+	return nil
+}
+
+// Commit 原子地提交所有操作
+func (b *namespaceWriteBatch) Commit() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	b.ns.db.mu.Lock()
+	defer b.ns.db.mu.Unlock()
+	_, err := b.ns.db.applyLocked(b.ops)
+	return err
+}
@@ -0,0 +1,531 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrDatabaseNotFound 表示命名数据库不存在
+	ErrDatabaseNotFound = errors.New("database not found")
+	// ErrDatabaseExists 表示命名数据库已存在
+	ErrDatabaseExists = errors.New("database already exists")
+	// ErrInvalidDatabaseName 表示数据库名不合法
+	ErrInvalidDatabaseName = errors.New("invalid database name")
+	// ErrDropDefaultDatabase 表示不能删除默认数据库
+	ErrDropDefaultDatabase = errors.New("cannot drop the default database")
+)
+
+// databaseNamePattern 限制数据库名只能包含字母、数字、下划线和连字符
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// reservedDatabaseNames 与 /api/v1/db 下的固定路由重名，不能作为数据库名
+var reservedDatabaseNames = map[string]bool{
+	"connect": true,
+	"status":  true,
+	"close":   true,
+	"stats":   true,
+}
+
+const (
+	// mergeDirSuffix 是FastDB合并时在数据目录旁创建的临时目录后缀
+	mergeDirSuffix = "-merge"
+	// restoreDirSuffix 是恢复备份时暂存原数据目录的后缀
+	restoreDirSuffix = "-restoring"
+)
+
+// DatabaseInfo 描述一个命名数据库
+type DatabaseInfo struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Default bool   `json:"default"`
+	Open    bool   `json:"open"`
+}
+
+// Registry 管理同一进程内的多个命名数据库，每个数据库位于数据目录下的独立子目录，
+// 首次访问时才打开
+type Registry struct {
+	cfg         config.StorageConfig
+	defaultName string
+	defaultPath string
+
+	mu  sync.RWMutex
+	dbs map[string]*DB
+}
+
+// NewRegistry 创建数据库注册表并打开默认数据库
+func NewRegistry(cfg config.StorageConfig) (*Registry, error) {
+	if err := validateDatabaseName(cfg.DefaultDatabase); err != nil {
+		return nil, fmt.Errorf("default database %q: %w", cfg.DefaultDatabase, err)
+	}
+
+	r := &Registry{
+		cfg:         cfg,
+		defaultName: cfg.DefaultDatabase,
+		defaultPath: filepath.Join(cfg.Path, cfg.DefaultDatabase),
+		dbs:         make(map[string]*DB),
+	}
+
+	// 兼容旧版本：数据目录下直接存放着数据文件时，默认数据库继续使用该目录
+	if hasDataFiles(cfg.Path) && !dirExists(r.defaultPath) {
+		logger.Warn("检测到旧版本的数据目录布局，默认数据库继续使用数据目录",
+			zap.String("path", cfg.Path),
+			zap.String("database", r.defaultName),
+		)
+		r.defaultPath = cfg.Path
+	}
+
+	if _, err := r.open(r.defaultName, true); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validateDatabaseName 校验数据库名
+func validateDatabaseName(name string) error {
+	if !databaseNamePattern.MatchString(name) ||
+		reservedDatabaseNames[name] ||
+		strings.HasSuffix(name, mergeDirSuffix) ||
+		strings.HasSuffix(name, restoreDirSuffix) {
+		return ErrInvalidDatabaseName
+	}
+	return nil
+}
+
+// hasDataFiles 判断目录下是否直接存放着FastDB数据文件
+func hasDataFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".data") {
+			return true
+		}
+	}
+	return false
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// pathOf 返回数据库的数据目录
+func (r *Registry) pathOf(name string) string {
+	if name == r.defaultName {
+		return r.defaultPath
+	}
+	return filepath.Join(r.cfg.Path, name)
+}
+
+// open 打开数据库，create为false时要求数据目录已存在
+func (r *Registry) open(name string, create bool) (*DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if db, ok := r.dbs[name]; ok {
+		return db, nil
+	}
+
+	path := r.pathOf(name)
+	if !create && !dirExists(path) {
+		return nil, ErrDatabaseNotFound
+	}
+	return r.openLocked(name, path, nil)
+}
+
+// openLocked 打开path处的数据库并登记到注册表，load不为nil时先用它填充新打开的存储，
+// 调用方必须持有写锁
+func (r *Registry) openLocked(name, path string, load func(KVStore) error) (*DB, error) {
+	// 内存存储不会自己创建数据目录，这里统一创建以便后续按目录发现数据库
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("create database %s: %w", name, err)
+	}
+
+	cfg := r.cfg
+	cfg.Path = path
+	cfg.Replication.Role = r.replicationRole(name)
+	store, err := NewKVStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open database %s: %w", name, err)
+	}
+	if load != nil {
+		if err := load(store); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	db, err := NewDB(store, cfg)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("open database %s: %w", name, err)
+	}
+	db.StartReaper()
+	db.StartMergePolicy()
+	r.dbs[name] = db
+
+	logger.Info("打开数据库", zap.String("database", name), zap.String("path", path))
+	return db, nil
+}
+
+// replicationRole 返回数据库在本节点上的复制角色：主节点上所有数据库都记录复制日志，
+// 从节点上只有被复制的数据库是只读副本
+func (r *Registry) replicationRole(name string) string {
+	if r.cfg.Replication.Role != config.ReplicationRoleFollower {
+		return r.cfg.Replication.Role
+	}
+	for _, replicated := range r.Replicated() {
+		if replicated == name {
+			return config.ReplicationRoleFollower
+		}
+	}
+	return ""
+}
+
+// Replication 返回复制配置
+func (r *Registry) Replication() config.ReplicationConfig {
+	return r.cfg.Replication
+}
+
+// Replicated 返回从节点复制的数据库，未配置时只复制默认数据库
+func (r *Registry) Replicated() []string {
+	if len(r.cfg.Replication.Databases) == 0 {
+		return []string{r.defaultName}
+	}
+	return r.cfg.Replication.Databases
+}
+
+// Default 返回默认数据库
+func (r *Registry) Default() *DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dbs[r.defaultName]
+}
+
+// DefaultName 返回默认数据库的名称
+func (r *Registry) DefaultName() string {
+	return r.defaultName
+}
+
+// Get 返回已存在的命名数据库，必要时打开它
+func (r *Registry) Get(name string) (*DB, error) {
+	if err := validateDatabaseName(name); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	db, ok := r.dbs[name]
+	r.mu.RUnlock()
+	if ok {
+		return db, nil
+	}
+	return r.open(name, false)
+}
+
+// Create 创建并打开一个新的命名数据库。检查与登记在同一把写锁内完成，
+// 并发创建同名数据库时只有一个成功，其余返回ErrDatabaseExists
+func (r *Registry) Create(name string) (*DB, error) {
+	if err := validateDatabaseName(name); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := r.pathOf(name)
+	if _, ok := r.dbs[name]; ok || dirExists(path) {
+		return nil, ErrDatabaseExists
+	}
+	return r.openLocked(name, path, nil)
+}
+
+// List 列出所有命名数据库
+func (r *Registry) List() ([]DatabaseInfo, error) {
+	entries, err := os.ReadDir(r.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := map[string]bool{r.defaultName: true}
+	for _, e := range entries {
+		if e.IsDir() && validateDatabaseName(e.Name()) == nil {
+			names[e.Name()] = true
+		}
+	}
+
+	infos := make([]DatabaseInfo, 0, len(names))
+	for name := range names {
+		_, open := r.dbs[name]
+		infos = append(infos, DatabaseInfo{
+			Name:    name,
+			Path:    r.pathOf(name),
+			Default: name == r.defaultName,
+			Open:    open,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Drop 关闭并删除命名数据库及其数据目录，默认数据库不能删除
+func (r *Registry) Drop(name string) error {
+	if err := validateDatabaseName(name); err != nil {
+		return err
+	}
+	if name == r.defaultName {
+		return ErrDropDefaultDatabase
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := r.pathOf(name)
+	db, open := r.dbs[name]
+	if !open && !dirExists(path) {
+		return ErrDatabaseNotFound
+	}
+	if open {
+		if err := db.Close(); err != nil {
+			return fmt.Errorf("close database %s: %w", name, err)
+		}
+		delete(r.dbs, name)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	os.RemoveAll(path + mergeDirSuffix)
+
+	logger.Info("删除数据库", zap.String("database", name), zap.String("path", path))
+	return nil
+}
+
+// Sync 持久化所有已打开的数据库
+func (r *Registry) Sync() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var errs []error
+	for _, db := range r.dbs {
+		if err := db.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 关闭所有已打开的数据库
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for name, db := range r.dbs {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close database %s: %w", name, err))
+		}
+		delete(r.dbs, name)
+	}
+	return errors.Join(errs...)
+}
+
+// Backup 为命名数据库创建一个一致的备份归档，写入配置的备份目录
+func (r *Registry) Backup(name string) (*BackupInfo, error) {
+	db, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(r.cfg.BackupDir, 0755); err != nil {
+		return nil, err
+	}
+
+	file := backupFileName(name, time.Now())
+	path := filepath.Join(r.cfg.BackupDir, file)
+	manifest, err := writeBackup(db, name, r.cfg.Type, path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("创建备份",
+		zap.String("database", name),
+		zap.String("file", path),
+		zap.Int("records", manifest.Records),
+		zap.Int64("size", info.Size()),
+	)
+	return &BackupInfo{File: file, Size: info.Size(), Manifest: manifest}, nil
+}
+
+// ListBackups 列出备份目录中的备份归档，按文件名排序
+func (r *Registry) ListBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(r.cfg.BackupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]BackupInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || validateBackupFile(e.Name()) != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backup := BackupInfo{File: e.Name(), Size: info.Size()}
+		// 清单无法读取的归档仍然列出，恢复时会被拒绝
+		backup.Manifest, _ = readBackupManifest(filepath.Join(r.cfg.BackupDir, e.Name()))
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+// Restore 校验备份归档并用它替换命名数据库的全部数据，name为空时恢复到归档记录的数据库。
+// 恢复期间数据库会被关闭再重新打开，调用方需要保证没有请求正在使用它
+func (r *Registry) Restore(name, file string) (*BackupManifest, error) {
+	if err := validateBackupFile(file); err != nil {
+		return nil, err
+	}
+	archive := filepath.Join(r.cfg.BackupDir, file)
+	if _, err := os.Stat(archive); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrBackupNotFound
+		}
+		return nil, err
+	}
+
+	// 先完整校验归档，校验失败时不影响当前数据
+	manifest, dump, err := extractBackup(archive, r.cfg.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dump)
+
+	if name == "" {
+		name = manifest.Database
+	}
+	if err := validateDatabaseName(name); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.replaceLocked(name, func(store KVStore) error {
+		f, err := os.Open(dump)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = loadDump(store, f, r.cfg.MaxBatchOps)
+		return err
+	})
+	if err != nil {
+		logger.Error("恢复备份失败，已回滚到原数据",
+			zap.String("database", name),
+			zap.String("file", archive),
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("restore database %s: %w", name, err)
+	}
+
+	logger.Info("恢复备份",
+		zap.String("database", name),
+		zap.String("file", archive),
+		zap.Int("records", manifest.Records),
+	)
+	return manifest, nil
+}
+
+// LoadSnapshot 用主节点的快照替换从节点上命名数据库的全部数据，并记录快照对应的日志位置，
+// 返回加载的记录数。与Restore一样，加载期间数据库会被关闭再重新打开
+func (r *Registry) LoadSnapshot(name string, snapshot io.Reader, pos ReplicationPosition) (int, error) {
+	if err := validateDatabaseName(name); err != nil {
+		return 0, err
+	}
+	position, err := json.Marshal(pos)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	err = r.replaceLocked(name, func(store KVStore) error {
+		var err error
+		if count, err = loadDump(store, snapshot, r.cfg.MaxBatchOps); err != nil {
+			return err
+		}
+		return store.Put(replicaPositionKey(), position)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("load snapshot into database %s: %w", name, err)
+	}
+	return count, nil
+}
+
+// replaceLocked 关闭数据库，在新的数据目录中用load填充数据后重新打开，
+// 失败时恢复原来的数据目录，调用方必须持有写锁
+func (r *Registry) replaceLocked(name string, load func(KVStore) error) error {
+	oldPath := r.pathOf(name)
+	path := oldPath
+	if path == r.cfg.Path {
+		// 旧版本布局的默认数据库替换到独立的子目录中
+		path = filepath.Join(r.cfg.Path, name)
+	}
+
+	if db, ok := r.dbs[name]; ok {
+		if err := db.Close(); err != nil {
+			return fmt.Errorf("close database %s: %w", name, err)
+		}
+		delete(r.dbs, name)
+	}
+
+	// 原数据目录先移到一旁，替换成功后再删除
+	aside := path + restoreDirSuffix
+	os.RemoveAll(aside)
+	if dirExists(path) {
+		if err := os.Rename(path, aside); err != nil {
+			r.reopenLocked(name, oldPath)
+			return err
+		}
+	}
+
+	if _, err := r.openLocked(name, path, load); err != nil {
+		os.RemoveAll(path)
+		if dirExists(aside) {
+			os.Rename(aside, path)
+		}
+		r.reopenLocked(name, oldPath)
+		return err
+	}
+	os.RemoveAll(aside)
+	if name == r.defaultName {
+		r.defaultPath = path
+	}
+	return nil
+}
+
+// reopenLocked 在替换失败后重新打开原来的数据库，调用方必须持有写锁
+func (r *Registry) reopenLocked(name, path string) {
+	if !dirExists(path) && name != r.defaultName {
+		return
+	}
+	if _, err := r.openLocked(name, path, nil); err != nil {
+		logger.Error("重新打开数据库失败", zap.String("database", name), zap.Error(err))
+	}
+}
@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// replicationNamespace 是存放复制日志和复制位置的内部命名空间：
+// 'e' + 大端序的序号 为一条日志，'l' 为主节点日志的纪元，'r' 为从节点已应用的位置。
+// 这些记录只对本节点有意义，备份和快照都不包含它们
+const replicationNamespace = "replication"
+
+// logTrimPerWrite 是每次写入时最多删除的旧日志条数
+const logTrimPerWrite = 4
+
+var (
+	// ErrNotLeader 表示数据库没有记录复制日志
+	ErrNotLeader = errors.New("replication log is not enabled on this node")
+	// ErrSnapshotRequired 表示复制日志已经不包含请求的位置（日志被截断、主节点的日志重新开始或数据被恢复），
+	// 从节点需要重新加载快照
+	ErrSnapshotRequired = errors.New("replication position is no longer in the log, a snapshot is required")
+	// ErrReadOnlyReplica 表示数据库是从节点上的只读副本，写入需要发往主节点
+	ErrReadOnlyReplica = errors.New("database is a read-only replica")
+)
+
+// ReplicationPosition 是复制日志中的一个位置，纪元在主节点的日志重新开始时改变，
+// 不同纪元的序号不能比较
+type ReplicationPosition struct {
+	Epoch string `json:"epoch"`
+	Seq   uint64 `json:"seq"`
+}
+
+// LogOp 是复制日志中的一个写操作，字段与一次写入的参数对应
+type LogOp struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value,omitempty"`
+	Delete    bool   `json:"delete,omitempty"`
+	ExpireAt  int64  `json:"expireAt,omitempty"`
+	KeepTTL   bool   `json:"keepTTL,omitempty"`
+	Expired   bool   `json:"expired,omitempty"`
+	Persist   bool   `json:"persist,omitempty"`
+	Raw       bool   `json:"raw,omitempty"` // 数据结构等内部命名空间中的记录
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// LogEntry 是复制日志中的一条记录，对应主节点上一次原子提交的写入
+type LogEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Ops  []LogOp   `json:"ops"`
+}
+
+// LogStatus 描述主节点上一个数据库的复制日志
+type LogStatus struct {
+	Epoch    string    `json:"epoch"`
+	FirstSeq uint64    `json:"firstSeq"` // 最早保留的日志序号，没有日志时为LastSeq+1
+	LastSeq  uint64    `json:"lastSeq"`
+	LastTime time.Time `json:"lastTime"` // 最后一条日志的写入时间，没有日志时为零值
+}
+
+// LogBatch 是ReadLog返回的一段连续的日志
+type LogBatch struct {
+	LogStatus
+	Entries []LogEntry `json:"entries"`
+}
+
+// replicationLog 是主节点上复制日志的内存状态，由DB.mu保护
+type replicationLog struct {
+	epoch    string
+	size     int
+	first    uint64
+	last     uint64
+	lastTime time.Time
+	notify   chan struct{} // 追加日志或关闭时关闭并替换
+	closed   bool
+}
+
+func logEntryKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(internalKey(replicationNamespace, []byte{'e'}), seq)
+}
+
+func logStateKey() []byte {
+	return internalKey(replicationNamespace, []byte{'l'})
+}
+
+func replicaPositionKey() []byte {
+	return internalKey(replicationNamespace, []byte{'r'})
+}
+
+// loadReplication 按复制角色加载复制日志或已应用的位置，并清除不再适用的复制记录
+func (d *DB) loadReplication(cfg config.ReplicationConfig) error {
+	switch cfg.Role {
+	case config.ReplicationRoleLeader:
+		return d.loadReplicationLog(cfg.LogSize)
+	case config.ReplicationRoleFollower:
+		if err := d.clearReplication(true); err != nil {
+			return err
+		}
+		d.replica = &ReplicationPosition{}
+		data, err := d.store.Get(replicaPositionKey())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, d.replica)
+	default:
+		return d.clearReplication(false)
+	}
+}
+
+// loadReplicationLog 加载主节点的复制日志。没有日志状态时（首次作为主节点打开、
+// 曾经关闭过复制或数据来自备份）以新的纪元重新开始，已有的从节点会重新加载快照
+func (d *DB) loadReplicationLog(size int) error {
+	l := &replicationLog{size: size, first: 1, notify: make(chan struct{})}
+	data, err := d.store.Get(logStateKey())
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		if err := d.clearReplication(false); err != nil {
+			return err
+		}
+		l.epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+		if err := d.store.Put(logStateKey(), []byte(l.epoch)); err != nil {
+			return err
+		}
+		d.replLog = l
+		return nil
+	case err != nil:
+		return err
+	}
+	l.epoch = string(data)
+
+	prefix := internalKey(replicationNamespace, []byte{'e'})
+	err = d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, func(k []byte, _ []byte) bool {
+		l.first = binary.BigEndian.Uint64(k[len(prefix):])
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	var decodeErr error
+	err = d.store.Scan(ScanOptions{Prefix: prefix, Reverse: true}, func(_ []byte, value []byte) bool {
+		var entry LogEntry
+		if decodeErr = json.Unmarshal(value, &entry); decodeErr == nil {
+			l.last, l.lastTime = entry.Seq, entry.Time
+		}
+		return false
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return err
+	}
+	if l.last == 0 {
+		l.first = 1
+	}
+	if err := d.trimReplicationLog(l); err != nil {
+		return err
+	}
+	d.replLog = l
+	return nil
+}
+
+// trimReplicationLog 分批删除超出保留条数的旧日志。logSize调小后重新打开时可能有大量多余的日志，
+// 不能留给写入时在同一个批量写入中删除
+func (d *DB) trimReplicationLog(l *replicationLog) error {
+	for l.last >= l.first && l.last-l.first >= uint64(l.size) {
+		end := min(l.first+indexBatchSize, l.last-uint64(l.size)+1)
+		batch := d.store.NewWriteBatch()
+		for seq := l.first; seq < end; seq++ {
+			if err := batch.Delete(logEntryKey(seq)); err != nil {
+				return err
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+		l.first = end
+	}
+	return nil
+}
+
+// clearReplication 删除复制日志和日志状态，keepPosition为false时同时删除从节点已应用的位置
+func (d *DB) clearReplication(keepPosition bool) error {
+	prefix := internalKey(replicationNamespace, nil)
+	position := replicaPositionKey()
+	var keys [][]byte
+	err := d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, func(k []byte, _ []byte) bool {
+		if !keepPosition || string(k) != string(position) {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), indexBatchSize)
+		batch := d.store.NewWriteBatch()
+		for _, k := range keys[:n] {
+			if err := batch.Delete(k); err != nil {
+				return err
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// stageRaw 把内部命名空间中的记录直接加入批量写入
+func stageRaw(batch WriteBatch, op writeOp) error {
+	if op.delete {
+		return batch.Delete(op.key)
+	}
+	return batch.Put(op.key, op.value)
+}
+
+// stageLog 在主节点上把一组写操作作为一条复制日志加入同一个批量写入，并删除超出保留条数的旧日志，
+// 返回新日志的序号和删除后最早保留的序号，不记录日志时序号为0
+func (d *DB) stageLog(batch WriteBatch, ops []writeOp, now time.Time) (seq, first uint64, err error) {
+	l := d.replLog
+	if l == nil {
+		return 0, 0, nil
+	}
+	entry := LogEntry{Seq: l.last + 1, Time: now, Ops: make([]LogOp, len(ops))}
+	for i, op := range ops {
+		entry.Ops[i] = LogOp{
+			Key:       op.key,
+			Value:     op.value,
+			Delete:    op.delete,
+			ExpireAt:  op.expireAt,
+			KeepTTL:   op.keepTTL,
+			Expired:   op.expired,
+			Persist:   op.persist,
+			Raw:       op.raw,
+			RequestID: op.requestID,
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := batch.Put(logEntryKey(entry.Seq), data); err != nil {
+		return 0, 0, err
+	}
+	// 打开时已经把日志截断到保留条数以内，每次写入通常只需删除一条；
+	// 这里限制删除的条数，保证写入的批量不会因为清理旧日志而变大
+	first = l.first
+	for n := 0; n < logTrimPerWrite && first+uint64(l.size) <= entry.Seq; n++ {
+		if err := batch.Delete(logEntryKey(first)); err != nil {
+			return 0, 0, err
+		}
+		first++
+	}
+	return entry.Seq, first, nil
+}
+
+// appended 在日志提交成功后更新内存状态并唤醒等待新日志的从节点
+func (l *replicationLog) appended(seq, first uint64, now time.Time) {
+	if l == nil || seq == 0 {
+		return
+	}
+	l.last, l.lastTime, l.first = seq, now, first
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// closeReplicationLog 唤醒所有等待新日志的从节点
+func (d *DB) closeReplicationLog() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if l := d.replLog; l != nil && !l.closed {
+		l.closed = true
+		close(l.notify)
+	}
+}
+
+func (l *replicationLog) status() LogStatus {
+	return LogStatus{Epoch: l.epoch, FirstSeq: l.first, LastSeq: l.last, LastTime: l.lastTime}
+}
+
+// LogStatus 返回主节点上复制日志的状态
+func (d *DB) LogStatus() (LogStatus, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.replLog == nil {
+		return LogStatus{}, ErrNotLeader
+	}
+	return d.replLog.status(), nil
+}
+
+// ReadLog 读取纪元为epoch的日志中序号大于after的最多limit条日志，没有新日志时Entries为空。
+// 请求的位置已经不在日志中时返回ErrSnapshotRequired
+func (d *DB) ReadLog(epoch string, after uint64, limit int) (*LogBatch, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	l := d.replLog
+	if l == nil {
+		return nil, ErrNotLeader
+	}
+	if epoch != l.epoch || after+1 < l.first || after > l.last {
+		return nil, ErrSnapshotRequired
+	}
+
+	batch := &LogBatch{LogStatus: l.status(), Entries: []LogEntry{}}
+	if after == l.last {
+		return batch, nil
+	}
+	var decodeErr error
+	opts := ScanOptions{Prefix: internalKey(replicationNamespace, []byte{'e'}), Start: logEntryKey(after + 1)}
+	err := d.store.Scan(opts, func(_ []byte, value []byte) bool {
+		var entry LogEntry
+		if decodeErr = json.Unmarshal(value, &entry); decodeErr != nil {
+			return false
+		}
+		batch.Entries = append(batch.Entries, entry)
+		return len(batch.Entries) < limit
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// WaitLog 阻塞直到有序号大于after的日志、ctx结束或数据库关闭
+func (d *DB) WaitLog(ctx context.Context, after uint64) error {
+	for {
+		d.mu.RLock()
+		l := d.replLog
+		if l == nil {
+			d.mu.RUnlock()
+			return ErrNotLeader
+		}
+		if l.closed {
+			d.mu.RUnlock()
+			return ErrStoreClosed
+		}
+		if l.last > after {
+			d.mu.RUnlock()
+			return nil
+		}
+		notify := l.notify
+		d.mu.RUnlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Snapshot 把数据库的一致快照以Dump的格式写入w，返回快照对应的日志位置和记录数，
+// 从节点加载快照后从该位置继续拉取日志
+func (d *DB) Snapshot(w io.Writer) (ReplicationPosition, int, error) {
+	d.dumpMu.Lock()
+	defer d.dumpMu.Unlock()
+	d.mu.Lock()
+	if d.replLog == nil {
+		d.mu.Unlock()
+		return ReplicationPosition{}, 0, ErrNotLeader
+	}
+	pos := ReplicationPosition{Epoch: d.replLog.epoch, Seq: d.replLog.last}
+	d.store.beginDump()
+	d.mu.Unlock()
+	n, err := d.store.dump(w)
+	return pos, n, err
+}
+
+// IsReplica 判断数据库是否为从节点上的只读副本
+func (d *DB) IsReplica() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.replica != nil
+}
+
+// ReplicaPosition 返回从节点已经应用到的日志位置，Epoch为空表示还没有加载过快照
+func (d *DB) ReplicaPosition() (ReplicationPosition, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.replica == nil {
+		return ReplicationPosition{}, false
+	}
+	return *d.replica, true
+}
+
+// ApplyLog 在从节点上应用主节点纪元为epoch的一条日志，已应用的位置与写入原子提交，
+// 重复应用已经应用过的日志不会产生任何效果
+func (d *DB) ApplyLog(epoch string, entry LogEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.replica == nil {
+		return ErrReadOnlyReplica
+	}
+	pos := *d.replica
+	if epoch != pos.Epoch {
+		return ErrSnapshotRequired
+	}
+	if entry.Seq <= pos.Seq {
+		return nil
+	}
+	if entry.Seq != pos.Seq+1 {
+		return fmt.Errorf("%w: expected entry %d, got %d", ErrSnapshotRequired, pos.Seq+1, entry.Seq)
+	}
+
+	next := ReplicationPosition{Epoch: epoch, Seq: entry.Seq}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	ops := make([]writeOp, 0, len(entry.Ops)+1)
+	for _, op := range entry.Ops {
+		value := op.Value
+		if value == nil && !op.Delete {
+			value = []byte{}
+		}
+		ops = append(ops, writeOp{
+			key:       op.Key,
+			value:     value,
+			delete:    op.Delete,
+			expireAt:  op.ExpireAt,
+			keepTTL:   op.KeepTTL,
+			expired:   op.Expired,
+			persist:   op.Persist,
+			raw:       op.Raw,
+			requestID: op.RequestID,
+		})
+	}
+	ops = append(ops, writeOp{key: replicaPositionKey(), value: data, raw: true})
+
+	d.replApplyAt = entry.Time
+	if d.replApplyAt.IsZero() {
+		d.replApplyAt = time.Now()
+	}
+	_, err = d.applyLocked(ops)
+	d.replApplyAt = time.Time{}
+	if err != nil {
+		return err
+	}
+	d.replica = &next
+	return nil
+}
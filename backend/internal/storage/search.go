@@ -0,0 +1,637 @@
+package storage
+
+import (
+	"FastDB-Web/internal/fulltext"
+	"FastDB-Web/internal/logger"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// searchNamespace 是存放全文索引的内部命名空间
+const searchNamespace = "search"
+
+// 全文索引命名空间中记录类型的前缀
+const (
+	searchStatePrefix   byte = 's' // s -> 索引状态和文档统计
+	searchPostingPrefix byte = 'p' // p + 词 + 0x00 + 用户键 -> uvarint(键中词频) uvarint(值中词频) uvarint(文档长度)
+)
+
+const (
+	// searchMaxValueBytes 是值参与索引的最大字节数，超出部分不进入索引
+	searchMaxValueBytes = 64 * 1024
+	// searchBatchOps 是重建时每批最多暂存的索引记录数。每个键的记录数取决于其中不同的词数，
+	// 除了按键数（indexBatchSize）分批，还要按记录数分批，一个键的记录总是在同一批中提交
+	searchBatchOps = 5000
+	// searchKeyBoost 是键名中的词相对于值中的词的权重
+	searchKeyBoost = 3
+	// BM25的参数
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// 全文索引的状态
+const (
+	SearchStateBuilding = "building" // 正在后台重建，只有已经处理过的键可以被检索到
+	SearchStateReady    = "ready"
+)
+
+var (
+	// ErrSearchDisabled 表示配置中没有启用全文检索
+	ErrSearchDisabled = errors.New("full-text search is disabled")
+	// ErrSearchRebuilding 表示全文索引正在重建
+	ErrSearchRebuilding = errors.New("full-text index is already being rebuilt")
+	// ErrEmptyQuery 表示查询中没有可以检索的词
+	ErrEmptyQuery = errors.New("query contains no searchable terms")
+)
+
+// searchIndex 是全文索引的内存状态，由DB.mu保护
+type searchIndex struct {
+	state string
+	// cursor 是重建的进度，只有小于cursor的键已经进入索引，写入这些键时才需要维护索引；
+	// 索引完整时为nil
+	cursor  []byte
+	docs    int64 // 至少包含一个词的键数
+	tokens  int64 // 所有键的词数之和，用于计算平均文档长度
+	builtAt time.Time
+	indexed int64 // 本次重建已经处理的键数
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// storedSearch 是全文索引状态的存储格式
+type storedSearch struct {
+	State   string `json:"s"`
+	Docs    int64  `json:"d"`
+	Tokens  int64  `json:"t"`
+	BuiltAt int64  `json:"b,omitempty"`
+}
+
+// searchDelta 是一次批量写入对文档统计的修改
+type searchDelta struct {
+	docs, tokens int64
+}
+
+func searchStateKey() []byte {
+	return internalKey(searchNamespace, []byte{searchStatePrefix})
+}
+
+func searchPostingPrefixOf(term string) []byte {
+	buf := internalKey(searchNamespace, []byte{searchPostingPrefix})
+	buf = append(buf, term...)
+	return append(buf, 0x00)
+}
+
+func (s *searchIndex) encodeState(delta searchDelta) []byte {
+	stored := storedSearch{State: s.state, Docs: s.docs + delta.docs, Tokens: s.tokens + delta.tokens}
+	if !s.builtAt.IsZero() {
+		stored.BuiltAt = s.builtAt.UnixNano()
+	}
+	data, _ := json.Marshal(stored)
+	return data
+}
+
+// covers 判断写入key时是否需要维护索引
+func (s *searchIndex) covers(key []byte) bool {
+	return s.cursor == nil || bytes.Compare(key, s.cursor) < 0
+}
+
+// termFreq 是一个词在键名和值中出现的次数
+type termFreq struct {
+	key, value int
+}
+
+// searchTerms 切分键名和值，返回每个词的词频和文档长度，值不是UTF-8文本时只索引键名
+func searchTerms(key, value []byte) (map[string]termFreq, int) {
+	terms := make(map[string]termFreq)
+	length := 0
+	for _, t := range fulltext.Tokenize(string(key)) {
+		tf := terms[t.Term]
+		tf.key++
+		terms[t.Term] = tf
+		length++
+	}
+	if len(value) > searchMaxValueBytes {
+		value = value[:searchMaxValueBytes]
+		// 去掉被截断的最后一个字符
+		i := len(value) - 1
+		for i > 0 && !utf8.RuneStart(value[i]) {
+			i--
+		}
+		if !utf8.FullRune(value[i:]) {
+			value = value[:i]
+		}
+	}
+	if utf8.Valid(value) {
+		for _, t := range fulltext.Tokenize(string(value)) {
+			tf := terms[t.Term]
+			tf.value++
+			terms[t.Term] = tf
+			length++
+		}
+	}
+	return terms, length
+}
+
+func encodePosting(tf termFreq, length int) []byte {
+	buf := binary.AppendUvarint(nil, uint64(tf.key))
+	buf = binary.AppendUvarint(buf, uint64(tf.value))
+	return binary.AppendUvarint(buf, uint64(length))
+}
+
+func decodePosting(data []byte) (termFreq, int, bool) {
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return termFreq{}, 0, false
+		}
+		fields[i] = v
+		data = data[n:]
+	}
+	return termFreq{key: int(fields[0]), value: int(fields[1])}, int(fields[2]), true
+}
+
+// stagePostings 在批量写入中把键的索引从prev对应的词改为next对应的词，返回文档统计的变化
+func stagePostings(batch WriteBatch, key []byte, prev, next []byte, prevExists, nextExists bool) (searchDelta, error) {
+	var delta searchDelta
+	var prevTerms, nextTerms map[string]termFreq
+	var prevLen, nextLen int
+	if prevExists {
+		prevTerms, prevLen = searchTerms(key, prev)
+	}
+	if nextExists {
+		nextTerms, nextLen = searchTerms(key, next)
+	}
+
+	for term := range prevTerms {
+		if _, ok := nextTerms[term]; !ok {
+			if err := batch.Delete(append(searchPostingPrefixOf(term), key...)); err != nil {
+				return delta, err
+			}
+		}
+	}
+	for term, tf := range nextTerms {
+		if old, ok := prevTerms[term]; ok && old == tf && prevLen == nextLen {
+			continue
+		}
+		if err := batch.Put(append(searchPostingPrefixOf(term), key...), encodePosting(tf, nextLen)); err != nil {
+			return delta, err
+		}
+	}
+
+	if len(prevTerms) > 0 {
+		delta.docs--
+	}
+	if len(nextTerms) > 0 {
+		delta.docs++
+	}
+	delta.tokens = int64(nextLen - prevLen)
+	return delta, nil
+}
+
+// stageSearch 把写操作对全文索引的修改加入批量写入，文档统计的变化累加到delta，
+// 调用方必须持有写锁
+func (d *DB) stageSearch(batch WriteBatch, op writeOp, prev func() ([]byte, error), delta *searchDelta) error {
+	if d.search == nil || isInternalKey(op.key) || !d.search.covers(op.key) {
+		return nil
+	}
+	prevValue, err := prev()
+	if err != nil {
+		return err
+	}
+	next := op.nextValue()
+	if prevValue != nil && next != nil && bytes.Equal(prevValue, next) {
+		return nil
+	}
+	change, err := stagePostings(batch, op.key, prevValue, next, prevValue != nil, next != nil)
+	if err != nil {
+		return err
+	}
+	delta.docs += change.docs
+	delta.tokens += change.tokens
+	return nil
+}
+
+// stageSearchStats 在批量写入中更新持久化的文档统计
+func (d *DB) stageSearchStats(batch WriteBatch, delta searchDelta) error {
+	if d.search == nil || delta == (searchDelta{}) {
+		return nil
+	}
+	return batch.Put(searchStateKey(), d.search.encodeState(delta))
+}
+
+// applySearchDelta 在批量写入提交后更新内存中的文档统计
+func (d *DB) applySearchDelta(delta searchDelta) {
+	if d.search == nil {
+		return
+	}
+	d.search.docs += delta.docs
+	d.search.tokens += delta.tokens
+}
+
+// loadSearch 加载全文索引的状态，索引不存在或上次重建没有完成时在后台重建。
+// 未启用全文检索时删除状态记录，以后重新启用时会因为索引可能已经过时而重建
+func (d *DB) loadSearch(enabled bool) error {
+	data, err := d.store.Get(searchStateKey())
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if !enabled {
+		if err == nil {
+			return d.store.Delete(searchStateKey())
+		}
+		return nil
+	}
+
+	d.search = &searchIndex{}
+	if err == nil {
+		var stored storedSearch
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if stored.State == SearchStateReady {
+			d.search.state = SearchStateReady
+			d.search.docs, d.search.tokens = stored.Docs, stored.Tokens
+			d.search.builtAt = time.Unix(0, stored.BuiltAt)
+			return nil
+		}
+	} else {
+		// 新建的数据库不需要重建，索引立即可用
+		empty, err := d.searchEmpty()
+		if err != nil {
+			return err
+		}
+		if empty {
+			d.search.state, d.search.builtAt = SearchStateReady, time.Now()
+			return d.store.Put(searchStateKey(), d.search.encodeState(searchDelta{}))
+		}
+	}
+	return d.startSearchRebuildLocked()
+}
+
+// searchEmpty 判断存储中既没有用户键也没有遗留的索引记录
+func (d *DB) searchEmpty() (bool, error) {
+	empty := true
+	check := func(key []byte, _ []byte) bool {
+		empty = false
+		return false
+	}
+	if err := d.store.Scan(ScanOptions{Start: userKeyStart, KeysOnly: true}, check); err != nil || !empty {
+		return false, err
+	}
+	prefix := internalKey(searchNamespace, []byte{searchPostingPrefix})
+	err := d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, check)
+	return empty, err
+}
+
+// RebuildSearch 清空全文索引并在后台重新为所有键建立索引
+func (d *DB) RebuildSearch() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.search == nil {
+		return ErrSearchDisabled
+	}
+	// 上次重建因为错误退出时允许重新开始
+	if s := d.search; s.state == SearchStateBuilding && s.done != nil {
+		select {
+		case <-s.done:
+		default:
+			return ErrSearchRebuilding
+		}
+	}
+	return d.startSearchRebuildLocked()
+}
+
+// startSearchRebuildLocked 持久化building状态并启动后台重建，调用方必须持有写锁或独占DB
+func (d *DB) startSearchRebuildLocked() error {
+	s := d.search
+	prev := *s
+	s.state = SearchStateBuilding
+	s.cursor = userKeyStart
+	s.docs, s.tokens, s.indexed = 0, 0, 0
+	if err := d.store.Put(searchStateKey(), s.encodeState(searchDelta{})); err != nil {
+		*s = prev
+		return err
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go d.rebuildSearch(s, s.stop)
+	logger.Info("开始重建全文索引")
+	return nil
+}
+
+// rebuildSearch 先分批删除旧的索引记录，再分批遍历所有键建立索引，批次之间释放写锁
+func (d *DB) rebuildSearch(s *searchIndex, stop <-chan struct{}) {
+	defer close(s.done)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n, err := d.clearSearchBatch()
+		if err != nil {
+			logger.Error("清空全文索引失败", zap.Error(err))
+			return
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		done, err := d.buildSearchBatch(s)
+		if err != nil {
+			logger.Error("重建全文索引失败", zap.Error(err))
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// clearSearchBatch 在写锁内删除一批索引记录，返回删除的数量
+func (d *DB) clearSearchBatch() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	batch := d.store.NewWriteBatch()
+	count := 0
+	var stageErr error
+	prefix := internalKey(searchNamespace, []byte{searchPostingPrefix})
+	err := d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, func(key []byte, _ []byte) bool {
+		stageErr = batch.Delete(key)
+		count++
+		return stageErr == nil && count < indexBatchSize
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil || count == 0 {
+		return 0, err
+	}
+	return count, batch.Commit()
+}
+
+// buildSearchBatch 在写锁内为从cursor开始的一批键建立索引，全部完成时返回true
+func (d *DB) buildSearchBatch(s *searchIndex) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	batch := &countingBatch{WriteBatch: d.store.NewWriteBatch()}
+	var delta searchDelta
+	var next []byte
+	count := 0
+	var stageErr error
+	err := d.store.Scan(ScanOptions{Start: s.cursor}, func(key []byte, value []byte) bool {
+		if count == indexBatchSize || batch.ops >= searchBatchOps {
+			next = append([]byte(nil), key...)
+			return false
+		}
+		count++
+		var change searchDelta
+		change, stageErr = stagePostings(batch, key, nil, value, false, true)
+		delta.docs += change.docs
+		delta.tokens += change.tokens
+		return stageErr == nil
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cursor, state, builtAt := s.cursor, s.state, s.builtAt
+	s.cursor = next
+	if next == nil {
+		s.state, s.builtAt = SearchStateReady, time.Now()
+	}
+	if err = batch.Put(searchStateKey(), s.encodeState(delta)); err == nil {
+		err = batch.Commit()
+	}
+	if err != nil {
+		s.cursor, s.state, s.builtAt = cursor, state, builtAt
+		return false, err
+	}
+	s.docs += delta.docs
+	s.tokens += delta.tokens
+	s.indexed += int64(count)
+	if next == nil {
+		logger.Info("全文索引重建完成", zap.Int64("docs", s.docs), zap.Int64("tokens", s.tokens))
+	}
+	return next == nil, nil
+}
+
+// countingBatch 记录暂存的操作数，后台任务据此限制每批的大小
+type countingBatch struct {
+	WriteBatch
+	ops int
+}
+
+// Put 在批量写入中添加一个写操作
+func (b *countingBatch) Put(key, value []byte) error {
+	b.ops++
+	return b.WriteBatch.Put(key, value)
+}
+
+// Delete 在批量写入中添加一个删除操作
+func (b *countingBatch) Delete(key []byte) error {
+	b.ops++
+	return b.WriteBatch.Delete(key)
+}
+
+// stopSearchRebuild 停止后台重建并等待其退出，未完成的重建在下次打开时从头开始
+func (d *DB) stopSearchRebuild() {
+	d.mu.Lock()
+	var done chan struct{}
+	if s := d.search; s != nil && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+		done = s.done
+	}
+	d.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// SearchQuery 描述一次全文检索，多个词之间是“与”的关系
+type SearchQuery struct {
+	Query  string
+	Offset int
+	Limit  int
+}
+
+// SearchHit 是一个命中的键
+type SearchHit struct {
+	Key   []byte
+	Value []byte
+	Score float64
+}
+
+// SearchResult 是全文检索的结果，Hits按相关度从高到低排序
+type SearchResult struct {
+	Terms []string
+	Total int
+	Hits  []SearchHit
+	// Building 表示索引正在重建，结果可能不完整
+	Building bool
+}
+
+// Search 检索键名或值中包含查询中所有词的键，按BM25相关度排序，键名中的词权重更高
+func (d *DB) Search(q SearchQuery) (*SearchResult, error) {
+	terms := fulltext.QueryTerms(q.Query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s := d.search
+	if s == nil {
+		return nil, ErrSearchDisabled
+	}
+
+	now := time.Now().UnixNano()
+	docs := float64(max(s.docs, 1))
+	avgLen := float64(s.tokens) / docs
+	if avgLen == 0 {
+		avgLen = 1
+	}
+	var scores map[string]float64
+	for _, term := range terms {
+		prefix := searchPostingPrefixOf(term)
+		termScores := make(map[string]float64)
+		var postings []struct {
+			key    string
+			tf     float64
+			length int
+		}
+		err := d.store.Scan(ScanOptions{Prefix: prefix}, func(key []byte, value []byte) bool {
+			userKey := key[len(prefix):]
+			// 只需要在其他词中也出现过的键
+			if scores != nil {
+				if _, ok := scores[string(userKey)]; !ok {
+					return true
+				}
+			}
+			if d.expiredLocked(userKey, now) {
+				return true
+			}
+			tf, length, ok := decodePosting(value)
+			if !ok {
+				return true
+			}
+			postings = append(postings, struct {
+				key    string
+				tf     float64
+				length int
+			}{string(userKey), float64(searchKeyBoost*tf.key + tf.value), length})
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			norm := p.tf + bm25K1*(1-bm25B+bm25B*float64(p.length)/avgLen)
+			termScores[p.key] = scores[p.key] + idf*p.tf*(bm25K1+1)/norm
+		}
+		scores = termScores
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, SearchHit{Key: []byte(key), Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return bytes.Compare(hits[i].Key, hits[j].Key) < 0
+	})
+
+	result := &SearchResult{Terms: terms, Total: len(hits), Building: s.state == SearchStateBuilding}
+	start := min(q.Offset, len(hits))
+	end := len(hits)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(hits))
+	}
+	result.Hits = hits[start:end]
+	// 排序分页之后再读取值，避免读取不会返回的键
+	for i := range result.Hits {
+		value, err := d.store.Get(result.Hits[i].Key)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+		result.Hits[i].Value = value
+	}
+	return result, nil
+}
+
+// SearchStats 是全文索引的统计信息
+type SearchStats struct {
+	Enabled  bool       `json:"enabled"`
+	State    string     `json:"state,omitempty"`
+	Docs     int64      `json:"docs"`
+	Tokens   int64      `json:"tokens"`
+	Terms    int64      `json:"terms"`
+	Postings int64      `json:"postings"`
+	Indexed  int64      `json:"indexed"` // 本次启动以来重建处理的键数
+	BuiltAt  *time.Time `json:"builtAt,omitempty"`
+}
+
+// SearchStats 返回全文索引的统计信息，词数和倒排记录数需要遍历索引
+func (d *DB) SearchStats() (SearchStats, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s := d.search
+	if s == nil {
+		return SearchStats{}, nil
+	}
+	stats := SearchStats{
+		Enabled: true,
+		State:   s.state,
+		Docs:    s.docs,
+		Tokens:  s.tokens,
+		Indexed: s.indexed,
+	}
+	if !s.builtAt.IsZero() {
+		builtAt := s.builtAt
+		stats.BuiltAt = &builtAt
+	}
+
+	prefix := internalKey(searchNamespace, []byte{searchPostingPrefix})
+	var lastTerm []byte
+	err := d.store.Scan(ScanOptions{Prefix: prefix, KeysOnly: true}, func(key []byte, _ []byte) bool {
+		stats.Postings++
+		rest := key[len(prefix):]
+		term := rest[:bytes.IndexByte(rest, 0x00)+1]
+		if !bytes.Equal(term, lastTerm) {
+			stats.Terms++
+			lastTerm = append(lastTerm[:0], term...)
+		}
+		return true
+	})
+	return stats, err
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"FastDB-Web/internal/config"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	fastDBModulePath = "github.com/qishenonly/FastDB"
+	boltModulePath   = "go.etcd.io/bbolt"
+)
+
+// fastDBIndexEntrySize 估算FastDB各类内存索引中每个键占用的字节数（不含键本身），
+// B+树索引存放在磁盘上，不占用内存
+var fastDBIndexEntrySize = map[string]int64{
+	config.IndexTypeBTree:  64,
+	config.IndexTypeART:    96,
+	config.IndexTypeBPTree: 0,
+}
+
+// StoreStats 描述存储引擎的统计信息，键的数量包括内部记录
+type StoreStats struct {
+	Engine          string `json:"engine"`
+	Version         string `json:"version,omitempty"`
+	KeyCount        int64  `json:"keyCount"`
+	DiskSize        int64  `json:"diskSize"`        // 数据目录的磁盘占用（字节）
+	ReclaimableSize int64  `json:"reclaimableSize"` // 合并后可以回收的字节数
+	SegmentFiles    int    `json:"segmentFiles"`    // 数据文件的数量
+	IndexMemory     int64  `json:"indexMemory"`     // 内存索引占用的估算值（字节）
+
+	Cache *CacheStats `json:"cache,omitempty"` // 值缓存的统计信息，未启用缓存时为空
+}
+
+// DBStats 描述数据库的统计信息
+type DBStats struct {
+	Keys         int64       `json:"keys"`         // 未过期的用户键数量
+	ExpiringKeys int         `json:"expiringKeys"` // 设置了过期时间且尚未过期的键数量
+	Store        *StoreStats `json:"store"`
+}
+
+// Stats 返回底层存储引擎的统计信息
+func (d *DB) Stats() (*StoreStats, error) {
+	return d.store.Stats()
+}
+
+// DatabaseStats 返回数据库的统计信息。用户键的数量需要遍历一次键（不读取值），
+// 遍历期间不阻塞写入，因此在并发写入时只是一个近似值
+func (d *DB) DatabaseStats() (*DBStats, error) {
+	store, err := d.store.Stats()
+	if err != nil {
+		return nil, err
+	}
+	stats := &DBStats{Store: store}
+
+	// 先记下已过期但还未清理的键，遍历时跳过它们
+	now := time.Now().UnixNano()
+	expired := make(map[string]bool)
+	d.mu.RLock()
+	for key, expireAt := range d.expires {
+		if expireAt <= now {
+			expired[key] = true
+		} else {
+			stats.ExpiringKeys++
+		}
+	}
+	d.mu.RUnlock()
+
+	err = d.store.Scan(ScanOptions{Start: userKeyStart, KeysOnly: true}, func(key []byte, _ []byte) bool {
+		if !expired[string(key)] {
+			stats.Keys++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// moduleVersion 返回编译进程序的依赖模块的版本，无法获取时返回空字符串
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return ""
+}
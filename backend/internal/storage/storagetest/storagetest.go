@@ -0,0 +1,329 @@
+// Package storagetest 提供所有 storage.KVStore 实现都必须通过的一致性测试
+package storagetest
+
+import (
+	"FastDB-Web/internal/storage"
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Factory 创建一个空的、可独立使用的KVStore，测试结束后由测试套件负责关闭
+type Factory func(t *testing.T) storage.KVStore
+
+// Run 对newStore创建的KVStore运行完整的一致性测试
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.KVStore)
+	}{
+		{"GetPutDelete", testGetPutDelete},
+		{"NotFound", testNotFound},
+		{"EmptyKey", testEmptyKey},
+		{"FoldEarlyStop", testFoldEarlyStop},
+		{"GetListKeysOrdering", testGetListKeysOrdering},
+		{"Scan", testScan},
+		{"WriteBatch", testWriteBatch},
+		{"ConcurrentAccess", testConcurrentAccess},
+		{"Stats", testStats},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() { s.Close() })
+			tt.fn(t, s)
+		})
+	}
+
+	t.Run("AfterClose", func(t *testing.T) {
+		testAfterClose(t, newStore(t))
+	})
+}
+
+func mustPut(t *testing.T, s storage.KVStore, key, value string) {
+	t.Helper()
+	if err := s.Put([]byte(key), []byte(value)); err != nil {
+		t.Fatalf("Put(%q) failed: %v", key, err)
+	}
+}
+
+func expectValue(t *testing.T, s storage.KVStore, key, want string) {
+	t.Helper()
+	got, err := s.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", key, err)
+	}
+	if string(got) != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func expectNotFound(t *testing.T, s storage.KVStore, key string) {
+	t.Helper()
+	if _, err := s.Get([]byte(key)); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Get(%q) error = %v, want ErrKeyNotFound", key, err)
+	}
+}
+
+func testGetPutDelete(t *testing.T, s storage.KVStore) {
+	mustPut(t, s, "a", "1")
+	expectValue(t, s, "a", "1")
+
+	// 覆盖写入
+	mustPut(t, s, "a", "2")
+	expectValue(t, s, "a", "2")
+
+	// 修改返回的切片不能影响存储中的数据
+	got, _ := s.Get([]byte("a"))
+	got[0] = 'x'
+	expectValue(t, s, "a", "2")
+
+	if err := s.Delete([]byte("a")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	expectNotFound(t, s, "a")
+
+	// 空值与不存在的键是不同的
+	mustPut(t, s, "empty", "")
+	expectValue(t, s, "empty", "")
+
+	// 删除不存在的键不是错误
+	if err := s.Delete([]byte("missing")); err != nil {
+		t.Fatalf("Delete(missing) failed: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, s storage.KVStore) {
+	expectNotFound(t, s, "missing")
+	mustPut(t, s, "present", "v")
+	expectNotFound(t, s, "presen")
+	expectNotFound(t, s, "present2")
+}
+
+func testEmptyKey(t *testing.T, s storage.KVStore) {
+	if err := s.Put(nil, []byte("v")); err == nil {
+		t.Fatal("Put with empty key should fail")
+	}
+	if _, err := s.Get(nil); err == nil {
+		t.Fatal("Get with empty key should fail")
+	}
+}
+
+func testFoldEarlyStop(t *testing.T, s storage.KVStore) {
+	for i := 0; i < 10; i++ {
+		mustPut(t, s, fmt.Sprintf("k%02d", i), "v")
+	}
+
+	visited := 0
+	if err := s.Fold(func(key, value []byte) bool {
+		visited++
+		return visited < 3
+	}); err != nil {
+		t.Fatalf("Fold failed: %v", err)
+	}
+	if visited != 3 {
+		t.Fatalf("Fold visited %d keys after early stop, want 3", visited)
+	}
+
+	visited = 0
+	if err := s.Fold(func(key, value []byte) bool {
+		visited++
+		if string(value) != "v" {
+			t.Errorf("Fold value for %q = %q, want %q", key, value, "v")
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("Fold failed: %v", err)
+	}
+	if visited != 10 {
+		t.Fatalf("Fold visited %d keys, want 10", visited)
+	}
+}
+
+func testGetListKeysOrdering(t *testing.T, s storage.KVStore) {
+	for _, k := range []string{"b", "a", "c", "ab", "B"} {
+		mustPut(t, s, k, "v")
+	}
+	want := []string{"B", "a", "ab", "b", "c"}
+
+	keys := s.GetListKeys()
+	if len(keys) != len(want) {
+		t.Fatalf("GetListKeys returned %d keys, want %d", len(keys), len(want))
+	}
+	for i, k := range keys {
+		if string(k) != want[i] {
+			t.Fatalf("GetListKeys()[%d] = %q, want %q", i, k, want[i])
+		}
+	}
+}
+
+func collect(t *testing.T, s storage.KVStore, opts storage.ScanOptions, limit int) []string {
+	t.Helper()
+	var keys []string
+	if err := s.Scan(opts, func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return limit <= 0 || len(keys) < limit
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	return keys
+}
+
+func expectKeys(t *testing.T, name string, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %q, want %q", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func testScan(t *testing.T, s storage.KVStore) {
+	for _, k := range []string{"a", "user:1", "user:2", "user:3", "video:1", "z"} {
+		mustPut(t, s, k, "v-"+k)
+	}
+
+	expectKeys(t, "all", collect(t, s, storage.ScanOptions{}, 0),
+		"a", "user:1", "user:2", "user:3", "video:1", "z")
+	expectKeys(t, "prefix", collect(t, s, storage.ScanOptions{Prefix: []byte("user:")}, 0),
+		"user:1", "user:2", "user:3")
+	expectKeys(t, "prefix reverse", collect(t, s, storage.ScanOptions{Prefix: []byte("user:"), Reverse: true}, 0),
+		"user:3", "user:2", "user:1")
+	expectKeys(t, "range", collect(t, s, storage.ScanOptions{Start: []byte("user:2"), End: []byte("video:1")}, 0),
+		"user:2", "user:3")
+	expectKeys(t, "range reverse", collect(t, s, storage.ScanOptions{Start: []byte("user:2"), End: []byte("video:1"), Reverse: true}, 0),
+		"user:3", "user:2")
+	expectKeys(t, "prefix and range", collect(t, s, storage.ScanOptions{Prefix: []byte("user:"), Start: []byte("user:2")}, 0),
+		"user:2", "user:3")
+	expectKeys(t, "early stop", collect(t, s, storage.ScanOptions{}, 2),
+		"a", "user:1")
+	expectKeys(t, "no match", collect(t, s, storage.ScanOptions{Prefix: []byte("nothing")}, 0))
+
+	if err := s.Scan(storage.ScanOptions{Prefix: []byte("video:")}, func(key, value []byte) bool {
+		if !bytes.Equal(value, []byte("v-video:1")) {
+			t.Errorf("Scan value for %q = %q", key, value)
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+}
+
+func testWriteBatch(t *testing.T, s storage.KVStore) {
+	mustPut(t, s, "old", "v")
+
+	batch := s.NewWriteBatch()
+	if err := batch.Put([]byte("x"), []byte("1")); err != nil {
+		t.Fatalf("batch Put failed: %v", err)
+	}
+	if err := batch.Put([]byte("y"), []byte("2")); err != nil {
+		t.Fatalf("batch Put failed: %v", err)
+	}
+	if err := batch.Delete([]byte("old")); err != nil {
+		t.Fatalf("batch Delete failed: %v", err)
+	}
+
+	// 提交前不可见
+	expectNotFound(t, s, "x")
+	expectValue(t, s, "old", "v")
+
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("batch Commit failed: %v", err)
+	}
+	expectValue(t, s, "x", "1")
+	expectValue(t, s, "y", "2")
+	expectNotFound(t, s, "old")
+}
+
+func testConcurrentAccess(t *testing.T, s storage.KVStore) {
+	const workers, perWorker = 8, 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := []byte(fmt.Sprintf("w%d-%03d", w, i))
+				if err := s.Put(key, key); err != nil {
+					t.Errorf("Put(%q) failed: %v", key, err)
+					return
+				}
+				if got, err := s.Get(key); err != nil || !bytes.Equal(got, key) {
+					t.Errorf("Get(%q) = %q, %v", key, got, err)
+					return
+				}
+			}
+		}(w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				s.GetListKeys()
+				s.Scan(storage.ScanOptions{}, func(key, value []byte) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(s.GetListKeys()); n != workers*perWorker {
+		t.Fatalf("GetListKeys returned %d keys, want %d", n, workers*perWorker)
+	}
+}
+
+func testStats(t *testing.T, s storage.KVStore) {
+	for i := 0; i < 5; i++ {
+		mustPut(t, s, fmt.Sprintf("k%d", i), "value")
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Engine == "" {
+		t.Error("Stats did not report the engine")
+	}
+	// 包装其他存储的实现可能会额外写入内部记录
+	if stats.KeyCount < 5 {
+		t.Errorf("Stats KeyCount = %d, want at least 5", stats.KeyCount)
+	}
+	if stats.DiskSize < 0 || stats.ReclaimableSize < 0 || stats.IndexMemory < 0 {
+		t.Errorf("Stats reported negative sizes: %+v", stats)
+	}
+}
+
+func testAfterClose(t *testing.T, s storage.KVStore) {
+	mustPut(t, s, "a", "1")
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := s.Get([]byte("a")); err == nil {
+		t.Error("Get after Close should fail")
+	}
+	if err := s.Put([]byte("a"), []byte("2")); err == nil {
+		t.Error("Put after Close should fail")
+	}
+	if err := s.Delete([]byte("a")); err == nil {
+		t.Error("Delete after Close should fail")
+	}
+	if err := s.Fold(func(key, value []byte) bool { return true }); err == nil {
+		t.Error("Fold after Close should fail")
+	}
+	if err := s.Scan(storage.ScanOptions{}, func(key, value []byte) bool { return true }); err == nil {
+		t.Error("Scan after Close should fail")
+	}
+	if keys := s.GetListKeys(); len(keys) != 0 {
+		t.Errorf("GetListKeys after Close returned %d keys", len(keys))
+	}
+	if _, err := s.Stats(); err == nil {
+		t.Error("Stats after Close should fail")
+	}
+	if err := s.Close(); err == nil {
+		t.Error("second Close should fail")
+	}
+}
@@ -0,0 +1,1236 @@
+package storage_test
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"FastDB-Web/internal/storage/storagetest"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fastdb-web-logs")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(dir, "error", false)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testConfig 返回指向临时目录的合法存储配置
+func testConfig(t *testing.T, storeType string) config.StorageConfig {
+	return config.StorageConfig{
+		Type:            storeType,
+		Path:            t.TempDir(),
+		DefaultDatabase: "default",
+		MaxBatchOps:     1000,
+		BackupDir:       t.TempDir(),
+		ReapInterval:    1,
+		ReapBatchSize:   100,
+		SegmentSize:     64 * 1024 * 1024,
+		IndexType:       config.IndexTypeBTree,
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.KVStore {
+		return storage.NewMemoryStore()
+	})
+}
+
+func TestFastDBStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.KVStore {
+		s, err := storage.NewFastDBStore(testConfig(t, "fastdb"))
+		if err != nil {
+			t.Fatalf("NewFastDBStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.KVStore {
+		s, err := storage.NewBoltStore(testConfig(t, "bbolt"))
+		if err != nil {
+			t.Fatalf("NewBoltStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestCachedStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.KVStore {
+		s, err := storage.NewFastDBStore(testConfig(t, "fastdb"))
+		if err != nil {
+			t.Fatalf("NewFastDBStore failed: %v", err)
+		}
+		// 缓存比测试数据小，覆盖淘汰路径
+		return storage.NewCachedStore(s, 8, 4096)
+	})
+}
+
+func TestCachedStoreLRU(t *testing.T) {
+	s := storage.NewCachedStore(storage.NewMemoryStore(), 2, 0)
+	defer s.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		s.Put([]byte(key), []byte(key))
+	}
+
+	get := func(key, want string) {
+		t.Helper()
+		value, err := s.Get([]byte(key))
+		if err != nil || string(value) != want {
+			t.Fatalf("Get(%q) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+	get("a", "a") // 未命中
+	get("b", "b") // 未命中
+	get("a", "a") // 命中
+	get("c", "c") // 未命中，淘汰最久未使用的b
+	get("a", "a") // 命中
+	if stats := s.CacheStats(); stats.Hits != 2 || stats.Misses != 3 || stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("CacheStats = %+v, want 2 hits, 3 misses, 2 entries, 1 eviction", stats)
+	}
+
+	// 写入、删除和批量写入都要使缓存失效
+	s.Put([]byte("a"), []byte("a2"))
+	get("a", "a2")
+	s.Delete([]byte("c"))
+	if _, err := s.Get([]byte("c")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Get deleted key error = %v, want ErrKeyNotFound", err)
+	}
+	batch := s.NewWriteBatch()
+	batch.Put([]byte("a"), []byte("a3"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	get("a", "a3")
+
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Cache == nil || stats.Cache.HitRate <= 0 {
+		t.Fatalf("Stats did not report cache statistics: %+v", stats.Cache)
+	}
+}
+
+func TestCachedStoreMaxBytes(t *testing.T) {
+	s := storage.NewCachedStore(storage.NewMemoryStore(), 100, 1024)
+	defer s.Close()
+	big := make([]byte, 400)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Put([]byte(key), big)
+		s.Get([]byte(key))
+	}
+	if stats := s.CacheStats(); stats.Entries != 2 || stats.Bytes > 1024 {
+		t.Fatalf("CacheStats = %+v, want 2 entries within 1024 bytes", stats)
+	}
+
+	// 超过上限的单个值不放入缓存
+	s.Put([]byte("huge"), make([]byte, 2048))
+	s.Get([]byte("huge"))
+	if stats := s.CacheStats(); stats.Entries != 2 {
+		t.Fatalf("oversized value was cached: %+v", stats)
+	}
+}
+
+func TestCachedStoreMerge(t *testing.T) {
+	cfg := testConfig(t, "fastdb")
+	cfg.CacheSize = 16
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	if !db.MergeStatus().Supported {
+		t.Fatal("merge should be supported through the cache")
+	}
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	cfg := testConfig(t, "bbolt")
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	db.Put([]byte("a"), []byte("1"))
+	db.PutWithTTL([]byte("b"), []byte("2"), time.Now().Add(time.Hour))
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err = storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	if _, meta, err := db.GetWithMeta([]byte("a")); err != nil || meta == nil || meta.Version != 1 {
+		t.Fatalf("GetWithMeta after reopen = %+v, %v", meta, err)
+	}
+	if _, ok, err := db.TTL([]byte("b")); err != nil || !ok {
+		t.Fatalf("TTL after reopen = %v, %v, want a deadline", ok, err)
+	}
+	if keys := db.GetListKeys(); len(keys) != 2 {
+		t.Fatalf("GetListKeys after reopen returned %d keys, want 2", len(keys))
+	}
+}
+
+func TestDB(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.KVStore {
+		db, err := storage.Open(testConfig(t, "memory"))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		return db
+	})
+}
+
+func TestDBHidesExpiredKeys(t *testing.T) {
+	db, err := storage.Open(testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("session"), []byte("v0"))
+	if err := db.PutWithTTL([]byte("session"), []byte("v"), time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if _, ok, err := db.TTL([]byte("session")); err != nil || !ok {
+		t.Fatalf("TTL = %v, %v, want a deadline", ok, err)
+	}
+	if keys := db.GetListKeys(); len(keys) != 1 {
+		t.Fatalf("GetListKeys returned %d keys, want 1 (internal keys must stay hidden)", len(keys))
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if _, err := db.Get([]byte("session")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Get after expiry error = %v, want ErrKeyNotFound", err)
+	}
+	if keys := db.GetListKeys(); len(keys) != 0 {
+		t.Fatalf("GetListKeys after expiry returned %d keys, want 0", len(keys))
+	}
+
+	// 过期后尚未清理的键重新写入时视为新键
+	if err := db.Put([]byte("session"), []byte("v2")); err != nil {
+		t.Fatalf("Put after expiry failed: %v", err)
+	}
+	if _, meta, err := db.GetWithMeta([]byte("session")); err != nil || meta.Version != 1 || time.Since(meta.CreatedAt) > 50*time.Millisecond {
+		t.Fatalf("GetWithMeta after rewrite = %+v, %v, want a fresh key", meta, err)
+	}
+}
+
+func TestDBCounters(t *testing.T) {
+	db, err := storage.Open(testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	// 并发自增不能丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, _, err := db.IncrBy([]byte("hits"), 1); err != nil {
+					t.Errorf("IncrBy failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _, err := db.IncrBy([]byte("hits"), -10); err != nil || n != 990 {
+		t.Fatalf("IncrBy = %d, %v, want 990", n, err)
+	}
+
+	if f, _, err := db.IncrByFloat([]byte("hits"), 0.5); err != nil || f != 990.5 {
+		t.Fatalf("IncrByFloat = %v, %v, want 990.5", f, err)
+	}
+	if _, _, err := db.IncrBy([]byte("hits"), 1); !errors.Is(err, storage.ErrNotNumber) {
+		t.Fatalf("IncrBy on float error = %v, want ErrNotNumber", err)
+	}
+
+	db.Put([]byte("max"), []byte("9223372036854775807"))
+	if _, _, err := db.IncrBy([]byte("max"), 1); !errors.Is(err, storage.ErrNumberOverflow) {
+		t.Fatalf("IncrBy overflow error = %v, want ErrNumberOverflow", err)
+	}
+
+	// 自增保留键原有的过期时间
+	expireAt := time.Now().Add(time.Hour)
+	db.PutWithTTL([]byte("ttl"), []byte("1"), expireAt)
+	db.IncrBy([]byte("ttl"), 1)
+	if got, ok, err := db.TTL([]byte("ttl")); err != nil || !ok || !got.Equal(time.Unix(0, expireAt.UnixNano())) {
+		t.Fatalf("TTL after IncrBy = %v, %v, %v, want %v", got, ok, err, expireAt)
+	}
+}
+
+func TestDBMetadata(t *testing.T) {
+	db, err := storage.Open(testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("k"), []byte("one"))
+	db.Put([]byte("k"), []byte("three"))
+
+	value, meta, err := db.GetWithMeta([]byte("k"))
+	if err != nil {
+		t.Fatalf("GetWithMeta failed: %v", err)
+	}
+	if string(value) != "three" || meta.Version != 2 || meta.Size != 5 {
+		t.Fatalf("GetWithMeta = %q, %+v, want version 2 and size 5", value, meta)
+	}
+
+	if _, _, err := db.CompareAndSwap([]byte("k"), []byte("one"), []byte("x"), ""); !errors.Is(err, storage.ErrConditionNotMet) {
+		t.Fatalf("CompareAndSwap with stale value error = %v, want ErrConditionNotMet", err)
+	}
+	if _, _, err := db.CompareAndSwap([]byte("k"), []byte("three"), []byte("x"), ""); err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+
+	// 比较并交换不应清除键的过期时间
+	expireAt := time.Now().Add(time.Hour)
+	if err := db.PutWithTTL([]byte("t"), []byte("one"), expireAt); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if _, _, err := db.CompareAndSwap([]byte("t"), []byte("one"), []byte("two"), ""); err != nil {
+		t.Fatalf("CompareAndSwap failed: %v", err)
+	}
+	if got, ok, err := db.TTL([]byte("t")); err != nil || !ok || got.UnixNano() != expireAt.UnixNano() {
+		t.Fatalf("TTL after CompareAndSwap = %v, %v, %v, want %v", got, ok, err, expireAt)
+	}
+}
+
+func TestDBLargeWriteBatch(t *testing.T) {
+	// 每个操作还会写入元数据、历史版本和全文索引等附属记录，总数远超FastDB默认的批量写入上限
+	cfg := testConfig(t, config.StorageTypeFastDB)
+	cfg.MaxBatchOps = 5000
+	cfg.HistoryVersions = 2
+	cfg.FullTextSearch = true
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	batch := db.NewWriteBatch()
+	for i := 0; i < cfg.MaxBatchOps; i++ {
+		if err := batch.Put([]byte(fmt.Sprintf("k%05d", i)), []byte(fmt.Sprintf("value number %d", i))); err != nil {
+			t.Fatalf("Put %d failed: %v", i, err)
+		}
+	}
+	if err := batch.Put([]byte("extra"), []byte("v")); !errors.Is(err, storage.ErrBatchTooLarge) {
+		t.Errorf("Put beyond maxBatchOps = %v, want ErrBatchTooLarge", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if v, err := db.Get([]byte("k04999")); err != nil || string(v) != "value number 4999" {
+		t.Errorf("Get(k04999) = %q, %v", v, err)
+	}
+
+	cfg.MaxBatchOps = config.MaxBatchOpsLimit + 1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted maxBatchOps above the limit")
+	}
+}
+
+func TestRegistryCreate(t *testing.T) {
+	dbs, err := storage.NewRegistry(testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer dbs.Close()
+
+	// 并发创建同名数据库时只有一个成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created, exists := 0, 0
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := dbs.Create("orders")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, storage.ErrDatabaseExists):
+				exists++
+			default:
+				t.Errorf("Create failed: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if created != 1 || exists != 7 {
+		t.Fatalf("Create succeeded %d times and reported exists %d times, want 1 and 7", created, exists)
+	}
+}
+
+func TestRegistryBackupRestore(t *testing.T) {
+	for _, storeType := range []string{"memory", "bbolt", "fastdb"} {
+		t.Run(storeType, func(t *testing.T) {
+			cfg := testConfig(t, storeType)
+			dbs, err := storage.NewRegistry(cfg)
+			if err != nil {
+				t.Fatalf("NewRegistry failed: %v", err)
+			}
+			defer dbs.Close()
+
+			db := dbs.Default()
+			db.Put([]byte("a"), []byte("1"))
+			db.PutWithTTL([]byte("b"), []byte("2"), time.Now().Add(time.Hour))
+
+			backup, err := dbs.Backup("default")
+			if err != nil {
+				t.Fatalf("Backup failed: %v", err)
+			}
+
+			db.Put([]byte("a"), []byte("changed"))
+			db.Put([]byte("c"), []byte("3"))
+
+			if _, err := dbs.Restore("", backup.File); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+			db = dbs.Default()
+			value, meta, err := db.GetWithMeta([]byte("a"))
+			if err != nil || string(value) != "1" || meta.Version != 1 {
+				t.Fatalf("GetWithMeta(a) after restore = %q, %+v, %v", value, meta, err)
+			}
+			if _, ok, err := db.TTL([]byte("b")); err != nil || !ok {
+				t.Fatalf("TTL(b) after restore = %v, %v, want a deadline", ok, err)
+			}
+			if _, err := db.Get([]byte("c")); !errors.Is(err, storage.ErrKeyNotFound) {
+				t.Fatalf("Get(c) after restore error = %v, want ErrKeyNotFound", err)
+			}
+
+			// 损坏的归档在替换数据之前就会被拒绝
+			path := filepath.Join(cfg.BackupDir, "broken.tar.gz")
+			os.WriteFile(path, []byte("not a backup"), 0644)
+			if _, err := dbs.Restore("", "broken.tar.gz"); !errors.Is(err, storage.ErrInvalidBackup) {
+				t.Fatalf("Restore(broken) error = %v, want ErrInvalidBackup", err)
+			}
+			if _, err := dbs.Restore("", "../escape.tar.gz"); !errors.Is(err, storage.ErrInvalidBackup) {
+				t.Fatalf("Restore(../escape) error = %v, want ErrInvalidBackup", err)
+			}
+			if _, err := dbs.Default().Get([]byte("a")); err != nil {
+				t.Fatalf("Get(a) after rejected restore failed: %v", err)
+			}
+		})
+	}
+}
+
+// blockingMerger 是一个合并会阻塞到release关闭的存储，用于测试合并状态
+type blockingMerger struct {
+	*storage.MemoryStore
+	release chan struct{}
+}
+
+func (m *blockingMerger) Merge() error {
+	<-m.release
+	return nil
+}
+
+func (m *blockingMerger) DiskUsage() (int64, int64, error) {
+	return 100, 40, nil
+}
+
+func TestDBMerge(t *testing.T) {
+	db, err := storage.Open(testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := db.StartMerge(storage.MergeTriggerManual); !errors.Is(err, storage.ErrMergeUnsupported) {
+		t.Fatalf("StartMerge on memory store error = %v, want ErrMergeUnsupported", err)
+	}
+	db.Close()
+
+	store := &blockingMerger{MemoryStore: storage.NewMemoryStore(), release: make(chan struct{})}
+	db, err = storage.NewDB(store, testConfig(t, "memory"))
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	defer db.Close()
+
+	run, err := db.StartMerge(storage.MergeTriggerManual)
+	if err != nil {
+		t.Fatalf("StartMerge failed: %v", err)
+	}
+	if run.ReclaimableBefore != 40 {
+		t.Fatalf("ReclaimableBefore = %d, want 40", run.ReclaimableBefore)
+	}
+	if _, err := db.StartMerge(storage.MergeTriggerManual); !errors.Is(err, storage.ErrMergeInProgress) {
+		t.Fatalf("concurrent StartMerge error = %v, want ErrMergeInProgress", err)
+	}
+	if status := db.MergeStatus(); !status.Running || status.Current == nil {
+		t.Fatalf("MergeStatus while merging = %+v", status)
+	}
+
+	close(store.release)
+	deadline := time.Now().Add(time.Second)
+	for db.MergeStatus().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("merge did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if last := db.MergeStatus().Last; last == nil || last.FinishedAt == nil || last.Error != "" {
+		t.Fatalf("last merge = %+v", last)
+	}
+}
+
+// waitIndexReady 等待索引构建完成
+func waitIndexReady(t *testing.T, db *storage.DB, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := db.Index(name)
+		if err != nil {
+			t.Fatalf("Index(%s) failed: %v", name, err)
+		}
+		if info.State == storage.IndexStateReady {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index %s did not become ready: %+v", name, info)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queryKeys 按索引查询并返回命中的键
+func queryKeys(t *testing.T, db *storage.DB, name string, q storage.IndexQuery) []string {
+	t.Helper()
+	matches, _, err := db.QueryIndex(name, q)
+	if err != nil {
+		t.Fatalf("QueryIndex(%s) failed: %v", name, err)
+	}
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = string(m.Key)
+	}
+	return keys
+}
+
+func TestDBIndexes(t *testing.T) {
+	cfg := testConfig(t, "bbolt")
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// 建索引之前写入的数据由后台构建补上
+	for i := 0; i < 1200; i++ {
+		status := "inactive"
+		if i%3 == 0 {
+			status = "active"
+		}
+		db.Put([]byte(fmt.Sprintf("user:%04d", i)), []byte(fmt.Sprintf(`{"status":%q,"age":%d}`, status, i%100)))
+	}
+	db.Put([]byte("user:text"), []byte("not json"))
+	db.Put([]byte("order:1"), []byte(`{"status":"active"}`))
+
+	if _, err := db.CreateIndex(storage.IndexDef{Name: "bad name", Prefix: "user:", Path: "/status"}); !errors.Is(err, storage.ErrInvalidIndex) {
+		t.Fatalf("CreateIndex(bad name) error = %v, want ErrInvalidIndex", err)
+	}
+	if _, err := db.CreateIndex(storage.IndexDef{Name: "status", Prefix: "user:", Path: "status"}); !errors.Is(err, storage.ErrInvalidIndex) {
+		t.Fatalf("CreateIndex(bad path) error = %v, want ErrInvalidIndex", err)
+	}
+	if _, err := db.CreateIndex(storage.IndexDef{Name: "status", Prefix: "user:", Path: "/status"}); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if _, err := db.CreateIndex(storage.IndexDef{Name: "age", Prefix: "user:", Path: "/age", Type: storage.IndexTypeNumber}); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if _, err := db.CreateIndex(storage.IndexDef{Name: "status", Prefix: "user:", Path: "/status"}); !errors.Is(err, storage.ErrIndexExists) {
+		t.Fatalf("CreateIndex(duplicate) error = %v, want ErrIndexExists", err)
+	}
+	waitIndexReady(t, db, "status")
+	waitIndexReady(t, db, "age")
+
+	active := "active"
+	if keys := queryKeys(t, db, "status", storage.IndexQuery{Eq: &active}); len(keys) != 400 || keys[0] != "user:0000" {
+		t.Fatalf("status = active returned %d keys starting with %v", len(keys), keys[:min(len(keys), 1)])
+	}
+
+	// 分页按值、键的顺序继续
+	var paged []string
+	q := storage.IndexQuery{Eq: &active, Limit: 150}
+	for {
+		matches, cursor, err := db.QueryIndex("status", q)
+		if err != nil {
+			t.Fatalf("QueryIndex failed: %v", err)
+		}
+		for _, m := range matches {
+			paged = append(paged, string(m.Key))
+		}
+		if cursor == nil {
+			break
+		}
+		q.After = cursor
+	}
+	if len(paged) != 400 || paged[399] != "user:1197" {
+		t.Fatalf("paged query returned %d keys, last %q", len(paged), paged[len(paged)-1])
+	}
+
+	low, high := "10", "11.5"
+	if keys := queryKeys(t, db, "age", storage.IndexQuery{Gte: &low, Lte: &high, Limit: 3, Reverse: true}); len(keys) != 3 || keys[0] != "user:1111" {
+		t.Fatalf("10 <= age <= 11.5 reverse = %v", keys)
+	}
+	bad := "ten"
+	if _, _, err := db.QueryIndex("age", storage.IndexQuery{Eq: &bad}); !errors.Is(err, storage.ErrInvalidIndexValue) {
+		t.Fatalf("QueryIndex(age = ten) error = %v, want ErrInvalidIndexValue", err)
+	}
+
+	// 写入、删除、过期和批量写入都维护索引
+	db.Put([]byte("user:0000"), []byte(`{"status":"inactive"}`))
+	db.Delete([]byte("user:0003"))
+	db.PutWithTTL([]byte("user:0006"), []byte(`{"status":"active"}`), time.Now().Add(20*time.Millisecond))
+	batch := db.NewWriteBatch()
+	batch.Put([]byte("user:new"), []byte(`{"status":"inactive"}`))
+	batch.Put([]byte("user:new"), []byte(`{"status":"active"}`))
+	batch.Commit()
+	time.Sleep(30 * time.Millisecond)
+	keys := queryKeys(t, db, "status", storage.IndexQuery{Eq: &active})
+	if len(keys) != 398 || keys[0] != "user:0009" || keys[len(keys)-1] != "user:new" {
+		t.Fatalf("status = active after writes returned %d keys: first %q last %q", len(keys), keys[0], keys[len(keys)-1])
+	}
+
+	if err := db.DropIndex("age"); err != nil {
+		t.Fatalf("DropIndex failed: %v", err)
+	}
+	if _, _, err := db.QueryIndex("age", storage.IndexQuery{}); !errors.Is(err, storage.ErrIndexNotFound) {
+		t.Fatalf("QueryIndex after drop error = %v, want ErrIndexNotFound", err)
+	}
+	db.Close()
+
+	// 索引定义和记录在重新打开后保留
+	db, err = storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	if infos := db.Indexes(); len(infos) != 1 || infos[0].Name != "status" || infos[0].State != storage.IndexStateReady {
+		t.Fatalf("Indexes after reopen = %+v", infos)
+	}
+	if keys := queryKeys(t, db, "status", storage.IndexQuery{Eq: &active}); len(keys) != 398 {
+		t.Fatalf("status = active after reopen returned %d keys, want 398", len(keys))
+	}
+}
+
+// waitSearchReady 等待全文索引重建完成
+func waitSearchReady(t *testing.T, db *storage.DB) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := db.SearchStats()
+		if err != nil {
+			t.Fatalf("SearchStats failed: %v", err)
+		}
+		if stats.State == storage.SearchStateReady {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("full-text index did not become ready: %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// searchKeys 执行全文检索并返回命中的键
+func searchKeys(t *testing.T, db *storage.DB, query string) []string {
+	t.Helper()
+	result, err := db.Search(storage.SearchQuery{Query: query})
+	if err != nil {
+		t.Fatalf("Search(%q) failed: %v", query, err)
+	}
+	keys := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		keys[i] = string(hit.Key)
+	}
+	return keys
+}
+
+func TestDBSearch(t *testing.T) {
+	cfg := testConfig(t, "bbolt")
+	cfg.FullTextSearch = true
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	waitSearchReady(t, db)
+
+	db.Put([]byte("doc:1"), []byte("FastDB is a fast key value store"))
+	db.Put([]byte("doc:2"), []byte("全文检索支持中文分词"))
+	db.Put([]byte("note:fast"), []byte("something else"))
+	db.Put([]byte("blob"), []byte{0xff, 0xfe, 'f', 'a', 's', 't'})
+
+	// 键名中的词权重更高
+	if keys := searchKeys(t, db, "FAST"); len(keys) != 2 || keys[0] != "note:fast" || keys[1] != "doc:1" {
+		t.Fatalf("Search(FAST) = %v, want [note:fast doc:1]", keys)
+	}
+	if keys := searchKeys(t, db, "fast store"); len(keys) != 1 || keys[0] != "doc:1" {
+		t.Fatalf("Search(fast store) = %v, want [doc:1]", keys)
+	}
+	for _, q := range []string{"中文", "文检", "分"} {
+		if keys := searchKeys(t, db, q); len(keys) != 1 || keys[0] != "doc:2" {
+			t.Fatalf("Search(%s) = %v, want [doc:2]", q, keys)
+		}
+	}
+	if keys := searchKeys(t, db, "检中"); len(keys) != 0 {
+		t.Fatalf("Search(检中) = %v, want none", keys)
+	}
+	if _, err := db.Search(storage.SearchQuery{Query: " ,. "}); !errors.Is(err, storage.ErrEmptyQuery) {
+		t.Fatalf("Search(punctuation) error = %v, want ErrEmptyQuery", err)
+	}
+
+	result, err := db.Search(storage.SearchQuery{Query: "fast", Offset: 1, Limit: 1})
+	if err != nil || result.Total != 2 || len(result.Hits) != 1 || string(result.Hits[0].Value) != "FastDB is a fast key value store" {
+		t.Fatalf("Search(fast, offset 1) = %+v, %v", result, err)
+	}
+
+	// 覆盖、删除和过期都会更新索引
+	db.Put([]byte("doc:1"), []byte("a slow store"))
+	db.Delete([]byte("note:fast"))
+	db.PutWithTTL([]byte("doc:3"), []byte("temporary store"), time.Now().Add(20*time.Millisecond))
+	if keys := searchKeys(t, db, "store"); len(keys) != 2 {
+		t.Fatalf("Search(store) = %v, want 2 keys", keys)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if keys := searchKeys(t, db, "fast"); len(keys) != 0 {
+		t.Fatalf("Search(fast) after writes = %v, want none", keys)
+	}
+	if keys := searchKeys(t, db, "store"); len(keys) != 1 || keys[0] != "doc:1" {
+		t.Fatalf("Search(store) after expiry = %v, want [doc:1]", keys)
+	}
+
+	if err := db.RebuildSearch(); err != nil {
+		t.Fatalf("RebuildSearch failed: %v", err)
+	}
+	waitSearchReady(t, db)
+	stats, err := db.SearchStats()
+	// 尚未被清理的过期键也在索引中，检索时跳过
+	if err != nil || stats.Docs < 3 || stats.Terms == 0 || stats.Postings < stats.Terms {
+		t.Fatalf("SearchStats after rebuild = %+v, %v", stats, err)
+	}
+	if keys := searchKeys(t, db, "slow"); len(keys) != 1 || keys[0] != "doc:1" {
+		t.Fatalf("Search(slow) after rebuild = %v, want [doc:1]", keys)
+	}
+	db.Close()
+
+	// 关闭全文检索后不可用，重新开启时重建
+	cfg.FullTextSearch = false
+	db, err = storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if _, err := db.Search(storage.SearchQuery{Query: "slow"}); !errors.Is(err, storage.ErrSearchDisabled) {
+		t.Fatalf("Search with search disabled error = %v, want ErrSearchDisabled", err)
+	}
+	db.Put([]byte("doc:4"), []byte("written while disabled"))
+	db.Close()
+
+	cfg.FullTextSearch = true
+	db, err = storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	waitSearchReady(t, db)
+	if keys := searchKeys(t, db, "disabled"); len(keys) != 1 || keys[0] != "doc:4" {
+		t.Fatalf("Search(disabled) after re-enabling = %v, want [doc:4]", keys)
+	}
+}
+
+// nextEvent 读取订阅的下一个事件，超时视为失败
+func nextEvent(t *testing.T, w *storage.Watcher) storage.ChangeEvent {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	e, err := w.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	return e
+}
+
+func TestDBSearchLargeRebuild(t *testing.T) {
+	cfg := testConfig(t, config.StorageTypeFastDB)
+	cfg.FullTextSearch = true
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	waitSearchReady(t, db)
+
+	// 一个值中有上万个不同的中文单字和双字词，索引记录数超过FastDB默认的批量写入上限
+	var cjk []rune
+	for r := rune(0x4e00); len(cjk) < 6000; r++ {
+		cjk = append(cjk, r)
+	}
+	if err := db.Put([]byte("cjk"), []byte(string(cjk))); err != nil {
+		t.Fatalf("Put large CJK value failed: %v", err)
+	}
+
+	// 每个文档有几十个不同的词，重建时一批的索引记录数远超按键数估计的大小
+	for i := 0; i < 600; i++ {
+		words := make([]string, 30)
+		for j := range words {
+			words[j] = fmt.Sprintf("w%dx%d", j, i%50)
+		}
+		if err := db.Put([]byte(fmt.Sprintf("doc:%03d", i)), []byte(fmt.Sprint(words))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.RebuildSearch(); err != nil {
+		t.Fatalf("RebuildSearch failed: %v", err)
+	}
+	waitSearchReady(t, db)
+
+	stats, err := db.SearchStats()
+	if err != nil || stats.Docs != 601 || stats.Postings <= 20000 {
+		t.Fatalf("SearchStats after rebuild = %+v, %v", stats, err)
+	}
+	if keys := searchKeys(t, db, "w29x7"); len(keys) != 12 {
+		t.Errorf("Search(w29x7) returned %d keys, want 12", len(keys))
+	}
+	if keys := searchKeys(t, db, string(cjk[5998:])); len(keys) != 1 || keys[0] != "cjk" {
+		t.Errorf("Search(CJK bigram) = %v, want [cjk]", keys)
+	}
+}
+
+func TestDBWatch(t *testing.T) {
+	cfg := testConfig(t, "memory")
+	cfg.WatchBufferSize = 4
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	w, err := db.Watch([]byte("user:"), "")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	db.Put([]byte("user:1"), []byte("a"))
+	db.Put([]byte("order:1"), []byte("b"))
+	db.Put([]byte("user:1"), []byte("c"))
+	db.Delete([]byte("user:1"))
+
+	var events []storage.ChangeEvent
+	for i := 0; i < 3; i++ {
+		events = append(events, nextEvent(t, w))
+	}
+	want := []struct {
+		op      string
+		version uint64
+	}{{storage.ChangeOpPut, 1}, {storage.ChangeOpPut, 2}, {storage.ChangeOpDelete, 0}}
+	for i, e := range events {
+		if string(e.Key) != "user:1" || e.Op != want[i].op || e.Version != want[i].version {
+			t.Fatalf("event %d = %+v, want %s version %d", i, e, want[i].op, want[i].version)
+		}
+	}
+	if events[1].Seq != 3 || w.Token() != events[2].Token {
+		t.Fatalf("seq = %d, token = %q, want 3 and %q", events[1].Seq, w.Token(), events[2].Token)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next without events error = %v, want DeadlineExceeded", err)
+	}
+
+	// 从恢复令牌之后继续，不限制前缀
+	resumed, err := db.Watch(nil, events[0].Token)
+	if err != nil {
+		t.Fatalf("Watch(after) failed: %v", err)
+	}
+	if e := nextEvent(t, resumed); string(e.Key) != "order:1" {
+		t.Fatalf("resumed event = %+v, want order:1", e)
+	}
+
+	for _, token := range []string{"bad", events[0].Token + "0"} {
+		if _, err := db.Watch(nil, token); !errors.Is(err, storage.ErrInvalidResumeToken) {
+			t.Fatalf("Watch(%q) error = %v, want ErrInvalidResumeToken", token, err)
+		}
+	}
+	if _, err := db.Watch(nil, "other-1"); !errors.Is(err, storage.ErrResumeTokenExpired) {
+		t.Fatalf("Watch(other epoch) error = %v, want ErrResumeTokenExpired", err)
+	}
+
+	// 缓冲区只保留最近4个事件，再写入5个后落后的订阅和令牌都失效
+	batch := db.NewWriteBatch()
+	for i := 0; i < 5; i++ {
+		batch.Put([]byte(fmt.Sprintf("user:%d", i)), []byte("x"))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if _, err := w.Next(context.Background()); !errors.Is(err, storage.ErrResumeTokenExpired) {
+		t.Fatalf("Next after overflow error = %v, want ErrResumeTokenExpired", err)
+	}
+	if _, err := db.Watch(nil, events[0].Token); !errors.Is(err, storage.ErrResumeTokenExpired) {
+		t.Fatalf("Watch(old token) error = %v, want ErrResumeTokenExpired", err)
+	}
+
+	latest, err := db.Watch(nil, "")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := latest.Next(context.Background())
+		done <- err
+	}()
+	db.Close()
+	if err := <-done; !errors.Is(err, storage.ErrFeedClosed) {
+		t.Fatalf("Next after Close error = %v, want ErrFeedClosed", err)
+	}
+}
+
+// historyVersions 返回键的历史版本号，从新到旧
+func historyVersions(t *testing.T, db *storage.DB, key string) []uint64 {
+	t.Helper()
+	history, err := db.History([]byte(key))
+	if err != nil {
+		t.Fatalf("History(%s) failed: %v", key, err)
+	}
+	versions := make([]uint64, len(history))
+	for i, v := range history {
+		versions[i] = v.Version
+	}
+	return versions
+}
+
+func TestDBHistory(t *testing.T) {
+	cfg := testConfig(t, "memory")
+	cfg.HistoryVersions = 3
+	cfg.HistoryRules = []config.HistoryRule{
+		{Prefix: "tmp:", Versions: 0},
+		{Prefix: "audit:", Versions: 10, MaxAge: 1},
+	}
+	db, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		db.Put([]byte("k"), []byte(fmt.Sprintf("v%d", i)))
+	}
+	if got := historyVersions(t, db, "k"); fmt.Sprint(got) != "[5 4 3]" {
+		t.Fatalf("history = %v, want [5 4 3]", got)
+	}
+	if v, err := db.GetVersion([]byte("k"), 4); err != nil || string(v.Value) != "v4" {
+		t.Fatalf("GetVersion(4) = %+v, %v", v, err)
+	}
+	if _, err := db.GetVersion([]byte("k"), 1); !errors.Is(err, storage.ErrVersionNotFound) {
+		t.Fatalf("GetVersion(pruned) error = %v, want ErrVersionNotFound", err)
+	}
+
+	meta, value, err := db.Rollback([]byte("k"), 3, "req-1")
+	if err != nil || meta.Version != 6 || string(value) != "v3" {
+		t.Fatalf("Rollback = %+v, %q, %v", meta, value, err)
+	}
+	history, _ := db.History([]byte("k"))
+	if history[0].Version != 6 || history[0].RequestID != "req-1" {
+		t.Fatalf("latest version = %+v", history[0])
+	}
+
+	// 删除保留历史，重新写入时版本号继续递增，也可以回滚被删除的键
+	db.Delete([]byte("k"))
+	if got := historyVersions(t, db, "k"); fmt.Sprint(got) != "[6 5 4]" {
+		t.Fatalf("history after delete = %v, want [6 5 4]", got)
+	}
+	if meta, _, err := db.Rollback([]byte("k"), 5, ""); err != nil || meta.Version != 7 {
+		t.Fatalf("Rollback deleted key = %+v, %v", meta, err)
+	}
+	if v, err := db.Get([]byte("k")); err != nil || string(v) != "v5" {
+		t.Fatalf("Get after rollback = %q, %v", v, err)
+	}
+
+	batch := db.NewWriteBatchWithRequestID("req-2")
+	batch.Put([]byte("k"), []byte("v8"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if history, _ := db.History([]byte("k")); history[0].Version != 8 || history[0].RequestID != "req-2" {
+		t.Fatalf("latest version after batch = %+v", history[0])
+	}
+
+	db.Put([]byte("tmp:1"), []byte("x"))
+	if _, err := db.History([]byte("tmp:1")); !errors.Is(err, storage.ErrHistoryDisabled) {
+		t.Fatalf("History(tmp:1) error = %v, want ErrHistoryDisabled", err)
+	}
+
+	// 超过保留时间的版本在下次写入时清理
+	db.Put([]byte("audit:1"), []byte("a"))
+	time.Sleep(1100 * time.Millisecond)
+	db.Put([]byte("audit:1"), []byte("b"))
+	if got := historyVersions(t, db, "audit:1"); fmt.Sprint(got) != "[2]" {
+		t.Fatalf("audit history = %v, want [2]", got)
+	}
+}
+
+// applyLeaderLog 把主节点上从节点位置之后的日志全部应用到从节点
+func applyLeaderLog(t *testing.T, leader, follower *storage.DB) {
+	t.Helper()
+	pos, _ := follower.ReplicaPosition()
+	batch, err := leader.ReadLog(pos.Epoch, pos.Seq, 100)
+	if err != nil {
+		t.Fatalf("ReadLog(%+v) failed: %v", pos, err)
+	}
+	for _, entry := range batch.Entries {
+		if err := follower.ApplyLog(batch.Epoch, entry); err != nil {
+			t.Fatalf("ApplyLog(%d) failed: %v", entry.Seq, err)
+		}
+	}
+}
+
+func TestDBReplication(t *testing.T) {
+	leaderCfg := testConfig(t, "bbolt")
+	leaderCfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleLeader, LogSize: 4}
+	leaders, err := storage.NewRegistry(leaderCfg)
+	if err != nil {
+		t.Fatalf("NewRegistry(leader) failed: %v", err)
+	}
+	defer func() { leaders.Close() }()
+	followerCfg := testConfig(t, "memory")
+	followerCfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleFollower, LeaderURL: "http://leader", PollTimeout: 1}
+	followers, err := storage.NewRegistry(followerCfg)
+	if err != nil {
+		t.Fatalf("NewRegistry(follower) failed: %v", err)
+	}
+	defer followers.Close()
+
+	leader := leaders.Default()
+	leader.Put([]byte("a"), []byte("1"))
+	leader.Put([]byte("b"), []byte("2"))
+
+	// 从节点先加载快照，再从快照的位置继续应用日志
+	var snapshot bytes.Buffer
+	pos, _, err := leader.Snapshot(&snapshot)
+	if err != nil || pos.Seq != 2 {
+		t.Fatalf("Snapshot = %+v, %v, want seq 2", pos, err)
+	}
+	if _, err := followers.LoadSnapshot("default", &snapshot, pos); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	follower := followers.Default()
+
+	leader.PutWithTTL([]byte("a"), []byte("3"), time.Now().Add(time.Hour))
+	leader.Persist([]byte("a"))
+	leader.Delete([]byte("b"))
+	leader.Namespace("hash").Put([]byte("h"), []byte("raw"))
+	applyLeaderLog(t, leader, follower)
+
+	_, leaderMeta, _ := leader.GetWithMeta([]byte("a"))
+	value, meta, err := follower.GetWithMeta([]byte("a"))
+	if err != nil || string(value) != "3" || meta.Version != 2 || !meta.UpdatedAt.Equal(leaderMeta.UpdatedAt) {
+		t.Fatalf("follower GetWithMeta(a) = %q, %+v, %v, leader meta %+v", value, meta, err, leaderMeta)
+	}
+	if _, ok, _ := follower.TTL([]byte("a")); ok {
+		t.Fatal("follower TTL(a) should be cleared by Persist")
+	}
+	if _, err := follower.Get([]byte("b")); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("follower Get(b) error = %v, want ErrKeyNotFound", err)
+	}
+	if value, err := follower.Namespace("hash").Get([]byte("h")); err != nil || string(value) != "raw" {
+		t.Fatalf("follower namespace Get = %q, %v", value, err)
+	}
+	if err := follower.Put([]byte("x"), []byte("1")); !errors.Is(err, storage.ErrReadOnlyReplica) {
+		t.Fatalf("follower Put error = %v, want ErrReadOnlyReplica", err)
+	}
+	if _, err := follower.ReadLog(pos.Epoch, 0, 10); !errors.Is(err, storage.ErrNotLeader) {
+		t.Fatalf("follower ReadLog error = %v, want ErrNotLeader", err)
+	}
+
+	// 日志在重新打开后继续编号，超出保留条数的旧日志被删除
+	leaders.Close()
+	if leaders, err = storage.NewRegistry(leaderCfg); err != nil {
+		t.Fatalf("NewRegistry(leader) reopen failed: %v", err)
+	}
+	leader = leaders.Default()
+	status, err := leader.LogStatus()
+	if err != nil || status.Epoch != pos.Epoch || status.FirstSeq != 3 || status.LastSeq != 6 {
+		t.Fatalf("LogStatus after reopen = %+v, %v", status, err)
+	}
+	leader.Put([]byte("c"), []byte("4"))
+	applyLeaderLog(t, leader, follower)
+	if value, err := follower.Get([]byte("c")); err != nil || string(value) != "4" {
+		t.Fatalf("follower Get(c) = %q, %v", value, err)
+	}
+	for i := 0; i < 5; i++ {
+		leader.Put([]byte("d"), []byte("5"))
+	}
+	applied, _ := follower.ReplicaPosition()
+	if _, err := leader.ReadLog(applied.Epoch, applied.Seq, 10); !errors.Is(err, storage.ErrSnapshotRequired) {
+		t.Fatalf("ReadLog(truncated) error = %v, want ErrSnapshotRequired", err)
+	}
+}
+
+func TestDBReplicationLogRequestID(t *testing.T) {
+	cfg := testConfig(t, "memory")
+	cfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleLeader, LogSize: 10}
+	dbs, err := storage.NewRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	defer dbs.Close()
+	db := dbs.Default()
+	db.Put([]byte("a"), []byte("1"))
+
+	// 批量写入中的删除也要在日志中记录请求ID
+	batch := db.NewWriteBatchWithRequestID("req-1")
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Delete([]byte("a"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	status, _ := db.LogStatus()
+	log, err := db.ReadLog(status.Epoch, status.LastSeq-1, 10)
+	if err != nil || len(log.Entries) != 1 || len(log.Entries[0].Ops) != 2 {
+		t.Fatalf("ReadLog = %+v, %v", log, err)
+	}
+	for _, op := range log.Entries[0].Ops {
+		if op.RequestID != "req-1" {
+			t.Fatalf("log op %q request ID = %q, want req-1", op.Key, op.RequestID)
+		}
+	}
+}
+
+func TestDBReplicationLogShrink(t *testing.T) {
+	cfg := testConfig(t, "bbolt")
+	cfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleLeader, LogSize: 2000}
+	dbs, err := storage.NewRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	const n = 1200
+	for i := 0; i < n; i++ {
+		if err := dbs.Default().Put([]byte(fmt.Sprintf("k%d", i%10)), []byte("v")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	dbs.Close()
+
+	// 调小保留条数后重新打开，多余的日志在打开时分批删除，而不是留给下一次写入
+	cfg.Replication.LogSize = 10
+	if dbs, err = storage.NewRegistry(cfg); err != nil {
+		t.Fatalf("NewRegistry reopen failed: %v", err)
+	}
+	defer dbs.Close()
+	db := dbs.Default()
+	status, err := db.LogStatus()
+	if err != nil || status.FirstSeq != n-9 || status.LastSeq != n {
+		t.Fatalf("LogStatus after reopen = %+v, %v", status, err)
+	}
+	if err := db.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put after reopen failed: %v", err)
+	}
+	status, _ = db.LogStatus()
+	if status.FirstSeq != n-8 || status.LastSeq != n+1 {
+		t.Fatalf("LogStatus after write = %+v", status)
+	}
+	batch, err := db.ReadLog(status.Epoch, 0, 100)
+	if err == nil {
+		t.Fatalf("ReadLog(0) returned %d entries, want ErrSnapshotRequired", len(batch.Entries))
+	}
+	if batch, err = db.ReadLog(status.Epoch, n-9, 100); err != nil || len(batch.Entries) != 10 {
+		t.Fatalf("ReadLog(%d) = %v, %v", n-9, batch, err)
+	}
+}
+
+// writeHook 在第一次写入前调用f
+type writeHook struct {
+	w    bytes.Buffer
+	once sync.Once
+	f    func()
+}
+
+func (h *writeHook) Write(p []byte) (int, error) {
+	h.once.Do(h.f)
+	return h.w.Write(p)
+}
+
+func TestDBSnapshotDuringWrites(t *testing.T) {
+	for _, storeType := range []string{"memory", "bbolt"} {
+		t.Run(storeType, func(t *testing.T) {
+			leaderCfg := testConfig(t, storeType)
+			leaderCfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleLeader, LogSize: 10000}
+			leaders, err := storage.NewRegistry(leaderCfg)
+			if err != nil {
+				t.Fatalf("NewRegistry(leader) failed: %v", err)
+			}
+			defer leaders.Close()
+			followerCfg := testConfig(t, "memory")
+			followerCfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleFollower, LeaderURL: "http://leader", PollTimeout: 1}
+			followers, err := storage.NewRegistry(followerCfg)
+			if err != nil {
+				t.Fatalf("NewRegistry(follower) failed: %v", err)
+			}
+			defer followers.Close()
+
+			leader := leaders.Default()
+			const n = 3000
+			for i := 0; i < n; i++ {
+				if err := leader.Put([]byte(fmt.Sprintf("k%04d", i)), []byte("old")); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			// 导出写出记录时不持有锁，期间的写入不会阻塞，也不会出现在快照中
+			hook := &writeHook{f: func() {
+				leader.Put([]byte("k0000"), []byte("new"))
+				leader.Put([]byte(fmt.Sprintf("k%04d", n-1)), []byte("new"))
+				leader.Delete([]byte(fmt.Sprintf("k%04d", n-2)))
+				leader.Put([]byte("k9999"), []byte("new"))
+			}}
+			pos, _, err := leader.Snapshot(hook)
+			if err != nil || pos.Seq != n {
+				t.Fatalf("Snapshot = %+v, %v, want seq %d", pos, err, n)
+			}
+			if _, err := followers.LoadSnapshot("default", &hook.w, pos); err != nil {
+				t.Fatalf("LoadSnapshot failed: %v", err)
+			}
+			follower := followers.Default()
+			for _, key := range []string{"k0000", fmt.Sprintf("k%04d", n-1), fmt.Sprintf("k%04d", n-2)} {
+				if value, meta, err := follower.GetWithMeta([]byte(key)); err != nil || string(value) != "old" || meta.Version != 1 {
+					t.Fatalf("follower GetWithMeta(%s) = %q, %+v, %v, want the value at snapshot time", key, value, meta, err)
+				}
+			}
+			if _, err := follower.Get([]byte("k9999")); !errors.Is(err, storage.ErrKeyNotFound) {
+				t.Fatalf("follower Get(k9999) error = %v, want ErrKeyNotFound", err)
+			}
+
+			// 快照之后的写入通过日志补齐
+			applyLeaderLog(t, leader, follower)
+			if value, _ := follower.Get([]byte(fmt.Sprintf("k%04d", n-1))); string(value) != "new" {
+				t.Fatalf("follower Get after log = %q", value)
+			}
+			if _, err := follower.Get([]byte(fmt.Sprintf("k%04d", n-2))); !errors.Is(err, storage.ErrKeyNotFound) {
+				t.Fatalf("follower Get(deleted) error = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
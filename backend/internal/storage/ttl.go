@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"FastDB-Web/internal/logger"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ttlNamespace 是存放过期时间的内部命名空间
+const ttlNamespace = "ttl"
+
+// ErrInvalidExpireAt 表示过期时间不在未来
+var ErrInvalidExpireAt = errors.New("expire time must be in the future")
+
+// encodeExpireAt 将过期时间编码为8字节大端整数
+func encodeExpireAt(expireAt int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(expireAt))
+	return buf
+}
+
+// loadExpires 从存储中加载过期时间索引
+func (d *DB) loadExpires() error {
+	prefix := internalKey(ttlNamespace, nil)
+	return d.store.Scan(ScanOptions{Prefix: prefix}, func(key []byte, value []byte) bool {
+		if len(value) != 8 {
+			return true
+		}
+		d.expires[string(key[len(prefix):])] = int64(binary.BigEndian.Uint64(value))
+		return true
+	})
+}
+
+// expiredLocked 判断键是否已过期，调用方必须持有锁
+func (d *DB) expiredLocked(key []byte, now int64) bool {
+	expireAt, ok := d.expires[string(key)]
+	return ok && expireAt <= now
+}
+
+// stageExpire 把写操作对过期时间记录的修改加入批量写入，
+// pending记录本批次内已经暂存的过期时间，提交成功后写回内存索引
+func (d *DB) stageExpire(batch WriteBatch, op writeOp, pending map[string]int64) error {
+	key := string(op.key)
+	current, ok := pending[key]
+	if !ok {
+		current = d.expires[key]
+	}
+
+	if op.keepTTL && !op.delete {
+		return nil
+	}
+	if op.delete || op.expireAt == 0 {
+		if current == 0 {
+			return nil
+		}
+		pending[key] = 0
+		return batch.Delete(internalKey(ttlNamespace, op.key))
+	}
+	pending[key] = op.expireAt
+	return batch.Put(internalKey(ttlNamespace, op.key), encodeExpireAt(op.expireAt))
+}
+
+// PutWithTTL 设置键值对，并在expireAt时刻过期
+func (d *DB) PutWithTTL(key, value []byte, expireAt time.Time) error {
+	if err := checkUserKey(key); err != nil {
+		return err
+	}
+	if !expireAt.After(time.Now()) {
+		return ErrInvalidExpireAt
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.applyLocked([]writeOp{{key: key, value: value, expireAt: expireAt.UnixNano()}})
+	return err
+}
+
+// TTL 返回键的过期时间，键未设置过期时间时ok为false
+func (d *DB) TTL(key []byte) (expireAt time.Time, ok bool, err error) {
+	if err := checkUserKey(key); err != nil {
+		return time.Time{}, false, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if err := d.existsLocked(key); err != nil {
+		return time.Time{}, false, err
+	}
+	if ns, ok := d.expires[string(key)]; ok {
+		return time.Unix(0, ns), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// Persist 清除键的过期时间，返回键之前是否设置了过期时间
+func (d *DB) Persist(key []byte) (bool, error) {
+	if err := checkUserKey(key); err != nil {
+		return false, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.existsLocked(key); err != nil {
+		return false, err
+	}
+	if _, ok := d.expires[string(key)]; !ok {
+		return false, nil
+	}
+	if _, err := d.applyLocked([]writeOp{{key: key, persist: true}}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// existsLocked 检查键存在且未过期，调用方必须持有锁
+func (d *DB) existsLocked(key []byte) error {
+	if d.expiredLocked(key, time.Now().UnixNano()) {
+		return ErrKeyNotFound
+	}
+	_, err := d.store.Get(key)
+	return err
+}
+
+// StartReaper 启动后台清理过期键的goroutine
+func (d *DB) StartReaper() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reaperStop != nil {
+		return
+	}
+	d.reaperStop = make(chan struct{})
+	d.reaperDone = make(chan struct{})
+	go d.reapLoop(d.reaperStop, d.reaperDone)
+}
+
+// StopReaper 停止后台清理并等待其退出
+func (d *DB) StopReaper() {
+	d.mu.Lock()
+	stop, done := d.reaperStop, d.reaperDone
+	d.reaperStop, d.reaperDone = nil, nil
+	d.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (d *DB) reapLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(d.reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// 每批最多删除reapBatchSize个键，批满则继续下一批，批次之间释放锁
+		for {
+			n, err := d.reapOnce()
+			if err != nil {
+				logger.Error("清理过期键失败", zap.Error(err))
+				break
+			}
+			if n > 0 {
+				logger.Debug("清理过期键", zap.Int("count", n))
+			}
+			if n < d.reapBatchSize {
+				break
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+
+		d.pruneHistory(stop)
+	}
+}
+
+// reapOnce 物理删除一批已过期的键，返回删除的数量。
+// 从节点不自己清理，等待主节点清理后通过复制日志删除，读取时已过期的键同样不可见
+func (d *DB) reapOnce() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.replica != nil {
+		return 0, nil
+	}
+
+	now := time.Now().UnixNano()
+	ops := make([]writeOp, 0, d.reapBatchSize)
+	for key, expireAt := range d.expires {
+		if expireAt > now {
+			continue
+		}
+		ops = append(ops, writeOp{key: []byte(key), delete: true, expired: true})
+		if len(ops) == d.reapBatchSize {
+			break
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	if _, err := d.applyLocked(ops); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
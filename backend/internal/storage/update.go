@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrConditionNotMet 表示键的当前状态不满足写入条件
+var ErrConditionNotMet = errors.New("precondition failed")
+
+// Entry 是键的当前状态
+type Entry struct {
+	Value []byte
+	Meta  *KeyMeta // 旧版本写入的数据没有元数据，此时为nil
+}
+
+// Mutation 描述Update要执行的写入
+type Mutation struct {
+	Value    []byte
+	Delete   bool
+	ExpireAt time.Time // 零值表示不过期
+	KeepTTL  bool      // 保留键原有的过期时间，此时忽略ExpireAt
+	// RequestID 是发起写入的请求ID，记录在历史版本中
+	RequestID string
+}
+
+// Update 在写锁内读取键的当前状态，由fn决定如何写入，保证读-改-写的原子性。
+// cur为nil表示键不存在；fn返回nil表示不写入，返回错误则放弃写入并原样返回该错误。
+// 返回写入后键的元数据，删除或未写入时返回nil
+func (d *DB) Update(key []byte, fn func(cur *Entry) (*Mutation, error)) (*KeyMeta, error) {
+	if err := checkUserKey(key); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cur, err := d.entryLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fn(cur)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	op := writeOp{key: key, value: m.Value, delete: m.Delete, requestID: m.RequestID}
+	switch {
+	case m.KeepTTL:
+		// 已过期但尚未清理的键视为不存在，不能沿用旧的过期时间
+		op.keepTTL = cur != nil
+	case !m.ExpireAt.IsZero():
+		if !m.ExpireAt.After(time.Now()) {
+			return nil, ErrInvalidExpireAt
+		}
+		op.expireAt = m.ExpireAt.UnixNano()
+	}
+
+	metas, err := d.applyLocked([]writeOp{op})
+	if err != nil {
+		return nil, err
+	}
+	return metas[string(key)], nil
+}
+
+// entryLocked 读取键的当前状态，键不存在或已过期时返回nil，调用方必须持有锁
+func (d *DB) entryLocked(key []byte) (*Entry, error) {
+	if d.expiredLocked(key, time.Now().UnixNano()) {
+		return nil, nil
+	}
+	value, err := d.store.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta, ok, err := d.readMetaLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{Value: value}
+	if ok {
+		entry.Meta = &meta
+	}
+	return entry, nil
+}
+
+// CompareAndSwap 仅当键的当前值等于expected时写入value，expected为nil表示要求键不存在。
+// 比较与写入在同一把写锁内完成，写入保留键原有的过期时间，requestID记录在历史版本中。
+// 不满足条件时返回ErrConditionNotMet和键的当前状态
+func (d *DB) CompareAndSwap(key []byte, expected, value []byte, requestID string) (*KeyMeta, *Entry, error) {
+	var current *Entry
+	meta, err := d.Update(key, func(cur *Entry) (*Mutation, error) {
+		current = cur
+		switch {
+		case expected == nil && cur != nil,
+			expected != nil && (cur == nil || string(cur.Value) != string(expected)):
+			return nil, ErrConditionNotMet
+		}
+		return &Mutation{Value: value, KeepTTL: true, RequestID: requestID}, nil
+	})
+	if err != nil {
+		return nil, current, err
+	}
+	return meta, nil, nil
+}
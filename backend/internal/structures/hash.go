@@ -0,0 +1,132 @@
+package structures
+
+import (
+	"FastDB-Web/internal/storage"
+	"errors"
+	"sort"
+)
+
+// HSet 设置哈希中的字段，返回新增的字段数
+func (s *Store) HSet(key []byte, fields map[string][]byte) (int, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, hashPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		m = &meta{typ: hashPrefix}
+	}
+
+	// 按字段名排序，保证写入顺序稳定
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	batch := s.kv.NewWriteBatch()
+	added := 0
+	for _, name := range names {
+		k := elemKey(hashPrefix, key, []byte(name))
+		ok, err := s.exists(k)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			added++
+		}
+		if err := batch.Put(k, fields[name]); err != nil {
+			return 0, err
+		}
+	}
+	m.count += int64(added)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// HGet 获取哈希中字段的值，键不存在时返回storage.ErrKeyNotFound，字段不存在时返回ErrFieldNotFound
+func (s *Store) HGet(key, field []byte) ([]byte, error) {
+	m, err := s.readMeta(key, hashPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	value, err := s.kv.Get(elemKey(hashPrefix, key, field))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, ErrFieldNotFound
+	}
+	return value, err
+}
+
+// HDel 删除哈希中的字段，返回实际删除的字段数，删除最后一个字段时哈希随之删除
+func (s *Store) HDel(key []byte, fields ...[]byte) (int, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, hashPrefix)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	batch := s.kv.NewWriteBatch()
+	seen := make(map[string]bool, len(fields))
+	removed := 0
+	for _, field := range fields {
+		if seen[string(field)] {
+			continue
+		}
+		seen[string(field)] = true
+		k := elemKey(hashPrefix, key, field)
+		ok, err := s.exists(k)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if err := batch.Delete(k); err != nil {
+			return 0, err
+		}
+		removed++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	m.count -= int64(removed)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// HGetAll 返回哈希中所有的字段和值，键不存在时返回storage.ErrKeyNotFound
+func (s *Store) HGetAll(key []byte) (map[string][]byte, error) {
+	m, err := s.readMeta(key, hashPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	prefix := elemPrefix(hashPrefix, key)
+	fields := make(map[string][]byte, m.count)
+	err = s.kv.Scan(storage.ScanOptions{Prefix: prefix}, func(k []byte, value []byte) bool {
+		fields[string(k[len(prefix):])] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
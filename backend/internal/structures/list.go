@@ -0,0 +1,168 @@
+package structures
+
+import (
+	"FastDB-Web/internal/storage"
+	"bytes"
+	"encoding/binary"
+)
+
+// listIndex 把元素位置编码为8字节大端序，翻转符号位使负数排在正数之前
+func listIndex(i int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(i)^(1<<63))
+}
+
+// LPush 依次把values插入列表头部，返回插入后列表的长度
+func (s *Store) LPush(key []byte, values ...[]byte) (int64, error) {
+	return s.push(key, values, true)
+}
+
+// RPush 依次把values追加到列表尾部，返回追加后列表的长度
+func (s *Store) RPush(key []byte, values ...[]byte) (int64, error) {
+	return s.push(key, values, false)
+}
+
+func (s *Store) push(key []byte, values [][]byte, left bool) (int64, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, listPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		m = &meta{typ: listPrefix}
+	}
+	if len(values) == 0 {
+		return m.length(), nil
+	}
+	batch := s.kv.NewWriteBatch()
+	for _, value := range values {
+		var pos int64
+		if left {
+			m.head--
+			pos = m.head
+		} else {
+			pos = m.tail
+			m.tail++
+		}
+		if err := batch.Put(elemKey(listPrefix, key, listIndex(pos)), value); err != nil {
+			return 0, err
+		}
+	}
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return m.length(), nil
+}
+
+// LPop 移除并返回列表头部的至多count个元素，列表不存在时返回空
+func (s *Store) LPop(key []byte, count int) ([][]byte, error) {
+	return s.pop(key, count, true)
+}
+
+// RPop 移除并返回列表尾部的至多count个元素，列表不存在时返回空
+func (s *Store) RPop(key []byte, count int) ([][]byte, error) {
+	return s.pop(key, count, false)
+}
+
+func (s *Store) pop(key []byte, count int, left bool) ([][]byte, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, listPrefix)
+	if err != nil || m == nil || count <= 0 {
+		return nil, err
+	}
+	n := min(int64(count), m.length())
+
+	// 分批弹出，每批同时更新元数据中的首尾位置，中途失败时已经提交的批次不会恢复
+	opts := storage.ScanOptions{Prefix: elemPrefix(listPrefix, key), Reverse: !left}
+	values := make([][]byte, 0, n)
+	for remaining := n; remaining > 0; {
+		size := min(remaining, deleteBatchSize)
+		batch := s.kv.NewWriteBatch()
+		chunk := make([][]byte, 0, size)
+		var stageErr error
+		err = s.kv.Scan(opts, func(k []byte, value []byte) bool {
+			if stageErr = batch.Delete(k); stageErr != nil {
+				return false
+			}
+			chunk = append(chunk, bytes.Clone(value))
+			return int64(len(chunk)) < size
+		})
+		if err == nil {
+			err = stageErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		if left {
+			m.head += int64(len(chunk))
+		} else {
+			m.tail -= int64(len(chunk))
+		}
+		if err := stageMeta(batch, key, m); err != nil {
+			return nil, err
+		}
+		if err := batch.Commit(); err != nil {
+			return nil, err
+		}
+		values = append(values, chunk...)
+		remaining -= int64(len(chunk))
+	}
+	return values, nil
+}
+
+// LRange 返回列表中位置在[start, stop]内的元素，负数表示从尾部倒数，
+// 与Redis的LRANGE相同。列表不存在时返回storage.ErrKeyNotFound
+func (s *Store) LRange(key []byte, start, stop int64) ([][]byte, error) {
+	m, err := s.readMeta(key, listPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	length := m.length()
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return [][]byte{}, nil
+	}
+
+	prefix := elemPrefix(listPrefix, key)
+	values := make([][]byte, 0, stop-start+1)
+	err = s.kv.Scan(storage.ScanOptions{
+		Prefix: prefix,
+		Start:  elemKey(listPrefix, key, listIndex(m.head+start)),
+		End:    elemKey(listPrefix, key, listIndex(m.head+stop+1)),
+	}, func(_ []byte, value []byte) bool {
+		values = append(values, value)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// LLen 返回列表的长度，列表不存在时返回0
+func (s *Store) LLen(key []byte) (int64, error) {
+	m, err := s.readMeta(key, listPrefix)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	return m.length(), nil
+}
@@ -0,0 +1,124 @@
+package structures
+
+import (
+	"FastDB-Web/internal/storage"
+)
+
+// SAdd 向集合添加成员，返回新增的成员数
+func (s *Store) SAdd(key []byte, members ...[]byte) (int, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, setPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		m = &meta{typ: setPrefix}
+	}
+	batch := s.kv.NewWriteBatch()
+	seen := make(map[string]bool, len(members))
+	added := 0
+	for _, member := range members {
+		if seen[string(member)] {
+			continue
+		}
+		seen[string(member)] = true
+		k := elemKey(setPrefix, key, member)
+		ok, err := s.exists(k)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			continue
+		}
+		if err := batch.Put(k, []byte{}); err != nil {
+			return 0, err
+		}
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	m.count += int64(added)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// SRem 从集合移除成员，返回实际移除的成员数，移除最后一个成员时集合随之删除
+func (s *Store) SRem(key []byte, members ...[]byte) (int, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, setPrefix)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	batch := s.kv.NewWriteBatch()
+	seen := make(map[string]bool, len(members))
+	removed := 0
+	for _, member := range members {
+		if seen[string(member)] {
+			continue
+		}
+		seen[string(member)] = true
+		k := elemKey(setPrefix, key, member)
+		ok, err := s.exists(k)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if err := batch.Delete(k); err != nil {
+			return 0, err
+		}
+		removed++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	m.count -= int64(removed)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// SMembers 按字典序返回集合的所有成员，集合不存在时返回storage.ErrKeyNotFound
+func (s *Store) SMembers(key []byte) ([][]byte, error) {
+	m, err := s.readMeta(key, setPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	prefix := elemPrefix(setPrefix, key)
+	members := make([][]byte, 0, m.count)
+	err = s.kv.Scan(storage.ScanOptions{Prefix: prefix, KeysOnly: true}, func(k []byte, _ []byte) bool {
+		members = append(members, k[len(prefix):])
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SIsMember 判断member是否在集合中，集合不存在时返回false
+func (s *Store) SIsMember(key, member []byte) (bool, error) {
+	m, err := s.readMeta(key, setPrefix)
+	if err != nil || m == nil {
+		return false, err
+	}
+	return s.exists(elemKey(setPrefix, key, member))
+}
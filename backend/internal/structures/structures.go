@@ -0,0 +1,291 @@
+// Package structures 在KVStore之上实现类似Redis的哈希、列表、集合和有序集合。
+//
+// 每个结构由一条元数据记录和若干元素记录组成，元素各自占用一个键，
+// 修改单个字段或成员时不需要重写整个结构：
+//
+//	m + 键                           -> 类型 + 元素数量（列表为首尾位置）
+//	h + uvarint(len(键)) + 键 + 字段   -> 字段值
+//	l + uvarint(len(键)) + 键 + 位置   -> 元素值，位置为8字节大端序，保证按顺序遍历
+//	s + uvarint(len(键)) + 键 + 成员   -> 空
+//	z + uvarint(len(键)) + 键 + 成员   -> 分数
+//	Z + uvarint(len(键)) + 键 + 分数 + 成员 -> 空，按分数排序的索引，分数为保序编码的8字节
+//
+// 所有结构共用同一个键空间，对一个键使用错误类型的操作会返回ErrWrongType
+package structures
+
+import (
+	"FastDB-Web/internal/storage"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Namespace 是数据结构在DB中使用的内部命名空间
+const Namespace = "struct"
+
+// deleteBatchSize 是删除整个结构或弹出元素时每个批量写入最多删除的元素数，
+// 元素很多时分成多个批量写入，每个批量写入和对应的复制日志都不会过大
+const deleteBatchSize = 500
+
+// 结构的类型
+const (
+	TypeHash = "hash"
+	TypeList = "list"
+	TypeSet  = "set"
+	TypeZSet = "zset"
+)
+
+// 记录类型的前缀
+const (
+	metaPrefix byte = 'm'
+	hashPrefix byte = 'h'
+	listPrefix byte = 'l'
+	setPrefix  byte = 's'
+	zsetPrefix byte = 'z'
+	// zsetIndexPrefix 是有序集合分数索引的前缀
+	zsetIndexPrefix byte = 'Z'
+)
+
+var (
+	// ErrWrongType 表示键上已经存在另一种类型的结构
+	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+	// ErrFieldNotFound 表示哈希中不存在该字段
+	ErrFieldNotFound = errors.New("field not found")
+	// ErrCorrupted 表示结构的元数据记录无法解析
+	ErrCorrupted = errors.New("corrupted structure metadata")
+)
+
+// Backend 是数据结构依赖的存储，LockKey用于串行化同一个键上的读-改-写
+type Backend interface {
+	storage.KVStore
+	LockKey(key []byte) (unlock func())
+}
+
+// Store 在Backend之上提供哈希、列表、集合和有序集合操作
+type Store struct {
+	kv Backend
+}
+
+// New 在kv之上创建Store
+func New(kv Backend) *Store {
+	return &Store{kv: kv}
+}
+
+// Open 返回使用db内部命名空间的Store
+func Open(db *storage.DB) *Store {
+	return New(db.Namespace(Namespace))
+}
+
+// meta 是结构的元数据
+type meta struct {
+	typ   byte
+	count int64 // 哈希的字段数或（有序）集合的成员数
+	head  int64 // 列表第一个元素的位置
+	tail  int64 // 列表最后一个元素之后的位置
+}
+
+// length 返回结构中元素的数量
+func (m *meta) length() int64 {
+	if m.typ == listPrefix {
+		return m.tail - m.head
+	}
+	return m.count
+}
+
+func encodeMeta(m *meta) []byte {
+	buf := []byte{m.typ}
+	if m.typ == listPrefix {
+		buf = binary.AppendVarint(buf, m.head)
+		return binary.AppendVarint(buf, m.tail)
+	}
+	return binary.AppendVarint(buf, m.count)
+}
+
+func decodeMeta(data []byte) (*meta, error) {
+	if len(data) == 0 {
+		return nil, ErrCorrupted
+	}
+	m := &meta{typ: data[0]}
+	rest := data[1:]
+	var n int
+	switch m.typ {
+	case listPrefix:
+		if m.head, n = binary.Varint(rest); n <= 0 {
+			return nil, ErrCorrupted
+		}
+		if m.tail, n = binary.Varint(rest[n:]); n <= 0 {
+			return nil, ErrCorrupted
+		}
+	case hashPrefix, setPrefix, zsetPrefix:
+		if m.count, n = binary.Varint(rest); n <= 0 {
+			return nil, ErrCorrupted
+		}
+	default:
+		return nil, ErrCorrupted
+	}
+	return m, nil
+}
+
+func metaKey(key []byte) []byte {
+	return append([]byte{metaPrefix}, key...)
+}
+
+// elemPrefix 返回结构中所有元素共同的键前缀，键长度前缀保证不同键的元素不会相互混淆
+func elemPrefix(typ byte, key []byte) []byte {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(key))
+	buf = append(buf, typ)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	return append(buf, key...)
+}
+
+func elemKey(typ byte, key, sub []byte) []byte {
+	return append(elemPrefix(typ, key), sub...)
+}
+
+// readMeta 读取键的元数据，键不存在时返回nil；want不为0时校验类型
+func (s *Store) readMeta(key []byte, want byte) (*meta, error) {
+	if len(key) == 0 {
+		return nil, storage.ErrKeyIsEmpty
+	}
+	data, err := s.kv.Get(metaKey(key))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMeta(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w for key %q", err, key)
+	}
+	if want != 0 && m.typ != want {
+		return nil, ErrWrongType
+	}
+	return m, nil
+}
+
+// stageMeta 在批量写入中更新元数据，结构为空时删除整个结构
+func stageMeta(batch storage.WriteBatch, key []byte, m *meta) error {
+	if m.length() == 0 {
+		return batch.Delete(metaKey(key))
+	}
+	return batch.Put(metaKey(key), encodeMeta(m))
+}
+
+// exists 判断元素记录是否存在
+func (s *Store) exists(key []byte) (bool, error) {
+	_, err := s.kv.Get(key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Type 返回键上结构的类型，键不存在时返回storage.ErrKeyNotFound
+func (s *Store) Type(key []byte) (string, error) {
+	m, err := s.readMeta(key, 0)
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		return "", storage.ErrKeyNotFound
+	}
+	return typeName(m.typ), nil
+}
+
+func typeName(typ byte) string {
+	switch typ {
+	case hashPrefix:
+		return TypeHash
+	case listPrefix:
+		return TypeList
+	case zsetPrefix:
+		return TypeZSet
+	default:
+		return TypeSet
+	}
+}
+
+// Delete 删除键上的整个结构，typ不为空时要求结构是该类型，返回是否删除了结构。
+// 元素分批删除，每批同时更新元数据，元数据在最后一批中删除，中途失败时结构仍然可用，只是少了已删除的元素
+func (s *Store) Delete(key []byte, typ string) (bool, error) {
+	want, err := typePrefix(typ)
+	if err != nil {
+		return false, err
+	}
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, want)
+	if err != nil || m == nil {
+		return false, err
+	}
+	for {
+		n, err := s.deleteElems(key, m)
+		if err != nil {
+			return false, err
+		}
+		if n < deleteBatchSize {
+			return true, nil
+		}
+	}
+}
+
+// deleteElems 在一个批量写入中删除结构开头的至多deleteBatchSize个元素并更新元数据，
+// 不足一批时说明已经删完，同时删除元数据。返回删除的元素数，调用方必须持有键的锁
+func (s *Store) deleteElems(key []byte, m *meta) (int, error) {
+	prefix := elemPrefix(m.typ, key)
+	batch := s.kv.NewWriteBatch()
+	n := 0
+	var stageErr error
+	err := s.kv.Scan(storage.ScanOptions{Prefix: prefix, KeysOnly: m.typ != zsetPrefix}, func(k []byte, value []byte) bool {
+		stageErr = batch.Delete(k)
+		if stageErr == nil && m.typ == zsetPrefix {
+			// 有序集合的成员同时删除分数索引中的记录
+			var score float64
+			if score, stageErr = decodeScore(value); stageErr == nil {
+				stageErr = batch.Delete(scoreKey(key, score, k[len(prefix):]))
+			}
+		}
+		n++
+		return stageErr == nil && n < deleteBatchSize
+	})
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if n < deleteBatchSize {
+		err = batch.Delete(metaKey(key))
+	} else {
+		if m.typ == listPrefix {
+			m.head = min(m.head+int64(n), m.tail)
+		} else {
+			m.count = max(m.count-int64(n), 0)
+		}
+		err = stageMeta(batch, key, m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, batch.Commit()
+}
+
+func typePrefix(typ string) (byte, error) {
+	switch typ {
+	case "":
+		return 0, nil
+	case TypeHash:
+		return hashPrefix, nil
+	case TypeList:
+		return listPrefix, nil
+	case TypeSet:
+		return setPrefix, nil
+	case TypeZSet:
+		return zsetPrefix, nil
+	default:
+		return 0, fmt.Errorf("unknown structure type: %q", typ)
+	}
+}
@@ -0,0 +1,397 @@
+package structures_test
+
+import (
+	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/storage"
+	"FastDB-Web/internal/structures"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fastdb-web-logs")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(dir, "error", false)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// forEachEngine 在每种存储引擎上打开一个数据库并运行f
+func forEachEngine(t *testing.T, f func(t *testing.T, db *storage.DB, s *structures.Store)) {
+	for _, typ := range []string{config.StorageTypeMemory, config.StorageTypeBBolt, config.StorageTypeFastDB} {
+		t.Run(typ, func(t *testing.T) {
+			db, err := storage.Open(config.StorageConfig{
+				Type:            typ,
+				Path:            t.TempDir(),
+				DefaultDatabase: "default",
+				MaxBatchOps:     1000,
+				BackupDir:       t.TempDir(),
+				ReapInterval:    1,
+				ReapBatchSize:   100,
+				SegmentSize:     64 * 1024 * 1024,
+				IndexType:       config.IndexTypeBTree,
+			})
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer db.Close()
+			f(t, db, structures.Open(db))
+		})
+	}
+}
+
+func strs(values [][]byte) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = string(v)
+	}
+	return result
+}
+
+func TestHash(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		added, err := s.HSet([]byte("user"), map[string][]byte{"name": []byte("ann"), "age": []byte("30")})
+		if err != nil || added != 2 {
+			t.Fatalf("HSet = %d, %v, want 2", added, err)
+		}
+		if added, _ := s.HSet([]byte("user"), map[string][]byte{"age": []byte("31"), "city": []byte("x")}); added != 1 {
+			t.Fatalf("HSet existing field added = %d, want 1", added)
+		}
+		if value, err := s.HGet([]byte("user"), []byte("age")); err != nil || string(value) != "31" {
+			t.Fatalf("HGet = %q, %v, want 31", value, err)
+		}
+		if _, err := s.HGet([]byte("user"), []byte("missing")); !errors.Is(err, structures.ErrFieldNotFound) {
+			t.Fatalf("HGet missing field error = %v, want ErrFieldNotFound", err)
+		}
+		if _, err := s.HGet([]byte("nobody"), []byte("age")); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("HGet missing key error = %v, want ErrKeyNotFound", err)
+		}
+
+		if removed, err := s.HDel([]byte("user"), []byte("city"), []byte("city"), []byte("missing")); err != nil || removed != 1 {
+			t.Fatalf("HDel = %d, %v, want 1", removed, err)
+		}
+		fields, err := s.HGetAll([]byte("user"))
+		if err != nil {
+			t.Fatalf("HGetAll failed: %v", err)
+		}
+		want := map[string][]byte{"name": []byte("ann"), "age": []byte("31")}
+		if !reflect.DeepEqual(fields, want) {
+			t.Fatalf("HGetAll = %q, want %q", fields, want)
+		}
+
+		// 删除最后一个字段后哈希不再存在
+		s.HDel([]byte("user"), []byte("name"), []byte("age"))
+		if _, err := s.HGetAll([]byte("user")); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("HGetAll after deleting all fields error = %v, want ErrKeyNotFound", err)
+		}
+
+		// 数据结构不出现在用户键空间中
+		if keys := db.GetListKeys(); len(keys) != 0 {
+			t.Fatalf("structures leaked into user keys: %q", keys)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		s.RPush([]byte("q"), []byte("b"), []byte("c"))
+		length, err := s.LPush([]byte("q"), []byte("a"), []byte("z"))
+		if err != nil || length != 4 {
+			t.Fatalf("LPush = %d, %v, want 4", length, err)
+		}
+
+		tests := []struct {
+			start, stop int64
+			want        []string
+		}{
+			{0, -1, []string{"z", "a", "b", "c"}},
+			{1, 2, []string{"a", "b"}},
+			{-2, -1, []string{"b", "c"}},
+			{-100, 1, []string{"z", "a"}},
+			{2, 100, []string{"b", "c"}},
+			{3, 1, []string{}},
+			{10, 20, []string{}},
+		}
+		for _, tt := range tests {
+			values, err := s.LRange([]byte("q"), tt.start, tt.stop)
+			if err != nil {
+				t.Fatalf("LRange(%d, %d) failed: %v", tt.start, tt.stop, err)
+			}
+			if got := strs(values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LRange(%d, %d) = %q, want %q", tt.start, tt.stop, got, tt.want)
+			}
+		}
+
+		if values, err := s.LPop([]byte("q"), 2); err != nil || !reflect.DeepEqual(strs(values), []string{"z", "a"}) {
+			t.Fatalf("LPop = %q, %v, want [z a]", values, err)
+		}
+		if values, err := s.RPop([]byte("q"), 5); err != nil || !reflect.DeepEqual(strs(values), []string{"c", "b"}) {
+			t.Fatalf("RPop = %q, %v, want [c b]", values, err)
+		}
+		if values, err := s.LPop([]byte("q"), 1); err != nil || len(values) != 0 {
+			t.Fatalf("LPop on empty list = %q, %v", values, err)
+		}
+		if _, err := s.LRange([]byte("q"), 0, -1); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("LRange on empty list error = %v, want ErrKeyNotFound", err)
+		}
+	})
+}
+
+func TestSet(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		added, err := s.SAdd([]byte("tags"), []byte("go"), []byte("db"), []byte("go"))
+		if err != nil || added != 2 {
+			t.Fatalf("SAdd = %d, %v, want 2", added, err)
+		}
+		if added, _ := s.SAdd([]byte("tags"), []byte("db"), []byte("kv")); added != 1 {
+			t.Fatalf("SAdd existing member added = %d, want 1", added)
+		}
+		members, err := s.SMembers([]byte("tags"))
+		if err != nil || !reflect.DeepEqual(strs(members), []string{"db", "go", "kv"}) {
+			t.Fatalf("SMembers = %q, %v, want [db go kv]", members, err)
+		}
+		if ok, err := s.SIsMember([]byte("tags"), []byte("go")); err != nil || !ok {
+			t.Fatalf("SIsMember(go) = %v, %v, want true", ok, err)
+		}
+		if ok, _ := s.SIsMember([]byte("nothing"), []byte("go")); ok {
+			t.Fatal("SIsMember on missing set = true")
+		}
+		if removed, err := s.SRem([]byte("tags"), []byte("go"), []byte("nope")); err != nil || removed != 1 {
+			t.Fatalf("SRem = %d, %v, want 1", removed, err)
+		}
+		if ok, _ := s.SIsMember([]byte("tags"), []byte("go")); ok {
+			t.Fatal("removed member is still in the set")
+		}
+	})
+}
+
+func TestTypesAndKeys(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		s.SAdd([]byte("a"), []byte("x"))
+		s.SAdd([]byte("ab"), []byte("y"))
+		if _, err := s.LPush([]byte("a"), []byte("v")); !errors.Is(err, structures.ErrWrongType) {
+			t.Fatalf("LPush on set error = %v, want ErrWrongType", err)
+		}
+		if typ, err := s.Type([]byte("a")); err != nil || typ != structures.TypeSet {
+			t.Fatalf("Type = %q, %v, want set", typ, err)
+		}
+
+		// 键是另一个键的前缀时元素不能混在一起
+		if members, _ := s.SMembers([]byte("a")); !reflect.DeepEqual(strs(members), []string{"x"}) {
+			t.Fatalf("SMembers(a) = %q, want [x]", members)
+		}
+		if _, err := s.Delete([]byte("a"), structures.TypeHash); !errors.Is(err, structures.ErrWrongType) {
+			t.Fatalf("Delete with wrong type error = %v, want ErrWrongType", err)
+		}
+		if deleted, err := s.Delete([]byte("a"), structures.TypeSet); err != nil || !deleted {
+			t.Fatalf("Delete = %v, %v, want true", deleted, err)
+		}
+		if members, _ := s.SMembers([]byte("ab")); !reflect.DeepEqual(strs(members), []string{"y"}) {
+			t.Fatalf("SMembers(ab) after deleting a = %q, want [y]", members)
+		}
+		if _, err := s.Type([]byte("a")); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Fatalf("Type after Delete error = %v, want ErrKeyNotFound", err)
+		}
+	})
+}
+
+func TestConcurrentPush(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					if _, err := structures.Open(db).RPush([]byte("q"), []byte(fmt.Sprintf("%d-%d", i, j))); err != nil {
+						t.Errorf("RPush failed: %v", err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		if length, err := s.LLen([]byte("q")); err != nil || length != 200 {
+			t.Fatalf("LLen = %d, %v, want 200", length, err)
+		}
+		values, err := s.LRange([]byte("q"), 0, -1)
+		if err != nil || len(values) != 200 {
+			t.Fatalf("LRange returned %d values, %v, want 200", len(values), err)
+		}
+	})
+}
+
+// cappedBackend 限制每个批量写入的操作数，模拟有批量写入上限的存储引擎
+type cappedBackend struct {
+	structures.Backend
+	max int
+}
+
+func (b cappedBackend) NewWriteBatch() storage.WriteBatch {
+	return &cappedBatch{WriteBatch: b.Backend.NewWriteBatch(), max: b.max}
+}
+
+type cappedBatch struct {
+	storage.WriteBatch
+	max, ops int
+}
+
+func (b *cappedBatch) Put(key, value []byte) error {
+	if b.ops++; b.ops > b.max {
+		return storage.ErrBatchTooLarge
+	}
+	return b.WriteBatch.Put(key, value)
+}
+
+func (b *cappedBatch) Delete(key []byte) error {
+	if b.ops++; b.ops > b.max {
+		return storage.ErrBatchTooLarge
+	}
+	return b.WriteBatch.Delete(key)
+}
+
+func TestDeleteLargeStructures(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		// 每种结构的元素都超过批量写入的上限，有序集合每个成员还有一条分数索引记录
+		const n = 2500
+		fields := make(map[string][]byte, n)
+		values := make([][]byte, n)
+		scored := make([]structures.ScoredMember, n)
+		for i := range values {
+			values[i] = []byte(fmt.Sprintf("%05d", i))
+			fields[string(values[i])] = values[i]
+			scored[i] = structures.ScoredMember{Member: values[i], Score: float64(i)}
+		}
+		s.HSet([]byte("h"), fields)
+		s.RPush([]byte("l"), values...)
+		s.RPush([]byte("p"), values...)
+		s.SAdd([]byte("s"), values...)
+		if _, err := s.ZAdd([]byte("z"), scored...); err != nil {
+			t.Fatalf("ZAdd failed: %v", err)
+		}
+
+		capped := structures.New(cappedBackend{Backend: db.Namespace(structures.Namespace), max: 1200})
+		for _, key := range []string{"h", "l", "s", "z"} {
+			if deleted, err := capped.Delete([]byte(key), ""); err != nil || !deleted {
+				t.Fatalf("Delete(%s) = %v, %v, want true", key, deleted, err)
+			}
+			if _, err := s.Type([]byte(key)); !errors.Is(err, storage.ErrKeyNotFound) {
+				t.Fatalf("Type(%s) after Delete error = %v, want ErrKeyNotFound", key, err)
+			}
+		}
+
+		popped, err := capped.LPop([]byte("p"), 2000)
+		if err != nil || len(popped) != 2000 || string(popped[1999]) != "01999" {
+			t.Fatalf("LPop returned %d values, %v", len(popped), err)
+		}
+		if rest, err := s.LRange([]byte("p"), 0, -1); err != nil || len(rest) != 500 || string(rest[0]) != "02000" {
+			t.Fatalf("LRange after LPop returned %d values, %v", len(rest), err)
+		}
+
+		// 只剩下列表p的元数据和元素记录
+		if keys := db.Namespace(structures.Namespace).GetListKeys(); len(keys) != 501 {
+			t.Fatalf("%d records left in the namespace, want 501", len(keys))
+		}
+	})
+}
+
+func zmembers(members []structures.ScoredMember) []string {
+	result := make([]string, len(members))
+	for i, m := range members {
+		result[i] = fmt.Sprintf("%s:%g", m.Member, m.Score)
+	}
+	return result
+}
+
+func TestSortedSet(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, db *storage.DB, s *structures.Store) {
+		key := []byte("board")
+		added, err := s.ZAdd(key,
+			structures.ScoredMember{Member: []byte("ann"), Score: 10},
+			structures.ScoredMember{Member: []byte("bob"), Score: -2.5},
+			structures.ScoredMember{Member: []byte("cat"), Score: 10},
+			structures.ScoredMember{Member: []byte("dan"), Score: 0},
+		)
+		if err != nil || added != 4 {
+			t.Fatalf("ZAdd = %d, %v, want 4", added, err)
+		}
+		// 更新已有成员的分数不算新增
+		if added, _ := s.ZAdd(key, structures.ScoredMember{Member: []byte("dan"), Score: 3}); added != 0 {
+			t.Fatalf("ZAdd existing member added = %d, want 0", added)
+		}
+
+		all, err := s.ZRange(key, 0, -1, false)
+		if want := []string{"bob:-2.5", "dan:3", "ann:10", "cat:10"}; err != nil || !reflect.DeepEqual(zmembers(all), want) {
+			t.Fatalf("ZRange = %q, %v, want %q", zmembers(all), err, want)
+		}
+		if top, _ := s.ZRange(key, 0, 1, true); !reflect.DeepEqual(zmembers(top), []string{"cat:10", "ann:10"}) {
+			t.Fatalf("reverse ZRange = %q", zmembers(top))
+		}
+
+		tests := []struct {
+			r             structures.ScoreRange
+			offset, limit int
+			want          []string
+		}{
+			{structures.ScoreRange{Min: 0, Max: 10}, 0, 0, []string{"dan:3", "ann:10", "cat:10"}},
+			{structures.ScoreRange{Min: 0, Max: 10, MaxExclusive: true}, 0, 0, []string{"dan:3"}},
+			{structures.ScoreRange{Min: -2.5, Max: 3, MinExclusive: true}, 0, 0, []string{"dan:3"}},
+			{structures.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, 1, 2, []string{"dan:3", "ann:10"}},
+			{structures.ScoreRange{Min: 20, Max: 30}, 0, 0, []string{}},
+		}
+		for _, tt := range tests {
+			got, err := s.ZRangeByScore(key, tt.r, tt.offset, tt.limit, false)
+			if err != nil || !reflect.DeepEqual(zmembers(got), tt.want) {
+				t.Errorf("ZRangeByScore(%+v, %d, %d) = %q, %v, want %q", tt.r, tt.offset, tt.limit, zmembers(got), err, tt.want)
+			}
+		}
+
+		if rank, err := s.ZRank(key, []byte("ann"), false); err != nil || rank != 2 {
+			t.Fatalf("ZRank(ann) = %d, %v, want 2", rank, err)
+		}
+		if rank, _ := s.ZRank(key, []byte("ann"), true); rank != 1 {
+			t.Fatalf("reverse ZRank(ann) = %d, want 1", rank)
+		}
+		if _, err := s.ZRank(key, []byte("zed"), false); !errors.Is(err, structures.ErrMemberNotFound) {
+			t.Fatalf("ZRank missing member error = %v, want ErrMemberNotFound", err)
+		}
+
+		if score, err := s.ZIncrBy(key, []byte("bob"), 20); err != nil || score != 17.5 {
+			t.Fatalf("ZIncrBy = %v, %v, want 17.5", score, err)
+		}
+		if top, _ := s.ZRange(key, -1, -1, false); !reflect.DeepEqual(zmembers(top), []string{"bob:17.5"}) {
+			t.Fatalf("ZRange after ZIncrBy = %q, want [bob:17.5]", zmembers(top))
+		}
+		if _, err := s.ZAdd(key, structures.ScoredMember{Member: []byte("x"), Score: math.NaN()}); !errors.Is(err, structures.ErrInvalidScore) {
+			t.Fatalf("ZAdd NaN error = %v, want ErrInvalidScore", err)
+		}
+
+		if removed, err := s.ZRem(key, []byte("ann"), []byte("nope")); err != nil || removed != 1 {
+			t.Fatalf("ZRem = %d, %v, want 1", removed, err)
+		}
+		if n, _ := s.ZCard(key); n != 3 {
+			t.Fatalf("ZCard = %d, want 3", n)
+		}
+		if got, _ := s.ZRangeByScore(key, structures.ScoreRange{Min: 10, Max: 10}, 0, 0, false); !reflect.DeepEqual(zmembers(got), []string{"cat:10"}) {
+			t.Fatalf("ZRangeByScore after ZRem = %q, want [cat:10]", zmembers(got))
+		}
+
+		// 删除有序集合同时删除分数索引，重新添加后不能看到旧成员
+		if deleted, err := s.Delete(key, structures.TypeZSet); err != nil || !deleted {
+			t.Fatalf("Delete = %v, %v", deleted, err)
+		}
+		s.ZAdd(key, structures.ScoredMember{Member: []byte("new"), Score: 1})
+		if got, _ := s.ZRangeByScore(key, structures.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, 0, 0, false); !reflect.DeepEqual(zmembers(got), []string{"new:1"}) {
+			t.Fatalf("ZRangeByScore after recreate = %q, want [new:1]", zmembers(got))
+		}
+	})
+}
@@ -0,0 +1,367 @@
+package structures
+
+import (
+	"FastDB-Web/internal/storage"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ErrMemberNotFound 表示有序集合中不存在该成员
+var ErrMemberNotFound = errors.New("member not found")
+
+// ErrInvalidScore 表示分数不是一个有限的数字
+var ErrInvalidScore = errors.New("score is not a valid number")
+
+// ScoredMember 是有序集合中的一个成员及其分数
+type ScoredMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ScoreRange 描述分数范围，默认包含两端
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+// encodeScore 把分数编码为8字节，字节序与分数的大小顺序一致
+func encodeScore(score float64) []byte {
+	if score == 0 {
+		// -0与0相等，统一编码为0
+		score = 0
+	}
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return binary.BigEndian.AppendUint64(nil, bits)
+}
+
+func decodeScore(data []byte) (float64, error) {
+	if len(data) != 8 {
+		return 0, ErrCorrupted
+	}
+	bits := binary.BigEndian.Uint64(data)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// scoreKey 返回分数索引中成员的键，索引按分数排序，分数相同时按成员排序
+func scoreKey(key []byte, score float64, member []byte) []byte {
+	return append(elemKey(zsetIndexPrefix, key, encodeScore(score)), member...)
+}
+
+func validScore(score float64) bool {
+	return !math.IsNaN(score) && !math.IsInf(score, 0)
+}
+
+// memberScore 读取成员的分数，成员不存在时ok为false
+func (s *Store) memberScore(key, member []byte) (score float64, ok bool, err error) {
+	data, err := s.kv.Get(elemKey(zsetPrefix, key, member))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	score, err = decodeScore(data)
+	return score, err == nil, err
+}
+
+// ZAdd 添加成员或更新已有成员的分数，返回新增的成员数。同一个成员出现多次时以最后一次为准
+func (s *Store) ZAdd(key []byte, members ...ScoredMember) (int, error) {
+	for _, m := range members {
+		if !validScore(m.Score) {
+			return 0, ErrInvalidScore
+		}
+	}
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		m = &meta{typ: zsetPrefix}
+	}
+
+	final := make(map[string]float64, len(members))
+	for _, member := range members {
+		final[string(member.Member)] = member.Score
+	}
+	batch := s.kv.NewWriteBatch()
+	added := 0
+	for member, score := range final {
+		old, ok, err := s.memberScore(key, []byte(member))
+		if err != nil {
+			return 0, err
+		}
+		if err := s.stageScore(batch, key, []byte(member), old, ok, score); err != nil {
+			return 0, err
+		}
+		if !ok {
+			added++
+		}
+	}
+	m.count += int64(added)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// stageScore 在批量写入中把成员的分数从old改为score，同时维护分数索引
+func (s *Store) stageScore(batch storage.WriteBatch, key, member []byte, old float64, exists bool, score float64) error {
+	if exists {
+		if old == score {
+			return nil
+		}
+		if err := batch.Delete(scoreKey(key, old, member)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(elemKey(zsetPrefix, key, member), encodeScore(score)); err != nil {
+		return err
+	}
+	return batch.Put(scoreKey(key, score, member), []byte{})
+}
+
+// ZIncrBy 把成员的分数加上delta并返回新分数，成员不存在时从0开始
+func (s *Store) ZIncrBy(key, member []byte, delta float64) (float64, error) {
+	if !validScore(delta) {
+		return 0, ErrInvalidScore
+	}
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		m = &meta{typ: zsetPrefix}
+	}
+	old, ok, err := s.memberScore(key, member)
+	if err != nil {
+		return 0, err
+	}
+	score := old + delta
+	if !validScore(score) {
+		return 0, ErrInvalidScore
+	}
+	batch := s.kv.NewWriteBatch()
+	if err := s.stageScore(batch, key, member, old, ok, score); err != nil {
+		return 0, err
+	}
+	if !ok {
+		m.count++
+	}
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZRem 移除成员，返回实际移除的成员数，移除最后一个成员时有序集合随之删除
+func (s *Store) ZRem(key []byte, members ...[]byte) (int, error) {
+	unlock := s.kv.LockKey(key)
+	defer unlock()
+
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	batch := s.kv.NewWriteBatch()
+	seen := make(map[string]bool, len(members))
+	removed := 0
+	for _, member := range members {
+		if seen[string(member)] {
+			continue
+		}
+		seen[string(member)] = true
+		score, ok, err := s.memberScore(key, member)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if err := batch.Delete(elemKey(zsetPrefix, key, member)); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(scoreKey(key, score, member)); err != nil {
+			return 0, err
+		}
+		removed++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	m.count -= int64(removed)
+	if err := stageMeta(batch, key, m); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// ZScore 返回成员的分数，有序集合不存在时返回storage.ErrKeyNotFound，成员不存在时返回ErrMemberNotFound
+func (s *Store) ZScore(key, member []byte) (float64, error) {
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return 0, storage.ErrKeyNotFound
+	}
+	score, ok, err := s.memberScore(key, member)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrMemberNotFound
+	}
+	return score, nil
+}
+
+// ZRank 返回成员按分数从小到大（reverse为true时从大到小）的排名，从0开始。
+// 排名需要遍历分数更小的成员，耗时与排名成正比
+func (s *Store) ZRank(key, member []byte, reverse bool) (int64, error) {
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return 0, storage.ErrKeyNotFound
+	}
+	score, ok, err := s.memberScore(key, member)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrMemberNotFound
+	}
+
+	var rank int64
+	err = s.kv.Scan(storage.ScanOptions{
+		Prefix:   elemPrefix(zsetIndexPrefix, key),
+		End:      scoreKey(key, score, member),
+		KeysOnly: true,
+	}, func(_ []byte, _ []byte) bool {
+		rank++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if reverse {
+		rank = m.count - 1 - rank
+	}
+	return rank, nil
+}
+
+// ZCard 返回有序集合的成员数，有序集合不存在时返回0
+func (s *Store) ZCard(key []byte) (int64, error) {
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	return m.count, nil
+}
+
+// ZRange 返回排名在[start, stop]内的成员，负数表示从末尾倒数，reverse为true时按分数从大到小排名。
+// 有序集合不存在时返回storage.ErrKeyNotFound
+func (s *Store) ZRange(key []byte, start, stop int64, reverse bool) ([]ScoredMember, error) {
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	if start < 0 {
+		start = max(m.count+start, 0)
+	}
+	if stop < 0 {
+		stop = m.count + stop
+	}
+	stop = min(stop, m.count-1)
+	if start > stop {
+		return []ScoredMember{}, nil
+	}
+	return s.scanScores(key, storage.ScanOptions{Reverse: reverse}, int(start), int(stop-start+1))
+}
+
+// ZRangeByScore 返回分数在r范围内的成员，跳过前offset个后最多返回limit个，limit不大于0表示不限制。
+// reverse为true时按分数从大到小返回。有序集合不存在时返回storage.ErrKeyNotFound
+func (s *Store) ZRangeByScore(key []byte, r ScoreRange, offset, limit int, reverse bool) ([]ScoredMember, error) {
+	m, err := s.readMeta(key, zsetPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	if math.IsNaN(r.Min) || math.IsNaN(r.Max) {
+		return nil, ErrInvalidScore
+	}
+
+	opts := storage.ScanOptions{Reverse: reverse}
+	minKey := elemKey(zsetIndexPrefix, key, encodeScore(r.Min))
+	if r.MinExclusive {
+		minKey = storage.PrefixEnd(minKey)
+	}
+	opts.Start = minKey
+	maxKey := elemKey(zsetIndexPrefix, key, encodeScore(r.Max))
+	if !r.MaxExclusive {
+		maxKey = storage.PrefixEnd(maxKey)
+	}
+	opts.End = maxKey
+	return s.scanScores(key, opts, offset, limit)
+}
+
+// scanScores 按opts遍历分数索引，跳过前skip个成员后最多返回limit个，limit不大于0表示不限制
+func (s *Store) scanScores(key []byte, opts storage.ScanOptions, skip, limit int) ([]ScoredMember, error) {
+	prefix := elemPrefix(zsetIndexPrefix, key)
+	opts.Prefix = prefix
+	opts.KeysOnly = true
+
+	members := []ScoredMember{}
+	var decodeErr error
+	err := s.kv.Scan(opts, func(k []byte, _ []byte) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+		rest := k[len(prefix):]
+		var score float64
+		if score, decodeErr = decodeScore(rest[:min(8, len(rest))]); decodeErr != nil {
+			return false
+		}
+		members = append(members, ScoredMember{Member: rest[8:], Score: score})
+		return limit <= 0 || len(members) < limit
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
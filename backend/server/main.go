@@ -4,7 +4,10 @@ import (
 	"FastDB-Web/global"
 	"FastDB-Web/internal/api"
 	"FastDB-Web/internal/config"
+	"FastDB-Web/internal/grpcapi"
 	"FastDB-Web/internal/logger"
+	"FastDB-Web/internal/replication"
+	"FastDB-Web/internal/resp"
 	"FastDB-Web/internal/storage"
 	"context"
 	"log"
@@ -12,6 +15,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
@@ -42,10 +46,10 @@ func main() {
 
 	// 加载配置
 	cfg, err := config.Load()
-	global.G_Config = cfg
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	global.G_Config = cfg
 
 	// 初始化日志系统
 	logger.InitLogger(cfg.Log.Path, cfg.Log.Level, cfg.Log.IsDevelopment)
@@ -68,23 +72,46 @@ func main() {
 	)
 
 	// 初始化存储
-	logger.Info("初始化存储", zap.String("type", cfg.Storage.Type))
-	store, err := storage.NewKVStore(cfg.Storage)
+	logger.Info("初始化存储",
+		zap.String("type", cfg.Storage.Type),
+		zap.String("path", cfg.Storage.Path),
+		zap.String("defaultDatabase", cfg.Storage.DefaultDatabase),
+		zap.String("indexType", cfg.Storage.IndexType),
+		zap.Int64("segmentSize", cfg.Storage.SegmentSize),
+		zap.Bool("syncWrites", cfg.Storage.SyncWrites),
+		zap.String("replicationRole", cfg.Storage.Replication.Role),
+	)
+	dbs, err := storage.NewRegistry(cfg.Storage)
 	if err != nil {
-		logger.Fatal("初始化存储失败", zap.Error(err))
+		logger.Fatal("初始化存储失败",
+			zap.String("type", cfg.Storage.Type),
+			zap.String("path", cfg.Storage.Path),
+			zap.Error(err),
+		)
 	}
-	defer store.Close()
+	defer dbs.Close()
 
 	// 初始化API处理器
-	handler := api.NewHandler(store)
+	handler := api.NewHandler(dbs)
 	router := handler.SetupRouter()
 
+	// 从节点在后台从主节点拉取复制日志
+	var follower *replication.Follower
+	if cfg.Storage.Replication.Role == config.ReplicationRoleFollower {
+		host, _ := os.Hostname()
+		follower = replication.NewFollower(dbs, cfg.Storage.Replication, host+":"+cfg.Server.Port)
+		handler.SetFollower(follower)
+		follower.Start()
+	}
+
 	// 创建HTTP服务器
 	addr := cfg.Server.Host + ":" + cfg.Server.Port
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: router,
 	}
+	// 关闭时先结束变更订阅和复制日志的长轮询，Shutdown才能等到所有请求结束
+	srv.RegisterOnShutdown(handler.Shutdown)
 
 	// 在goroutine中启动服务器
 	go func() {
@@ -94,6 +121,33 @@ func main() {
 		}
 	}()
 
+	// 兼容Redis协议的TCP服务，与HTTP API共用同一个数据库
+	var respServer *resp.Server
+	if cfg.Server.RespPort != "" {
+		respAddr := cfg.Server.Host + ":" + cfg.Server.RespPort
+		respServer = resp.NewServer(dbs, cfg.Server.RespPassword)
+		go func() {
+			logger.Info("启动RESP服务器",
+				zap.String("addr", respAddr),
+				zap.Bool("auth", cfg.Server.RespPassword != ""))
+			if err := respServer.ListenAndServe(respAddr); err != nil {
+				logger.Fatal("RESP服务器启动失败", zap.Error(err))
+			}
+		}()
+	}
+
+	// gRPC服务，与HTTP API共用同一组数据库和连接凭据
+	var grpcServer *grpcapi.Server
+	if cfg.Server.GRPCAddr != "" {
+		grpcServer = grpcapi.NewServer(dbs)
+		go func() {
+			logger.Info("启动gRPC服务器", zap.String("addr", cfg.Server.GRPCAddr))
+			if err := grpcServer.ListenAndServe(cfg.Server.GRPCAddr); err != nil {
+				logger.Fatal("gRPC服务器启动失败", zap.Error(err))
+			}
+		}()
+	}
+
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
 	// kill (无参数) 默认发送 syscall.SIGTERM
@@ -103,17 +157,44 @@ func main() {
 	<-quit
 	logger.Info("接收到关闭信号，开始关闭服务器")
 
-	// 设置5秒的超时时间来关闭服务器
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("服务器强制关闭", zap.Error(err))
+	// HTTP、gRPC和RESP服务同时关闭，各自有5秒的超时时间，
+	// 一个服务关闭超时不会占用其他服务的时间，也不会跳过后面关闭数据库的步骤
+	var wg sync.WaitGroup
+	shutdown := func(name string, stop func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := stop(ctx); err != nil {
+				logger.Warn("服务器关闭超时，已强制关闭", zap.String("server", name), zap.Error(err))
+			}
+		}()
+	}
+	shutdown("http", func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			srv.Close()
+		}
+		return err
+	})
+	if grpcServer != nil {
+		shutdown("grpc", grpcServer.Shutdown)
+	}
+	if respServer != nil {
+		shutdown("resp", respServer.Shutdown)
+	}
+	wg.Wait()
+
+	// 先停止复制，再关闭数据库
+	if follower != nil {
+		follower.Stop()
 	}
 
-	// 确保数据库连接关闭
+	// 确保数据库连接关闭，关闭时会停止各数据库的过期键清理
 	logger.Info("同步并关闭数据库连接")
-	store.Sync()
-	store.Close()
+	dbs.Sync()
+	dbs.Close()
 
 	logger.Info("服务器已安全关闭")
 }
@@ -11,8 +11,7 @@ const routes = [
     name: 'Dashboard',
     component: () => import('@/views/Dashboard.vue'),
     meta: {
-      title: '仪表盘 - FastDB数据管理系统',
-      requiresData: true
+      title: '仪表盘 - FastDB数据管理系统'
     }
   },
   {
@@ -52,9 +52,27 @@ api.interceptors.response.use(
 
 // KV数据库API
 export const kvApi = {
-  // 获取所有键值对
-  getAllItems() {
-    return api.get('/v1/kvs')
+  // 分页获取键值对，支持 prefix、start、end、limit、cursor、reverse 参数
+  listItems(params = {}) {
+    return api.get('/v1/kvs', { params })
+  },
+
+  // 获取所有键值对（按游标逐页拉取后合并为对象），metadata 为服务端记录的键元数据
+  async getAllItems() {
+    const items = {}
+    const metadata = {}
+    let cursor = ''
+    do {
+      const page = await this.listItems({ limit: 1000, cursor: cursor || undefined })
+      ;(page.items || []).forEach(({ key, value, ...meta }) => {
+        items[key] = value
+        if (meta.version) {
+          metadata[key] = meta
+        }
+      })
+      cursor = page.nextCursor
+    } while (cursor)
+    return { total: Object.keys(items).length, items, metadata }
   },
   
   // 获取单个键值对
@@ -77,6 +95,44 @@ export const kvApi = {
     return api.delete(`/v1/kv/${key}`)
   },
   
+  // 原子地把数值加上 delta，mode 为 int（默认）或 float
+  incrItem(key, delta = 1, mode = 'int') {
+    return api.post(`/v1/kv/${key}/incr`, { delta: String(delta), mode })
+  },
+  
+  // 原子地把数值减去 delta
+  decrItem(key, delta = 1, mode = 'int') {
+    return api.post(`/v1/kv/${key}/decr`, { delta: String(delta), mode })
+  },
+  
+  // 用 JSON Patch 操作数组或 JSON Merge Patch 对象修改 JSON 值
+  patchItem(key, patch) {
+    const contentType = Array.isArray(patch)
+      ? 'application/json-patch+json'
+      : 'application/merge-patch+json'
+    return api.patch(`/v1/kv/${key}`, patch, { headers: { 'Content-Type': contentType } })
+  },
+  
+  // 获取 JSON 值中 path 指向的子文档
+  getItemPath(key, path) {
+    return api.get(`/v1/kv/${key}`, { params: { path } })
+  },
+  
+  // 获取键的历史版本（不含值），从新到旧排列
+  getHistory(key) {
+    return api.get(`/v1/kv/${key}/history`)
+  },
+  
+  // 读取键的某个历史版本
+  getItemVersion(key, version) {
+    return api.get(`/v1/kv/${key}`, { params: { version } })
+  },
+  
+  // 把键恢复为某个历史版本，恢复会产生一个新的版本
+  rollbackItem(key, version) {
+    return api.post(`/v1/kv/${key}/rollback`, { version })
+  },
+  
   // 导入数据
   importData(data) {
     return api.post('/v1/kv/import', data)
@@ -88,6 +144,130 @@ export const kvApi = {
   }
 }
 
+// 数据结构API（哈希、列表、集合、有序集合）
+export const structuresApi = {
+  // 哈希
+  getHash(key) {
+    return api.get(`/v1/hash/${key}`)
+  },
+  setHashFields(key, fields) {
+    return api.put(`/v1/hash/${key}`, { fields })
+  },
+  deleteHashField(key, field) {
+    return api.delete(`/v1/hash/${key}/${field}`)
+  },
+  
+  // 列表
+  getList(key, start = 0, stop = -1) {
+    return api.get(`/v1/list/${key}`, { params: { start, stop } })
+  },
+  pushList(key, values, left = false) {
+    return api.post(`/v1/list/${key}/${left ? 'lpush' : 'rpush'}`, { values })
+  },
+  popList(key, count = 1, left = true) {
+    return api.post(`/v1/list/${key}/${left ? 'lpop' : 'rpop'}`, { count })
+  },
+  
+  // 集合
+  getSet(key) {
+    return api.get(`/v1/set/${key}`)
+  },
+  addSetMembers(key, members) {
+    return api.post(`/v1/set/${key}`, { members })
+  },
+  removeSetMember(key, member) {
+    return api.delete(`/v1/set/${key}/${member}`)
+  },
+  
+  // 有序集合，params 为 start/stop/reverse，或 min/max/offset/limit/reverse
+  getZSet(key, params = {}) {
+    return api.get(`/v1/zset/${key}`, { params })
+  },
+  addZSetMembers(key, members) {
+    return api.post(`/v1/zset/${key}`, { members })
+  },
+  getZSetMember(key, member, reverse = false) {
+    return api.get(`/v1/zset/${key}/${member}`, { params: { reverse } })
+  },
+  incrZSetScore(key, member, delta) {
+    return api.post(`/v1/zset/${key}/${member}/incr`, { delta })
+  },
+  removeZSetMember(key, member) {
+    return api.delete(`/v1/zset/${key}/${member}`)
+  },
+  
+  // 删除整个结构，type 为 hash、list、set 或 zset
+  deleteStructure(type, key) {
+    return api.delete(`/v1/${type}/${key}`)
+  }
+}
+
+// 二级索引API
+export const indexApi = {
+  // 获取所有索引及其构建状态
+  getIndexes() {
+    return api.get('/v1/indexes')
+  },
+  
+  // 创建索引，type 为 string（默认）或 number
+  createIndex(name, prefix, path, type = 'string') {
+    return api.post('/v1/indexes', { name, prefix, path, type })
+  },
+  
+  getIndex(name) {
+    return api.get(`/v1/indexes/${name}`)
+  },
+  
+  dropIndex(name) {
+    return api.delete(`/v1/indexes/${name}`)
+  },
+  
+  // 按索引查询，params 包含 eq 或 gte/lte，以及 limit、cursor、reverse
+  query(index, params = {}) {
+    return api.get('/v1/query', { params: { index, ...params } })
+  }
+}
+
+// 全文检索API
+export const searchApi = {
+  // 检索键名或值中包含所有查询词的键，结果按相关度排序，高亮片段已经过HTML转义
+  search(q, offset = 0, limit = 20) {
+    return api.get('/v1/search', { params: { q, offset, limit } })
+  },
+  
+  // 在后台重建全文索引
+  rebuild(database) {
+    return api.post('/v1/admin/search/rebuild', database ? { database } : {})
+  },
+  
+  // 获取全文索引的状态和统计信息
+  getStats(database) {
+    return api.get('/v1/admin/search', { params: database ? { database } : {} })
+  }
+}
+
+// 变更订阅API
+export const watchApi = {
+  // 通过SSE订阅键以prefix开头的变更，onChange收到 { token, seq, op, key, version, time }。
+  // 浏览器断线重连时会自动带上最后的事件id（恢复令牌），返回的EventSource需要调用close()关闭
+  watch(prefix = '', onChange, after = '') {
+    const params = new URLSearchParams()
+    if (prefix) params.set('prefix', prefix)
+    if (after) params.set('after', after)
+    const source = new EventSource(`/api/v1/watch?${params}`)
+    source.addEventListener('change', e => onChange(JSON.parse(e.data)))
+    return source
+  }
+}
+
+// 主从复制API
+export const replicationApi = {
+  // 获取本节点的复制角色，以及主节点的日志位置或从节点的复制进度
+  getStatus() {
+    return api.get('/v1/replication/status')
+  }
+}
+
 // 数据库API
 export const dbApi = {
   // 检查数据库连接状态
@@ -103,6 +283,11 @@ export const dbApi = {
   // 关闭数据库连接
   closeConnection() {
     return api.post('/v1/db/close')
+  },
+  
+  // 获取数据库统计信息
+  getStats() {
+    return api.get('/v1/db/stats')
   }
 }
 
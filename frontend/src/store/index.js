@@ -21,6 +21,7 @@ export default createStore({
     recentActivities: [],
     dbConnected: false,
     dbConnectionError: null,
+    dbStats: null,
     darkMode: false,
     dataInitialized: false,
     notifications: []
@@ -35,6 +36,7 @@ export default createStore({
     getRecentActivities: (state) => state.recentActivities,
     isDbConnected: (state) => state.dbConnected,
     getDbConnectionError: (state) => state.dbConnectionError,
+    getDbStats: (state) => state.dbStats,
     isDarkMode: (state) => state.darkMode,
     getNotifications: (state) => state.notifications
   },
@@ -70,6 +72,9 @@ export default createStore({
     SET_DB_CONNECTION_ERROR(state, error) {
       state.dbConnectionError = error
     },
+    SET_DB_STATS(state, stats) {
+      state.dbStats = stats
+    },
     SET_DARK_MODE(state, isDark) {
       state.darkMode = isDark
     },
@@ -106,13 +111,16 @@ export default createStore({
         const response = await kvApi.getAllItems()
         if (response && response.items) {
           // 将对象格式转换为数组格式
+          const metadata = response.metadata || {}
           const items = Object.entries(response.items).map(([key, value]) => ({
             key,
             value,
             // 尝试判断值的类型
             type: getValueType(value),
-            // 添加一个临时的更新时间
-            updatedAt: new Date().toLocaleString()
+            // 使用服务端记录的元数据
+            createdAt: metadata[key] ? metadata[key].createdAt : null,
+            updatedAt: metadata[key] ? metadata[key].updatedAt : null,
+            version: metadata[key] ? metadata[key].version : null
           }))
           
           // 检查是否有最近活动记录
@@ -373,6 +381,19 @@ export default createStore({
     },
     
     // 检查数据库连接状态
+    // 获取数据库统计信息
+    async fetchDbStats({ commit }) {
+      try {
+        const response = await dbApi.getStats()
+        commit('SET_DB_STATS', response.data)
+        return response.data
+      } catch (error) {
+        console.error('获取数据库统计信息失败:', error)
+        commit('SET_DB_STATS', null)
+        return null
+      }
+    },
+    
     async checkDbConnection({ commit, dispatch, state }) {
       try {
         const response = await dbApi.checkConnection()
@@ -565,6 +586,20 @@ export default createStore({
           data = Object.entries(response.items)
             .filter(([key]) => key !== '_recent_activities') // 过滤掉活动记录
             .map(([key, value]) => {
+              // 优先使用服务端记录的元数据
+              const meta = response.metadata && response.metadata[key]
+              if (meta) {
+                return {
+                  key,
+                  value,
+                  type: getValueType(value),
+                  createdAt: meta.createdAt,
+                  updatedAt: meta.updatedAt,
+                  version: meta.version,
+                  size: meta.size
+                };
+              }
+
               // 查找该键的创建时间
               let createdAt = null;
               // 查找添加记录